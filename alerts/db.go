@@ -0,0 +1,240 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mdigger/geotrack/mongo"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	// CollectionName описывает название коллекции с уведомлениями.
+	CollectionName = "alerts"
+	// RulesCollectionName описывает название коллекции с правилами.
+	RulesCollectionName = "alerts.rules"
+)
+
+// Состояния уведомлений.
+const (
+	StateOpen         = "open"         // новое уведомление
+	StateAcknowledged = "acknowledged" // уведомление просмотрено
+	StateResolved     = "resolved"     // проблема решена
+)
+
+// Alert описывает уведомление, сформированное при срабатывании правила.
+type Alert struct {
+	ID           bson.ObjectId `bson:"_id"`        // уникальный идентификатор
+	GroupID      string        `json:",omitempty"` // идентификатор группы
+	DeviceID     string        // уникальный идентификатор устройства
+	RuleID       bson.ObjectId // идентификатор правила
+	Type         string        // тип правила
+	Name         string        // название правила
+	Sensor       string        `json:",omitempty" bson:",omitempty"` // название сенсора
+	Value        interface{}   `json:",omitempty" bson:",omitempty"` // значение, вызвавшее срабатывание
+	Message      string        // текстовое описание
+	Time         time.Time     // время срабатывания
+	State        string        // состояние уведомления
+	Acknowledged *time.Time    `json:",omitempty" bson:",omitempty"` // время просмотра
+	AckBy        string        `json:",omitempty" bson:",omitempty"` // кто просмотрел
+	Resolved     *time.Time    `json:",omitempty" bson:",omitempty"` // время решения
+	ResolvedBy   string        `json:",omitempty" bson:",omitempty"` // кто решил
+}
+
+// newAlert возвращает новое уведомление о срабатывании правила.
+func newAlert(rule Rule, deviceID string, t time.Time, value interface{}) Alert {
+	alert := Alert{
+		ID:       bson.NewObjectId(),
+		GroupID:  rule.GroupID,
+		DeviceID: deviceID,
+		RuleID:   rule.ID,
+		Type:     rule.Type,
+		Name:     rule.Name,
+		Sensor:   rule.Sensor,
+		Value:    value,
+		Time:     t,
+		State:    StateOpen,
+	}
+	switch rule.Type {
+	case RuleThreshold:
+		alert.Message = fmt.Sprintf("%s %v %s %v", rule.Sensor, value, rule.Operator, rule.Threshold)
+	case RuleRate:
+		alert.Message = fmt.Sprintf("%s rate of change %s %v per minute", rule.Sensor,
+			rule.Operator, rule.Threshold)
+	case RuleTrigger:
+		alert.Message = fmt.Sprintf("%s triggered", rule.Sensor)
+	case RuleBattery:
+		alert.Message = fmt.Sprintf("battery %v%% <= %v%%", value, rule.Threshold)
+	case RuleNoData:
+		alert.Message = fmt.Sprintf("no data for %d minutes", rule.Minutes)
+		if rule.Sensor != "" {
+			alert.Message = fmt.Sprintf("no %s data for %d minutes", rule.Sensor, rule.Minutes)
+		}
+	}
+	return alert
+}
+
+// ErrNotFound возвращается, если правило или уведомление не найдено.
+var ErrNotFound = errors.New("alert not found")
+
+// DB описывает хранилище правил и уведомлений.
+type DB struct {
+	*mongo.DB // соединение с MongoDB
+}
+
+// InitDB инициализирует хранилище правил и уведомлений.
+func InitDB(mdb *mongo.DB) (db *DB, err error) {
+	db = &DB{mdb}
+	coll := mdb.GetCollection(RulesCollectionName)
+	err = coll.EnsureIndexKey("groupid", "type")
+	mdb.FreeCollection(coll)
+	if err != nil {
+		return
+	}
+	coll = mdb.GetCollection(CollectionName)
+	defer mdb.FreeCollection(coll)
+	if err = coll.EnsureIndexKey("groupid", "state", "-time"); err != nil {
+		return
+	}
+	err = coll.EnsureIndexKey("groupid", "ruleid", "deviceid", "state")
+	return
+}
+
+// GetRules возвращает список правил группы.
+func (db *DB) GetRules(groupID string) (rules []Rule, err error) {
+	coll := db.GetCollection(RulesCollectionName)
+	rules = make([]Rule, 0)
+	err = coll.Find(bson.M{"groupid": groupID}).All(&rules)
+	db.FreeCollection(coll)
+	return
+}
+
+// GetRulesByType возвращает список включенных правил указанного типа для всех групп.
+func (db *DB) GetRulesByType(ruleType string) (rules []Rule, err error) {
+	coll := db.GetCollection(RulesCollectionName)
+	rules = make([]Rule, 0)
+	err = coll.Find(bson.M{"type": ruleType, "disabled": bson.M{"$ne": true}}).All(&rules)
+	db.FreeCollection(coll)
+	return
+}
+
+// GetRule возвращает описание правила группы.
+func (db *DB) GetRule(groupID, ruleID string) (rule *Rule, err error) {
+	if !bson.IsObjectIdHex(ruleID) {
+		return nil, ErrNotFound
+	}
+	coll := db.GetCollection(RulesCollectionName)
+	rule = new(Rule)
+	err = coll.Find(bson.M{"_id": bson.ObjectIdHex(ruleID), "groupid": groupID}).One(rule)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrNotFound
+	}
+	return
+}
+
+// SaveRule сохраняет правило в хранилище. Если идентификатор правила не задан,
+// то он присваивается автоматически.
+func (db *DB) SaveRule(rule *Rule) (err error) {
+	if err = rule.Validate(); err != nil {
+		return
+	}
+	if !rule.ID.Valid() {
+		rule.ID = bson.NewObjectId()
+	}
+	coll := db.GetCollection(RulesCollectionName)
+	_, err = coll.Upsert(bson.M{"_id": rule.ID, "groupid": rule.GroupID}, rule)
+	db.FreeCollection(coll)
+	return
+}
+
+// DeleteRule удаляет правило группы.
+func (db *DB) DeleteRule(groupID, ruleID string) (err error) {
+	if !bson.IsObjectIdHex(ruleID) {
+		return ErrNotFound
+	}
+	coll := db.GetCollection(RulesCollectionName)
+	err = coll.Remove(bson.M{"_id": bson.ObjectIdHex(ruleID), "groupid": groupID})
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Add сохраняет уведомление в хранилище, если для того же правила и устройства нет
+// другого нерешенного уведомления. Возвращает true, если уведомление было сохранено.
+func (db *DB) Add(alert Alert) (added bool, err error) {
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	count, err := coll.Find(bson.M{
+		"groupid":  alert.GroupID,
+		"ruleid":   alert.RuleID,
+		"deviceid": alert.DeviceID,
+		"state":    bson.M{"$ne": StateResolved},
+	}).Count()
+	if err != nil || count > 0 {
+		return false, err
+	}
+	if err = coll.Insert(alert); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Get возвращает список уведомлений группы, начиная с самых свежих. Если состояние
+// не указано, то возвращаются уведомления в любом состоянии.
+func (db *DB) Get(groupID, state string, limit int) (alerts []Alert, err error) {
+	search := bson.M{"groupid": groupID}
+	if state != "" {
+		search["state"] = state
+	}
+	coll := db.GetCollection(CollectionName)
+	query := coll.Find(search).Sort("-time")
+	if limit > 0 {
+		query.Limit(limit)
+	}
+	alerts = make([]Alert, 0)
+	err = query.All(&alerts)
+	db.FreeCollection(coll)
+	return
+}
+
+// Acknowledge отмечает уведомление группы как просмотренное пользователем.
+// Изменяются только новые уведомления.
+func (db *DB) Acknowledge(groupID, alertID, userID string) error {
+	return db.setState(groupID, alertID, bson.M{
+		"state":        StateAcknowledged,
+		"acknowledged": time.Now(),
+		"ackby":        userID,
+	}, StateOpen)
+}
+
+// Resolve отмечает уведомление группы как решенное пользователем.
+func (db *DB) Resolve(groupID, alertID, userID string) error {
+	return db.setState(groupID, alertID, bson.M{
+		"state":      StateResolved,
+		"resolved":   time.Now(),
+		"resolvedby": userID,
+	}, StateOpen, StateAcknowledged)
+}
+
+// setState изменяет состояние уведомления группы, если текущее состояние входит в список.
+func (db *DB) setState(groupID, alertID string, update bson.M, states ...string) (err error) {
+	if !bson.IsObjectIdHex(alertID) {
+		return ErrNotFound
+	}
+	coll := db.GetCollection(CollectionName)
+	err = coll.Update(bson.M{
+		"_id":     bson.ObjectIdHex(alertID),
+		"groupid": groupID,
+		"state":   bson.M{"$in": states},
+	}, bson.M{"$set": update})
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrNotFound
+	}
+	return
+}
@@ -0,0 +1,231 @@
+package alerts
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mdigger/geotrack/sensors"
+	"github.com/mdigger/geotrack/tracks"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Типы правил.
+const (
+	RuleThreshold = "threshold" // значение сенсора сравнивается с пороговым
+	RuleRate      = "rate"      // скорость изменения значения сенсора в минуту сравнивается с пороговой
+	RuleTrigger   = "trigger"   // логический сенсор принял значение true
+	RuleNoData    = "nodata"    // от устройства не поступали данные в течение заданного времени
+	RuleBattery   = "battery"   // уровень заряда батареи устройства не выше порогового
+)
+
+// Rule описывает правило проверки данных сенсоров.
+type Rule struct {
+	ID        bson.ObjectId `bson:"_id"`                          // уникальный идентификатор
+	GroupID   string        `json:",omitempty"`                   // идентификатор группы
+	DeviceID  string        `json:",omitempty" bson:",omitempty"` // устройство; пустое — все устройства группы
+	Name      string        // название правила
+	Type      string        // тип правила
+	Sensor    string        `json:",omitempty" bson:",omitempty"` // название сенсора
+	Operator  string        `json:",omitempty" bson:",omitempty"` // оператор сравнения: <, <=, >, >=, ==
+	Threshold float64       `json:",omitempty" bson:",omitempty"` // пороговое значение
+	Minutes   int           `json:",omitempty" bson:",omitempty"` // интервал времени в минутах
+	Disabled  bool          `json:",omitempty" bson:",omitempty"` // правило отключено
+}
+
+// ErrBadRule возвращается, если описание правила не корректно.
+var ErrBadRule = errors.New("bad alert rule")
+
+// Validate проверяет корректность описания правила.
+func (r Rule) Validate() error {
+	switch r.Type {
+	case RuleThreshold, RuleRate:
+		if r.Sensor == "" || !validOperator(r.Operator) {
+			return ErrBadRule
+		}
+	case RuleTrigger:
+		if r.Sensor == "" {
+			return ErrBadRule
+		}
+	case RuleNoData:
+		if r.Minutes < 1 {
+			return ErrBadRule
+		}
+	case RuleBattery:
+		if r.Threshold <= 0 || r.Threshold > 100 {
+			return ErrBadRule
+		}
+	default:
+		return ErrBadRule
+	}
+	return nil
+}
+
+// validOperator возвращает true, если оператор сравнения поддерживается.
+func validOperator(operator string) bool {
+	switch operator {
+	case "<", "<=", ">", ">=", "==":
+		return true
+	default:
+		return false
+	}
+}
+
+// compare сравнивает значение с пороговым с помощью оператора.
+func compare(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "==":
+		return value == threshold
+	default:
+		return false
+	}
+}
+
+// matches возвращает true, если правило относится к данному устройству группы.
+func (r Rule) matches(groupID, deviceID string) bool {
+	return !r.Disabled && r.GroupID == groupID && (r.DeviceID == "" || r.DeviceID == deviceID)
+}
+
+// lastValue описывает последнее полученное значение сенсора.
+type lastValue struct {
+	Time  time.Time
+	Value interface{}
+}
+
+// Engine проверяет данные сенсоров по правилам и формирует уведомления.
+// Для проверки скорости изменения значений и отсутствия данных хранит последние
+// полученные значения сенсоров каждого устройства. Безопасен для одновременного использования.
+type Engine struct {
+	last map[engineKey]lastValue // последние значения сенсоров
+	mu   sync.Mutex
+}
+
+// NewEngine возвращает новый инициализированный обработчик правил.
+func NewEngine() *Engine {
+	return &Engine{last: make(map[engineKey]lastValue)}
+}
+
+// engineKey описывает ключ для хранения последнего значения сенсора. Пустое название
+// сенсора используется для хранения времени получения любых данных от устройства.
+type engineKey struct {
+	GroupID  string
+	DeviceID string
+	Sensor   string
+}
+
+// number возвращает числовое значение сенсора.
+func number(value interface{}) (float64, bool) {
+	normalized, err := sensors.Schema{Type: sensors.TypeNumber}.Check(value)
+	if err != nil {
+		return 0, false
+	}
+	return normalized.(float64), true
+}
+
+// Check проверяет данные сенсоров по правилам и возвращает список сработавших уведомлений.
+// Правила, относящиеся к другим группам или устройствам, игнорируются.
+func (e *Engine) Check(rules []Rule, data sensors.SensorData) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := make([]Alert, 0)
+	for _, rule := range rules {
+		if !rule.matches(data.GroupID, data.DeviceID) ||
+			rule.Type == RuleNoData || rule.Type == RuleBattery {
+			continue
+		}
+		value, ok := data.Data[rule.Sensor]
+		if !ok {
+			continue
+		}
+		var fired bool
+		switch rule.Type {
+		case RuleThreshold:
+			if v, ok := number(value); ok {
+				fired = compare(v, rule.Operator, rule.Threshold)
+			}
+		case RuleRate:
+			prev, ok := e.last[engineKey{data.GroupID, data.DeviceID, rule.Sensor}]
+			minutes := data.Time.Sub(prev.Time).Minutes()
+			if !ok || minutes <= 0 {
+				break
+			}
+			v, ok1 := number(value)
+			p, ok2 := number(prev.Value)
+			if ok1 && ok2 {
+				fired = compare((v-p)/minutes, rule.Operator, rule.Threshold)
+			}
+		case RuleTrigger:
+			fired = value == true
+		}
+		if fired {
+			alerts = append(alerts, newAlert(rule, data.DeviceID, data.Time, value))
+		}
+	}
+	// сохраняем последние значения сенсоров и время получения данных от устройства
+	for name, value := range data.Data {
+		key := engineKey{data.GroupID, data.DeviceID, name}
+		if prev, ok := e.last[key]; !ok || !data.Time.Before(prev.Time) {
+			e.last[key] = lastValue{Time: data.Time, Value: value}
+		}
+	}
+	key := engineKey{data.GroupID, data.DeviceID, ""}
+	if prev, ok := e.last[key]; !ok || data.Time.After(prev.Time) {
+		e.last[key] = lastValue{Time: data.Time}
+	}
+	return alerts
+}
+
+// CheckTrack проверяет уровень заряда батареи из данных трекинга по правилам и возвращает
+// список сработавших уведомлений. Данные трекинга так же учитываются при проверке правил
+// отсутствия данных от устройства.
+func (e *Engine) CheckTrack(rules []Rule, track tracks.TrackData) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := make([]Alert, 0)
+	for _, rule := range rules {
+		if rule.Type != RuleBattery || !rule.matches(track.GroupID, track.DeviceID) {
+			continue
+		}
+		// нулевое значение означает, что уровень заряда неизвестен
+		if track.Power > 0 && float64(track.Power) <= rule.Threshold {
+			alerts = append(alerts, newAlert(rule, track.DeviceID, track.Time, track.Power))
+		}
+	}
+	key := engineKey{track.GroupID, track.DeviceID, ""}
+	if prev, ok := e.last[key]; !ok || track.Time.After(prev.Time) {
+		e.last[key] = lastValue{Time: track.Time}
+	}
+	return alerts
+}
+
+// CheckNoData проверяет правила отсутствия данных и возвращает список уведомлений для
+// устройств, от которых не поступали данные дольше заданного в правиле времени. Проверяются
+// только те устройства, данные от которых поступали с момента запуска обработчика.
+func (e *Engine) CheckNoData(rules []Rule, now time.Time) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := make([]Alert, 0)
+	for _, rule := range rules {
+		if rule.Disabled || rule.Type != RuleNoData {
+			continue
+		}
+		timeout := time.Duration(rule.Minutes) * time.Minute
+		for key, last := range e.last {
+			if key.Sensor != rule.Sensor || !rule.matches(key.GroupID, key.DeviceID) {
+				continue
+			}
+			if now.Sub(last.Time) > timeout {
+				alerts = append(alerts, newAlert(rule, key.DeviceID, now, last.Time))
+			}
+		}
+	}
+	return alerts
+}
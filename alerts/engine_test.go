@@ -0,0 +1,71 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdigger/geotrack/sensors"
+	"github.com/mdigger/geotrack/tracks"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestEngine(t *testing.T) {
+	rules := []Rule{
+		{ID: bson.NewObjectId(), GroupID: "group", Name: "жарко", Type: RuleThreshold,
+			Sensor: "Temperature", Operator: ">", Threshold: 38},
+		{ID: bson.NewObjectId(), GroupID: "group", Name: "быстрый разряд", Type: RuleRate,
+			Sensor: "Battery", Operator: "<=", Threshold: -1},
+		{ID: bson.NewObjectId(), GroupID: "group", Name: "тревога", Type: RuleTrigger,
+			Sensor: "SOS"},
+		{ID: bson.NewObjectId(), GroupID: "group", Name: "нет связи", Type: RuleNoData,
+			Minutes: 30},
+		{ID: bson.NewObjectId(), GroupID: "other", Name: "чужое", Type: RuleTrigger,
+			Sensor: "SOS"},
+		{ID: bson.NewObjectId(), GroupID: "group", Name: "разряд", Type: RuleBattery,
+			Threshold: 20},
+	}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			t.Errorf("rule %q: %v", rule.Name, err)
+		}
+	}
+	if err := (Rule{Type: RuleThreshold, Sensor: "Battery", Operator: "!"}).Validate(); err != ErrBadRule {
+		t.Error("bad operator accepted")
+	}
+
+	engine := NewEngine()
+	start := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	check := func(minutes int, data map[string]interface{}, expected ...string) {
+		alerts := engine.Check(rules, sensors.SensorData{
+			GroupID:  "group",
+			DeviceID: "device",
+			Time:     start.Add(time.Duration(minutes) * time.Minute),
+			Data:     data,
+		})
+		if len(alerts) != len(expected) {
+			t.Fatalf("%d: bad alerts count: %v", minutes, alerts)
+		}
+		for i, alert := range alerts {
+			if alert.Name != expected[i] || alert.State != StateOpen || alert.DeviceID != "device" {
+				t.Errorf("%d: bad alert: %+v", minutes, alert)
+			}
+		}
+	}
+	check(0, map[string]interface{}{"Temperature": 36.6, "Battery": 90.0, "SOS": false})
+	check(10, map[string]interface{}{"Temperature": 39, "Battery": 85.0}, "жарко")
+	check(15, map[string]interface{}{"Battery": 75.0}, "быстрый разряд")
+	check(20, map[string]interface{}{"SOS": true}, "тревога")
+
+	track := tracks.TrackData{GroupID: "group", DeviceID: "device",
+		Time: start.Add(25 * time.Minute), Power: 15}
+	if alerts := engine.CheckTrack(rules, track); len(alerts) != 1 || alerts[0].Name != "разряд" {
+		t.Errorf("bad battery alerts: %v", alerts)
+	}
+	if alerts := engine.CheckNoData(rules, start.Add(45*time.Minute)); len(alerts) != 0 {
+		t.Errorf("unexpected no data alerts: %v", alerts)
+	}
+	alerts := engine.CheckNoData(rules, start.Add(65*time.Minute))
+	if len(alerts) != 1 || alerts[0].Name != "нет связи" || alerts[0].DeviceID != "device" {
+		t.Errorf("bad no data alerts: %v", alerts)
+	}
+}
@@ -0,0 +1,187 @@
+// Package battery анализирует уровень заряда батареи устройств по данным трекинга: строит
+// кривую разряда, определяет сеансы зарядки, оценивает скорость разряда, оставшееся время
+// работы и время достижения низкого уровня заряда.
+package battery
+
+import (
+	"time"
+
+	"github.com/mdigger/geotrack/tracks"
+)
+
+// Options описывает параметры анализа уровня заряда.
+type Options struct {
+	LowLevel  uint8         // низкий уровень заряда в процентах
+	MinCharge uint8         // минимальное увеличение заряда, считающееся зарядкой
+	Window    time.Duration // период, по которому оценивается скорость разряда
+	MinSpan   time.Duration // минимальная длительность данных для оценки скорости разряда
+}
+
+// DefaultOptions описывает параметры анализа по умолчанию.
+var DefaultOptions = Options{
+	LowLevel:  20,
+	MinCharge: 5,
+	Window:    6 * time.Hour,
+	MinSpan:   30 * time.Minute,
+}
+
+// Level описывает уровень заряда в определенный момент времени.
+type Level struct {
+	Time  time.Time // временная метка
+	Power uint8     // уровень заряда в процентах
+}
+
+// Session описывает сеанс зарядки устройства.
+type Session struct {
+	From      time.Time // время начала зарядки
+	To        time.Time // время окончания зарядки
+	FromLevel uint8     // уровень заряда в начале
+	ToLevel   uint8     // уровень заряда в конце
+	Ongoing   bool      `json:",omitempty"` // зарядка продолжается
+}
+
+// Report описывает результат анализа уровня заряда.
+type Report struct {
+	Time      time.Time  // время получения последнего значения
+	Level     uint8      // последний известный уровень заряда
+	Charging  bool       // устройство заряжается
+	Low       bool       // уровень заряда низкий
+	Rate      float64    `json:",omitempty"` // скорость разряда в процентах в час
+	Remaining float64    `json:",omitempty"` // оставшееся время работы в часах
+	Empty     *time.Time `json:",omitempty"` // ожидаемое время полного разряда
+	LowAt     *time.Time `json:",omitempty"` // ожидаемое время достижения низкого уровня
+	Curve     []Level    // кривая изменения уровня заряда
+	Sessions  []Session  // сеансы зарядки
+}
+
+// Curve возвращает список изменений уровня заряда по трекам, отсортированным в хронологическом
+// порядке. Треки без информации о заряде пропускаются, а из последовательных одинаковых
+// значений сохраняются только первое и последнее.
+func Curve(list []tracks.Track) []Level {
+	curve := make([]Level, 0)
+	for _, track := range list {
+		if track.Power == 0 {
+			continue
+		}
+		level := Level{Time: track.Time, Power: track.Power}
+		if n := len(curve); n > 1 && curve[n-1].Power == level.Power &&
+			curve[n-2].Power == level.Power {
+			curve[n-1] = level // заменяем последнее из одинаковых значений
+			continue
+		}
+		curve = append(curve, level)
+	}
+	return curve
+}
+
+// Sessions возвращает список сеансов зарядки. Сеансом зарядки считается непрерывное
+// увеличение уровня заряда не менее чем на opts.MinCharge процентов.
+func Sessions(curve []Level, opts Options) []Session {
+	sessions := make([]Session, 0)
+	if len(curve) == 0 {
+		return sessions
+	}
+	start := 0 // индекс минимального значения перед началом роста
+	closeRun := func(end int, ongoing bool) {
+		if curve[end].Power >= curve[start].Power+opts.MinCharge {
+			sessions = append(sessions, Session{
+				From:      curve[start].Time,
+				To:        curve[end].Time,
+				FromLevel: curve[start].Power,
+				ToLevel:   curve[end].Power,
+				Ongoing:   ongoing,
+			})
+		}
+	}
+	for i := 1; i < len(curve); i++ {
+		switch {
+		case curve[i].Power < curve[i-1].Power:
+			closeRun(i-1, false)
+			start = i
+		case curve[i].Power == curve[start].Power:
+			start = i // рост еще не начался
+		}
+	}
+	closeRun(len(curve)-1, true)
+	return sessions
+}
+
+// Rate возвращает скорость разряда в процентах в час, вычисленную методом наименьших
+// квадратов по значениям за последний период opts.Window, полученным после окончания
+// последней зарядки. Если данных недостаточно или уровень заряда не уменьшается,
+// то возвращается 0.
+func Rate(curve []Level, sessions []Session, opts Options) float64 {
+	if len(curve) < 2 {
+		return 0
+	}
+	last := curve[len(curve)-1].Time
+	from := last.Add(-opts.Window)
+	if n := len(sessions); n > 0 && sessions[n-1].To.After(from) {
+		from = sessions[n-1].To
+	}
+	var (
+		count            int
+		sx, sy, sxx, sxy float64
+		first            time.Time
+	)
+	for _, level := range curve {
+		if level.Time.Before(from) {
+			continue
+		}
+		if count == 0 {
+			first = level.Time
+		}
+		x := level.Time.Sub(first).Hours()
+		y := float64(level.Power)
+		sx, sy, sxx, sxy = sx+x, sy+y, sxx+x*x, sxy+x*y
+		count++
+	}
+	if count < 2 || last.Sub(first) < opts.MinSpan {
+		return 0
+	}
+	n := float64(count)
+	denominator := n*sxx - sx*sx
+	if denominator == 0 {
+		return 0
+	}
+	slope := (n*sxy - sx*sy) / denominator
+	if slope >= 0 {
+		return 0
+	}
+	return -slope
+}
+
+// Analyze анализирует уровень заряда по трекам устройства, отсортированным в хронологическом
+// порядке, и возвращает отчет. Если ни один трек не содержит информации о заряде, то
+// возвращается nil.
+func Analyze(list []tracks.Track, opts Options) *Report {
+	curve := Curve(list)
+	if len(curve) == 0 {
+		return nil
+	}
+	last := curve[len(curve)-1]
+	report := &Report{
+		Time:     last.Time,
+		Level:    last.Power,
+		Low:      last.Power <= opts.LowLevel,
+		Curve:    curve,
+		Sessions: Sessions(curve, opts),
+	}
+	if n := len(report.Sessions); n > 0 && report.Sessions[n-1].Ongoing {
+		report.Charging = true
+		return report
+	}
+	report.Rate = Rate(curve, report.Sessions, opts)
+	if report.Rate == 0 {
+		return report
+	}
+	report.Remaining = float64(last.Power) / report.Rate
+	empty := last.Time.Add(time.Duration(report.Remaining * float64(time.Hour)))
+	report.Empty = &empty
+	if !report.Low {
+		hours := float64(last.Power-opts.LowLevel) / report.Rate
+		lowAt := last.Time.Add(time.Duration(hours * float64(time.Hour)))
+		report.LowAt = &lowAt
+	}
+	return report
+}
@@ -0,0 +1,59 @@
+package battery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdigger/geotrack/tracks"
+)
+
+func TestAnalyze(t *testing.T) {
+	start := time.Date(2015, 12, 1, 8, 0, 0, 0, time.UTC)
+	var list []tracks.Track
+	add := func(minutes int, power ...uint8) {
+		for _, value := range power {
+			list = append(list, tracks.Track{
+				Time:  start.Add(time.Duration(minutes) * time.Minute),
+				Power: value,
+			})
+			minutes += 30
+		}
+	}
+	add(0, 80, 80, 80, 78, 0, 76, 74) // разряд, трек без информации о заряде
+	add(210, 72, 80, 90, 100, 100)    // зарядка
+	add(360, 98, 96, 94, 92, 90, 88)  // разряд 4% в час
+	report := Analyze(list, DefaultOptions)
+	if report == nil {
+		t.Fatal("empty report")
+	}
+	if len(report.Curve) != len(list)-2 {
+		t.Errorf("bad curve length: %d", len(report.Curve))
+	}
+	if len(report.Sessions) != 1 {
+		t.Fatalf("bad sessions: %v", report.Sessions)
+	}
+	session := report.Sessions[0]
+	if session.FromLevel != 72 || session.ToLevel != 100 || session.Ongoing ||
+		!session.From.Equal(start.Add(210*time.Minute)) {
+		t.Errorf("bad session: %+v", session)
+	}
+	if report.Charging || report.Low || report.Level != 88 {
+		t.Errorf("bad report: %+v", report)
+	}
+	if report.Rate < 3.5 || report.Rate > 4.5 {
+		t.Errorf("bad rate: %v", report.Rate)
+	}
+	if report.Empty == nil || report.LowAt == nil || !report.LowAt.Before(*report.Empty) {
+		t.Errorf("bad prediction: %v %v", report.Empty, report.LowAt)
+	}
+
+	// зарядка продолжается
+	add(540, 95)
+	report = Analyze(list, DefaultOptions)
+	if !report.Charging || report.Rate != 0 || report.Empty != nil {
+		t.Errorf("bad charging report: %+v", report)
+	}
+	if Analyze(nil, DefaultOptions) != nil {
+		t.Error("report for empty tracks")
+	}
+}
@@ -0,0 +1,225 @@
+package devices
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mdigger/geotrack/mongo"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CollectionName описывает название коллекции с зарегистрированными устройствами.
+var CollectionName = "devices"
+
+// Device описывает зарегистрированное устройство.
+type Device struct {
+	ID       string        `bson:"_id"`                          // уникальный идентификатор устройства
+	GroupID  string        `json:",omitempty"`                   // идентификатор группы
+	IMEI     string        `bson:",omitempty" json:",omitempty"` // IMEI устройства
+	Name     string        `bson:",omitempty" json:",omitempty"` // отображаемое название
+	Model    string        `bson:",omitempty" json:",omitempty"` // модель устройства
+	Firmware string        `bson:",omitempty" json:",omitempty"` // версия прошивки
+	Photo    string        `bson:",omitempty" json:",omitempty"` // ссылка на фотографию
+	Created  time.Time     // время регистрации
+	PairedBy bson.ObjectId `bson:",omitempty" json:",omitempty"` // пользователь, связавший устройство
+	TokenID  string        `bson:",omitempty" json:"-"`          // идентификатор действующего токена устройства
+}
+
+var (
+	// ErrNotFound возвращается, если устройство не зарегистрировано в группе.
+	ErrNotFound = errors.New("device not found")
+	// ErrPaired возвращается, если устройство уже связано с другой группой.
+	ErrPaired = errors.New("device is paired with another group")
+	// ErrIMEIConflict возвращается, если IMEI совпадает с идентификатором другого устройства.
+	ErrIMEIConflict = errors.New("IMEI matches another device ID")
+)
+
+// DB описывает хранилище зарегистрированных устройств.
+type DB struct {
+	*mongo.DB // соединение с MongoDB
+}
+
+// InitDB инициализирует хранилище зарегистрированных устройств.
+func InitDB(mdb *mongo.DB) (db *DB, err error) {
+	db = &DB{mdb}
+	coll := mdb.GetCollection(CollectionName)
+	defer mdb.FreeCollection(coll)
+	if err = coll.EnsureIndexKey("groupid"); err != nil {
+		return
+	}
+	err = coll.EnsureIndex(mgo.Index{
+		Key:    []string{"imei"},
+		Unique: true,
+		Sparse: true,
+	})
+	return
+}
+
+// Pair регистрирует устройство в группе. Если устройство уже зарегистрировано в этой
+// группе, то его описание не изменяется, а если в другой — возвращается ErrPaired.
+func (db *DB) Pair(groupID, deviceID string, userID bson.ObjectId) (device *Device, err error) {
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	device = &Device{
+		ID:       deviceID,
+		GroupID:  groupID,
+		Created:  time.Now(),
+		PairedBy: userID,
+	}
+	err = coll.Insert(device)
+	if !mgo.IsDup(err) {
+		return
+	}
+	// устройство уже зарегистрировано
+	if err = coll.FindId(deviceID).One(device); err != nil {
+		return nil, err
+	}
+	if device.GroupID != groupID {
+		return nil, ErrPaired
+	}
+	return device, nil
+}
+
+// Transfer регистрирует устройство в группе. Если устройство уже зарегистрировано
+// в другой группе, то оно переносится в указанную группу.
+func (db *DB) Transfer(groupID, deviceID string, userID bson.ObjectId) (device *Device, err error) {
+	device, err = db.Pair(groupID, deviceID, userID)
+	if err != ErrPaired {
+		return
+	}
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	device = new(Device)
+	_, err = coll.FindId(deviceID).Apply(mgo.Change{
+		Update: bson.M{
+			"$set": bson.M{
+				"groupid":  groupID,
+				"pairedby": userID,
+			},
+			"$unset": bson.M{"tokenid": ""}, // токен старой группы больше не действует
+		},
+		ReturnNew: true,
+	}, device)
+	return
+}
+
+// Lookup возвращает описание зарегистрированного устройства по его идентификатору
+// или IMEI вне зависимости от группы. Поиск по IMEI выполняется, только если устройство
+// с таким идентификатором не найдено.
+func (db *DB) Lookup(id string) (device *Device, err error) {
+	coll := db.GetCollection(CollectionName)
+	device = new(Device)
+	err = coll.FindId(id).One(device)
+	if err == mgo.ErrNotFound {
+		err = coll.Find(bson.M{"imei": id}).One(device)
+	}
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Get возвращает описание устройства группы.
+func (db *DB) Get(groupID, deviceID string) (device *Device, err error) {
+	coll := db.GetCollection(CollectionName)
+	device = new(Device)
+	err = coll.Find(bson.M{"_id": deviceID, "groupid": groupID}).One(device)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrNotFound
+	}
+	return
+}
+
+// GetAll возвращает список всех устройств группы.
+func (db *DB) GetAll(groupID string) (devices []Device, err error) {
+	coll := db.GetCollection(CollectionName)
+	devices = make([]Device, 0)
+	err = coll.Find(bson.M{"groupid": groupID}).Sort("_id").All(&devices)
+	db.FreeCollection(coll)
+	return
+}
+
+// Update изменяет описательные поля зарегистрированного устройства группы: IMEI, название,
+// модель, версию прошивки и фотографию. Пустые значения удаляют соответствующие поля.
+// IMEI не может совпадать с идентификатором другого устройства.
+func (db *DB) Update(device *Device) (err error) {
+	set, unset := bson.M{}, bson.M{}
+	for name, value := range map[string]string{
+		"imei":     device.IMEI,
+		"name":     device.Name,
+		"model":    device.Model,
+		"firmware": device.Firmware,
+		"photo":    device.Photo,
+	} {
+		if value != "" {
+			set[name] = value
+		} else {
+			unset[name] = ""
+		}
+	}
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	if device.IMEI != "" && device.IMEI != device.ID {
+		var count int
+		if count, err = coll.FindId(device.IMEI).Count(); err != nil {
+			return
+		}
+		if count > 0 {
+			return ErrIMEIConflict
+		}
+	}
+	err = coll.Update(bson.M{"_id": device.ID, "groupid": device.GroupID}, update)
+	if err == mgo.ErrNotFound {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Delete удаляет устройство из группы.
+func (db *DB) Delete(groupID, deviceID string) (err error) {
+	coll := db.GetCollection(CollectionName)
+	err = coll.Remove(bson.M{"_id": deviceID, "groupid": groupID})
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrNotFound
+	}
+	return
+}
+
+// SetToken сохраняет идентификатор действующего токена устройства группы: ранее выданные
+// устройству токены перестают действовать. Пустой идентификатор отзывает токен устройства.
+func (db *DB) SetToken(groupID, deviceID, tokenID string) (err error) {
+	update := bson.M{"$set": bson.M{"tokenid": tokenID}}
+	if tokenID == "" {
+		update = bson.M{"$unset": bson.M{"tokenid": ""}}
+	}
+	coll := db.GetCollection(CollectionName)
+	err = coll.Update(bson.M{"_id": deviceID, "groupid": groupID}, update)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrNotFound
+	}
+	return
+}
+
+// CheckToken возвращает true, если токен с указанным идентификатором является действующим
+// токеном устройства группы.
+func (db *DB) CheckToken(groupID, deviceID, tokenID string) (bool, error) {
+	if tokenID == "" {
+		return false, nil
+	}
+	coll := db.GetCollection(CollectionName)
+	n, err := coll.Find(bson.M{"_id": deviceID, "groupid": groupID, "tokenid": tokenID}).Count()
+	db.FreeCollection(coll)
+	return n > 0, err
+}
@@ -0,0 +1,96 @@
+package devices
+
+import (
+	"log"
+	"testing"
+
+	"github.com/mdigger/geotrack/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestDB(t *testing.T) {
+	mdb, err := mongo.Connect("mongodb://localhost/watch")
+	if err != nil {
+		log.Println("Error connecting to MongoDB:", err)
+		return
+	}
+	defer mdb.Close()
+
+	db, err := InitDB(mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const groupID, deviceID = "test", "test0123456789"
+	defer db.Delete(groupID, deviceID)
+	userID := bson.NewObjectId()
+	if _, err := db.Pair(groupID, deviceID, userID); err != nil {
+		t.Fatal(err)
+	}
+	// повторная привязка к той же группе не является ошибкой
+	if _, err := db.Pair(groupID, deviceID, bson.NewObjectId()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Pair("other", deviceID, userID); err != ErrPaired {
+		t.Errorf("unexpected pairing result: %v", err)
+	}
+	err = db.Update(&Device{ID: deviceID, GroupID: groupID, Name: "Браслет", Model: "K1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// IMEI не может совпадать с идентификатором другого устройства
+	const otherID = "test9876543210"
+	defer db.Delete("other", otherID)
+	if _, err := db.Pair("other", otherID, userID); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(&Device{ID: deviceID, GroupID: groupID, IMEI: otherID})
+	if err != ErrIMEIConflict {
+		t.Errorf("unexpected IMEI update result: %v", err)
+	}
+	if err := db.Update(&Device{ID: otherID, GroupID: "other", IMEI: "356938035643809"}); err != nil {
+		t.Fatal(err)
+	}
+	if device, err := db.Lookup("356938035643809"); err != nil || device.ID != otherID {
+		t.Errorf("bad IMEI lookup result: %+v (%v)", device, err)
+	}
+	device, err := db.Get(groupID, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Name != "Браслет" || device.Model != "K1" || device.PairedBy != userID {
+		t.Errorf("bad device: %+v", device)
+	}
+	if _, err := db.Get("other", deviceID); err != ErrNotFound {
+		t.Errorf("unexpected result: %v", err)
+	}
+	// токен устройства
+	if err := db.SetToken(groupID, deviceID, "token1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetToken("other", deviceID, "token2"); err != ErrNotFound {
+		t.Errorf("token set for other group: %v", err)
+	}
+	if ok, err := db.CheckToken(groupID, deviceID, "token1"); err != nil || !ok {
+		t.Errorf("device token not accepted: %v", err)
+	}
+	// перенос устройства в другую группу
+	device, err = db.Transfer("other", deviceID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.GroupID != "other" || device.Name != "Браслет" {
+		t.Errorf("bad transferred device: %+v", device)
+	}
+	if ok, err := db.CheckToken("other", deviceID, "token1"); err != nil || ok {
+		t.Errorf("device token accepted after transfer: %v", err)
+	}
+	if device, err = db.Lookup(deviceID); err != nil || device.GroupID != "other" {
+		t.Errorf("bad lookup result: %+v (%v)", device, err)
+	}
+	if err := db.Delete("other", deviceID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Lookup(deviceID); err != ErrNotFound {
+		t.Errorf("unexpected lookup result: %v", err)
+	}
+}
@@ -42,6 +42,12 @@ func (c Circle) Polygon() Polygon {
 	return NewPolygon(points...)
 }
 
+// Distance возвращает расстояние в метрах от точки до границы круга.
+// Если точка находится внутри круга, то возвращается 0.
+func (c Circle) Distance(point Point) float64 {
+	return math.Max(0, c.Center.Distance(point)-c.Radius)
+}
+
 // Geo возвращает описание круга в виде GeoJSON-объекта.
 // По той простой идеи, что GeoJSON не поддерживает круги, он преобразуется в полигон.
 func (c Circle) Geo() interface{} {
@@ -12,3 +12,13 @@ func TestCircle(t *testing.T) {
 	}
 	fmt.Println(circle.Geo())
 }
+
+func TestCircleDistance(t *testing.T) {
+	circle := NewCircle(37.57351, 55.715084, 500)
+	if d := circle.Distance(circle.Center.Move(300, 45)); d != 0 {
+		t.Errorf("distance inside circle: %v", d)
+	}
+	if d := circle.Distance(circle.Center.Move(1500, 90)); d < 999 || d > 1001 {
+		t.Errorf("distance outside circle: %v", d)
+	}
+}
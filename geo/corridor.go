@@ -0,0 +1,90 @@
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+// Corridor описывает коридор (маршрут): ломаную линию с буферной зоной вокруг нее.
+type Corridor struct {
+	Line  LineString // линия маршрута
+	Width float64    // ширина буферной зоны в метрах по каждую сторону от линии
+}
+
+// Valid возвращает true, если линия коридора содержит хотя бы две точки и задана
+// положительная ширина буферной зоны.
+func (c Corridor) Valid() bool {
+	return len(c.Line) > 1 && c.Width > 0
+}
+
+// Contains возвращает true, если точка находится внутри коридора.
+func (c Corridor) Contains(point Point) bool {
+	return c.Line.Distance(point) <= c.Width
+}
+
+// Distance возвращает расстояние в метрах от точки до границы коридора.
+// Если точка находится внутри коридора, то возвращается 0.
+func (c Corridor) Distance(point Point) float64 {
+	return math.Max(0, c.Line.Distance(point)-c.Width)
+}
+
+// Polygon возвращает полигон, гарантированно содержащий всю буферную зону коридора.
+//
+// Т.к. точная буферная зона ломаной линии может оказаться самопересекающимся полигоном,
+// который не принимается геоиндексом MongoDB, то в качестве полигона используется выпуклая
+// оболочка кругов, описанных вокруг каждой вершины линии. Такой полигон подходит для
+// предварительного отбора по индексу, но окончательную проверку нужно делать с помощью Contains.
+func (c Corridor) Polygon() Polygon {
+	points := make([]Point, 0, len(c.Line)*(CircleToPolygonSegments+1))
+	for _, vertex := range c.Line {
+		circle := Circle{Center: vertex, Radius: c.Width}
+		points = append(points, circle.Polygon()[0]...)
+	}
+	return NewPolygon(convexHull(points)...)
+}
+
+// Geo возвращает описание буферной зоны коридора в виде GeoJSON-объекта.
+func (c Corridor) Geo() interface{} {
+	return c.Polygon().Geo()
+}
+
+// convexHull возвращает выпуклую оболочку точек против часовой стрелки.
+// Используется алгоритм Эндрю (monotone chain).
+func convexHull(points []Point) []Point {
+	points = append([]Point(nil), points...)
+	sort.Sort(byLonLat(points))
+	if len(points) < 3 {
+		return points
+	}
+	cross := func(o, a, b Point) float64 {
+		return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+	}
+	hull := make([]Point, 0, len(points)*2)
+	for _, p := range points { // нижняя часть оболочки
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(points) - 2; i >= 0; i-- { // верхняя часть оболочки
+		p := points[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	return hull[:len(hull)-1]
+}
+
+// byLonLat используется для сортировки точек по долготе, а затем по широте.
+type byLonLat []Point
+
+func (p byLonLat) Len() int      { return len(p) }
+func (p byLonLat) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byLonLat) Less(i, j int) bool {
+	if p[i][0] != p[j][0] {
+		return p[i][0] < p[j][0]
+	}
+	return p[i][1] < p[j][1]
+}
@@ -0,0 +1,34 @@
+package geo
+
+import "testing"
+
+func TestCorridor(t *testing.T) {
+	corridor := Corridor{
+		Line: LineString{
+			NewPoint(37.60, 55.70), NewPoint(37.61, 55.70), NewPoint(37.61, 55.71)},
+		Width: 50,
+	}
+	onRoute := NewPoint(37.61, 55.70).Move(30, 10)
+	if !corridor.Contains(onRoute) {
+		t.Error("point must be on route")
+	}
+	offRoute := NewPoint(37.60, 55.71)
+	if corridor.Contains(offRoute) {
+		t.Error("point must be off route")
+	}
+	if d := corridor.Distance(offRoute); d < 500 {
+		t.Errorf("bad distance to corridor: %v", d)
+	}
+	// полигон должен содержать все точки коридора
+	polygon := corridor.Polygon()
+	for _, point := range []Point{
+		onRoute,
+		NewPoint(37.60, 55.70).Move(45, 180),
+		NewPoint(37.61, 55.71).Move(45, 0),
+		NewPoint(37.605, 55.70).Move(45, 0),
+	} {
+		if !polygon.Contains(point) {
+			t.Errorf("polygon must contain point %v", point)
+		}
+	}
+}
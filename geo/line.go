@@ -0,0 +1,37 @@
+package geo
+
+import "math"
+
+// LineString описывает ломаную линию.
+type LineString []Point
+
+// Geo возвращает описание линии в формате GeoJSON.
+func (l LineString) Geo() interface{} {
+	if len(l) < 2 {
+		return nil
+	}
+	return struct {
+		Type        string
+		Coordinates LineString
+	}{
+		Type:        "LineString",
+		Coordinates: l,
+	}
+}
+
+// Distance возвращает расстояние в метрах от точки до ближайшего отрезка линии.
+func (l LineString) Distance(point Point) float64 {
+	switch len(l) {
+	case 0:
+		return math.Inf(1)
+	case 1:
+		return l[0].Distance(point)
+	}
+	dist := math.Inf(1)
+	for i := 1; i < len(l); i++ {
+		if d := segmentDistance(point, l[i-1], l[i]); d < dist {
+			dist = d
+		}
+	}
+	return dist
+}
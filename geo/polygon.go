@@ -1,5 +1,7 @@
 package geo
 
+import "math"
+
 // Polygon описывает полигон.
 type Polygon [][]Point
 
@@ -29,3 +31,73 @@ func (p Polygon) Geo() interface{} {
 		Coordinates: p,
 	}
 }
+
+// Contains возвращает true, если точка находится внутри полигона.
+// Первый контур полигона считается внешним, остальные — изъятиями (дырами) в нем.
+func (p Polygon) Contains(point Point) bool {
+	if len(p) == 0 || !ringContains(p[0], point) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if ringContains(hole, point) {
+			return false
+		}
+	}
+	return true
+}
+
+// Distance возвращает расстояние в метрах от точки до ближайшей границы полигона.
+// Если точка находится внутри полигона, то возвращается 0.
+func (p Polygon) Distance(point Point) float64 {
+	if len(p) == 0 {
+		return math.Inf(1)
+	}
+	if p.Contains(point) {
+		return 0
+	}
+	dist := math.Inf(1)
+	for _, ring := range p {
+		for i := 1; i < len(ring); i++ {
+			if d := segmentDistance(point, ring[i-1], ring[i]); d < dist {
+				dist = d
+			}
+		}
+	}
+	return dist
+}
+
+// ringContains проверяет вхождение точки в замкнутый контур методом трассировки луча.
+func ringContains(ring []Point, point Point) bool {
+	var inside bool
+	x, y := point.Longitude(), point.Latitude()
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i].Longitude(), ring[i].Latitude()
+		xj, yj := ring[j].Longitude(), ring[j].Latitude()
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// segmentDistance возвращает расстояние в метрах от точки до отрезка.
+// Для вычисления используется локальная равнопромежуточная проекция с центром в указанной
+// точке, что дает достаточную точность на расстояниях в десятки километров.
+func segmentDistance(point, a, b Point) float64 {
+	ax, ay := project(point, a)
+	bx, by := project(point, b)
+	dx, dy := bx-ax, by-ay
+	var t float64
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+// project возвращает координаты точки в метрах относительно центра проекции.
+func project(center, point Point) (x, y float64) {
+	x = (point.Longitude() - center.Longitude()) * math.Pi / 180.0 *
+		math.Cos(center.Latitude()*math.Pi/180.0) * EarthRadius
+	y = (point.Latitude() - center.Latitude()) * math.Pi / 180.0 * EarthRadius
+	return
+}
@@ -0,0 +1,38 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPolygonDistance(t *testing.T) {
+	polygon := NewPolygon(
+		NewPoint(37.60, 55.70), NewPoint(37.62, 55.70),
+		NewPoint(37.62, 55.72), NewPoint(37.60, 55.72))
+	inside := NewPoint(37.61, 55.71)
+	if !polygon.Contains(inside) {
+		t.Error("point must be inside polygon")
+	}
+	if d := polygon.Distance(inside); d != 0 {
+		t.Errorf("distance inside polygon: %v", d)
+	}
+	outside := NewPoint(37.61, 55.73)
+	if polygon.Contains(outside) {
+		t.Error("point must be outside polygon")
+	}
+	// до северной границы полигона ровно 0.01 градуса по широте
+	expected := NewPoint(37.61, 55.72).Distance(outside)
+	if d := polygon.Distance(outside); math.Abs(d-expected) > 1 {
+		t.Errorf("distance outside polygon: %v, expected %v", d, expected)
+	}
+	// полигон с дырой
+	polygon = append(polygon, NewPolygon(
+		NewPoint(37.605, 55.705), NewPoint(37.615, 55.705),
+		NewPoint(37.615, 55.715), NewPoint(37.605, 55.715))[0])
+	if polygon.Contains(inside) {
+		t.Error("point must be inside hole")
+	}
+	if d := polygon.Distance(inside); d == 0 {
+		t.Error("distance inside hole must not be zero")
+	}
+}
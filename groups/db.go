@@ -0,0 +1,101 @@
+package groups
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mdigger/geotrack/mongo"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CollectionName описывает название коллекции с описаниями групп пользователей.
+var CollectionName = "groups"
+
+// Group описывает группу пользователей.
+type Group struct {
+	ID       string                 `bson:"_id"`                          // уникальный идентификатор группы (UUID)
+	Name     string                 `bson:",omitempty" json:",omitempty"` // название группы
+	Owner    bson.ObjectId          // владелец группы
+	Settings map[string]interface{} `bson:",omitempty" json:",omitempty"` // настройки группы
+	Created  time.Time              // время создания
+}
+
+var (
+	// ErrNotFound возвращается, если описание группы не найдено.
+	ErrNotFound = errors.New("group not found")
+	// ErrBadSettings возвращается, если название настройки содержит недопустимые символы.
+	ErrBadSettings = errors.New("bad group settings name")
+)
+
+// DB описывает хранилище описаний групп пользователей.
+type DB struct {
+	*mongo.DB // соединение с MongoDB
+}
+
+// InitDB инициализирует хранилище описаний групп пользователей.
+func InitDB(mdb *mongo.DB) (db *DB, err error) {
+	db = &DB{mdb}
+	coll := mdb.GetCollection(CollectionName)
+	err = coll.EnsureIndexKey("owner")
+	mdb.FreeCollection(coll)
+	return
+}
+
+// checkSettings проверяет, что названия настроек могут быть сохранены в MongoDB.
+func checkSettings(settings map[string]interface{}) error {
+	for name := range settings {
+		if name == "" || strings.ContainsAny(name, ".$") {
+			return ErrBadSettings
+		}
+	}
+	return nil
+}
+
+// Create сохраняет описание новой группы.
+func (db *DB) Create(group *Group) (err error) {
+	if err = checkSettings(group.Settings); err != nil {
+		return
+	}
+	if group.Created.IsZero() {
+		group.Created = time.Now()
+	}
+	coll := db.GetCollection(CollectionName)
+	err = coll.Insert(group)
+	db.FreeCollection(coll)
+	return
+}
+
+// Get возвращает описание группы.
+func (db *DB) Get(groupID string) (group *Group, err error) {
+	coll := db.GetCollection(CollectionName)
+	group = new(Group)
+	err = coll.FindId(groupID).One(group)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Update изменяет название и настройки группы. Настройки заменяются целиком.
+func (db *DB) Update(group *Group) (err error) {
+	if err = checkSettings(group.Settings); err != nil {
+		return
+	}
+	update := bson.M{"$set": bson.M{"name": group.Name, "settings": group.Settings}}
+	if group.Settings == nil {
+		update = bson.M{
+			"$set":   bson.M{"name": group.Name},
+			"$unset": bson.M{"settings": ""},
+		}
+	}
+	coll := db.GetCollection(CollectionName)
+	err = coll.UpdateId(group.ID, update)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrNotFound
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package groups
+
+import (
+	"log"
+	"testing"
+
+	"github.com/mdigger/geotrack/mongo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestDB(t *testing.T) {
+	mdb, err := mongo.Connect("mongodb://localhost/watch")
+	if err != nil {
+		log.Println("Error connecting to MongoDB:", err)
+		return
+	}
+	defer mdb.Close()
+
+	db, err := InitDB(mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := &Group{
+		ID:    "test-group-" + bson.NewObjectId().Hex(),
+		Name:  "Test",
+		Owner: bson.NewObjectId(),
+	}
+	if err := db.Create(group); err != nil {
+		t.Fatal(err)
+	}
+	coll := mdb.GetCollection(CollectionName)
+	defer mdb.FreeCollection(coll)
+	defer coll.RemoveId(group.ID)
+
+	group.Name = "Renamed"
+	group.Settings = map[string]interface{}{"units": "metric"}
+	if err := db.Update(group); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := db.Get(group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Name != "Renamed" || saved.Settings["units"] != "metric" || saved.Owner != group.Owner {
+		t.Errorf("bad group: %+v", saved)
+	}
+	group.Settings = map[string]interface{}{"bad.name": 1}
+	if err := db.Update(group); err != ErrBadSettings {
+		t.Error("bad settings name accepted")
+	}
+}
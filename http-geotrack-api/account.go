@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/groups"
+	"github.com/mdigger/geotrack/mail"
+	"github.com/mdigger/geotrack/users"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var mailer mail.Mailer // отправка почтовых сообщений
+
+// postSignup регистрирует нового пользователя. Если в запросе указан код приглашения,
+// то пользователь добавляется в группу, в которую был приглашен, иначе для него создается
+// новая группа.
+func postSignup(c *echo.Context) error {
+	var data struct {
+		Login    string
+		Password string
+		Name     string
+		Email    string
+		Icon     byte
+		Invite   string
+		Group    string // название новой группы
+	}
+	if err := c.Bind(&data); err != nil || data.Login == "" {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+	user := &users.User{
+		Login: data.Login,
+		Name:  data.Name,
+		Email: data.Email,
+		Icon:  data.Icon,
+	}
+	err := usersDB.Register(user, data.Password, data.Invite)
+	switch err {
+	case nil:
+	case users.ErrWeakPassword:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case users.ErrBadToken:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case users.ErrLoginExists:
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	// пользователь без приглашения становится владельцем новой группы
+	if data.Invite == "" {
+		err = groupsDB.Create(&groups.Group{
+			ID:    user.GroupID,
+			Name:  data.Group,
+			Owner: user.ID,
+		})
+		if err != nil {
+			llog.Error("groupsDB error: %v", err)
+			// без описания группы пользователь не может работать: удаляем его, чтобы
+			// логин можно было зарегистрировать повторно
+			if err := usersDB.Remove(user.GroupID, user.ID); err != nil {
+				llog.Error("usersDB error: %v", err)
+			}
+			return err
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"ID":      user.ID.Hex(),
+		"GroupID": user.GroupID,
+	})
+}
+
+// putPassword изменяет пароль текущего пользователя. Для изменения необходимо указать
+// текущий пароль.
+func putPassword(c *echo.Context) error {
+	userID := c.Get("ID").(bson.ObjectId)
+	var data struct {
+		Password    string // текущий пароль
+		NewPassword string // новый пароль
+	}
+	if err := c.Bind(&data); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+	user, err := usersDB.GetByID(userID)
+	if err == mgo.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword(user.Password, []byte(data.Password)); err != nil {
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	err = usersDB.SetPassword(userID, data.NewPassword)
+	if err == users.ErrWeakPassword {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	// после смены пароля все сеансы пользователя завершаются
+	if err := tokenEngine.LogoutAll(userID.Hex()); err != nil {
+		llog.Error("tokenEngine error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// postPasswordForgot отправляет пользователю письмо с токеном для восстановления пароля.
+// Чтобы нельзя было проверить, зарегистрирован ли пользователь, ответ всегда одинаковый.
+func postPasswordForgot(c *echo.Context) error {
+	var data struct {
+		Login string // логин или адрес электронной почты
+	}
+	if err := c.Bind(&data); err != nil || data.Login == "" {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+	user, err := usersDB.FindByEmail(data.Login)
+	if err == mgo.ErrNotFound {
+		llog.Debug("Password reset for unknown user: %v", data.Login)
+		return c.NoContent(http.StatusNoContent)
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	// код отправляется только на подтвержденный адрес
+	if user.Email == "" || !user.EmailVerified {
+		llog.Debug("Password reset for user without verified email: %v", data.Login)
+		return c.NoContent(http.StatusNoContent)
+	}
+	token, err := usersDB.CreateResetToken(user.ID)
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	err = mailer.Send(&mail.Message{
+		To:      user.Email,
+		Subject: "Восстановление пароля",
+		Body: fmt.Sprintf("Для установки нового пароля пользователя %s используйте код:\n\n%s\n\n"+
+			"Код действителен в течение %v. Если вы не запрашивали восстановление пароля, "+
+			"просто проигнорируйте это письмо.\n", user.Login, token, users.ResetExpired),
+	})
+	if err != nil {
+		llog.Error("mailer error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// postPasswordReset устанавливает новый пароль пользователя по токену восстановления.
+func postPasswordReset(c *echo.Context) error {
+	var data struct {
+		Token    string // токен восстановления пароля
+		Password string // новый пароль
+	}
+	if err := c.Bind(&data); err != nil || data.Token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+	userID, err := usersDB.ResetPassword(data.Token, data.Password)
+	switch err {
+	case nil:
+	case users.ErrWeakPassword:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case users.ErrBadToken:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	default:
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	// после восстановления пароля все сеансы пользователя завершаются
+	if err := tokenEngine.LogoutAll(userID.Hex()); err != nil {
+		llog.Error("tokenEngine error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// postEmailVerify отправляет на адрес электронной почты текущего пользователя письмо с кодом
+// для его подтверждения.
+func postEmailVerify(c *echo.Context) error {
+	user, err := usersDB.GetByID(c.Get("ID").(bson.ObjectId))
+	if err == mgo.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	if user.Email == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "email is not set")
+	}
+	token, err := usersDB.CreateVerifyToken(user.ID, user.Email)
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	err = mailer.Send(&mail.Message{
+		To:      user.Email,
+		Subject: "Подтверждение адреса электронной почты",
+		Body: fmt.Sprintf("Для подтверждения адреса электронной почты пользователя %s используйте код:\n\n%s\n\n"+
+			"Код действителен в течение %v. Если вы не указывали этот адрес, "+
+			"просто проигнорируйте это письмо.\n", user.Login, token, users.VerifyExpired),
+	})
+	if err != nil {
+		llog.Error("mailer error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// postEmailConfirm подтверждает адрес электронной почты пользователя по коду из письма.
+func postEmailConfirm(c *echo.Context) error {
+	var data struct {
+		Token string // код подтверждения
+	}
+	if err := c.Bind(&data); err != nil || data.Token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+	err := usersDB.VerifyEmail(data.Token)
+	switch err {
+	case nil:
+		return c.NoContent(http.StatusNoContent)
+	case users.ErrBadToken:
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	default:
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/alerts"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// getAlertRules отдает список правил уведомлений группы.
+func getAlertRules(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	rules, err := alertsDB.GetRules(groupID)
+	if err != nil {
+		llog.Error("alertsDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+// postAlertRule добавляет новое правило уведомлений.
+func postAlertRule(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	var rule alerts.Rule // описание правила
+	if err := c.Bind(&rule); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	rule.ID = ""
+	rule.GroupID = groupID
+	err := alertsDB.SaveRule(&rule)
+	if err == alerts.ErrBadRule {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		llog.Error("alertsDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusCreated, map[string]interface{}{"ID": rule.ID.Hex()})
+}
+
+// putAlertRule изменяет уже существующее правило уведомлений.
+func putAlertRule(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	ruleID := c.Param("rule-id")
+	if _, err := alertsDB.GetRule(groupID, ruleID); err == alerts.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	} else if err != nil {
+		llog.Error("alertsDB error: %v", err)
+		return err
+	}
+	var rule alerts.Rule // описание правила
+	if err := c.Bind(&rule); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	rule.ID = bson.ObjectIdHex(ruleID)
+	rule.GroupID = groupID
+	err := alertsDB.SaveRule(&rule)
+	if err == alerts.ErrBadRule {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		llog.Error("alertsDB error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// deleteAlertRule удаляет правило уведомлений.
+func deleteAlertRule(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	err := alertsDB.DeleteRule(groupID, c.Param("rule-id"))
+	if err == alerts.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("alertsDB error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// getAlerts отдает список уведомлений группы, начиная с самых свежих. Параметр state
+// позволяет выбрать уведомления только в указанном состоянии.
+func getAlerts(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	state := c.Query("state")
+	switch state {
+	case "", alerts.StateOpen, alerts.StateAcknowledged, alerts.StateResolved:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "bad alert state")
+	}
+	limit, err := strconv.ParseUint(c.Query("limit"), 10, 16)
+	if err != nil || limit < 1 {
+		limit = listLimit
+	}
+	list, err := alertsDB.Get(groupID, state, int(limit))
+	if err != nil {
+		llog.Error("alertsDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// postAlertAck отмечает уведомление как просмотренное.
+func postAlertAck(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	userID := c.Get("ID").(bson.ObjectId).Hex()
+	err := alertsDB.Acknowledge(groupID, c.Param("alert-id"), userID)
+	if err == alerts.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("alertsDB error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// postAlertResolve отмечает уведомление как решенное.
+func postAlertResolve(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	userID := c.Get("ID").(bson.ObjectId).Hex()
+	err := alertsDB.Resolve(groupID, c.Param("alert-id"), userID)
+	if err == alerts.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("alertsDB error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/battery"
+)
+
+// batteryPeriod задает период по умолчанию для анализа уровня заряда устройства.
+const batteryPeriod = 7 * 24 * time.Hour
+
+// getBattery отдает отчет об уровне заряда батареи устройства за период, заданный
+// параметрами from и to в формате RFC 3339 (по умолчанию — последняя неделя): кривую
+// изменения заряда, сеансы зарядки, скорость разряда и прогноз оставшегося времени работы.
+// Параметр low задает низкий уровень заряда в процентах для прогноза.
+func getBattery(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	deviceID := c.Param("device-id")
+	from, to, err := timeRange(c, batteryPeriod)
+	if err != nil {
+		return err
+	}
+	opts := battery.DefaultOptions
+	if value := c.Query("low"); value != "" {
+		low, err := strconv.ParseUint(value, 10, 8)
+		if err != nil || low > 100 {
+			return echo.NewHTTPError(http.StatusBadRequest, "bad low level")
+		}
+		opts.LowLevel = uint8(low)
+	}
+	tracks, err := tracksDB.GetRange(groupID, deviceID, from, to)
+	if err != nil {
+		llog.Error("tracksDB error: %v", err)
+		return err
+	}
+	report := battery.Analyze(tracks, opts)
+	if report == nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	return c.JSON(http.StatusOK, report)
+}
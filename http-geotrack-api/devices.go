@@ -2,10 +2,14 @@ package main
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/devices"
+	"github.com/mdigger/geotrack/pairing"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 const (
@@ -14,47 +18,272 @@ const (
 )
 
 // getDevices отдает список зарегистрированных устройств, которые относятся к той же
-// группе, что и текущий пользователь.
+// группе, что и текущий пользователь. Устройства, по которым есть данные трекинга, но
+// которые не были зарегистрированы, тоже попадают в список.
 func getDevices(c *echo.Context) error {
-	// TODO: возвращать все устройства, а не только те, треки по которым сохранились
 	groupID := c.Get("GroupID").(string)
+	list, err := devicesDB.GetAll(groupID)
+	if err != nil {
+		llog.Error("devicesDB error: %v", err)
+		return err
+	}
 	deviceIDs, err := tracksDB.GetDevicesID(groupID)
-	if err == mgo.ErrNotFound {
+	if err != nil {
+		llog.Error("tracksDB error: %v", err)
+		return err
+	}
+	registered := make(map[string]bool, len(list))
+	for _, device := range list {
+		registered[device.ID] = true
+	}
+	for _, deviceID := range deviceIDs {
+		if !registered[deviceID] {
+			list = append(list, devices.Device{ID: deviceID})
+		}
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// getDevice отдает описание зарегистрированного устройства.
+func getDevice(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	device, err := devicesDB.Get(groupID, c.Param("device-id"))
+	if err == devices.ErrNotFound {
 		return echo.NewHTTPError(http.StatusNotFound)
 	}
 	if err != nil {
-		llog.Error("tracksDB error: %v", err)
+		llog.Error("devicesDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, device)
+}
+
+// putDevice изменяет описание зарегистрированного устройства.
+func putDevice(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	var device devices.Device // описание устройства
+	if err := c.Bind(&device); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	device.ID = c.Param("device-id")
+	device.GroupID = groupID
+	err := devicesDB.Update(&device)
+	if err == devices.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if mgo.IsDup(err) {
+		return echo.NewHTTPError(http.StatusConflict, "IMEI is already registered")
+	}
+	if err == devices.ErrIMEIConflict {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		llog.Error("devicesDB error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// deleteDevice удаляет устройство из группы.
+func deleteDevice(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	err := devicesDB.Delete(groupID, c.Param("device-id"))
+	if err == devices.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("devicesDB error: %v", err)
 		return err
 	}
-	return c.JSON(http.StatusOK, deviceIDs)
+	return c.NoContent(http.StatusOK)
 }
 
+// postDevicePairing связывает устройство с группой текущего пользователя по ключу,
+// полученному устройством, и регистрирует устройство. Если в запросе указан идентификатор
+// устройства, то он должен соответствовать ключу. Устройство, зарегистрированное в другой
+// группе, переносится только при явном указании Transfer в запросе.
 func postDevicePairing(c *echo.Context) error {
 	groupID := c.Get("GroupID").(string)
 	deviceID := c.Param("device-id")
-	_, _ = groupID, deviceID
 	var pairingKey struct {
-		Key string
+		Key      string
+		Transfer bool
 	}
 	err := c.Bind(&pairingKey) // читаем ключ из запроса
 	if err != nil || len(pairingKey.Key) < 4 {
 		return echo.NewHTTPError(http.StatusBadRequest)
 	}
-	var deviceIDResp string
-	err = nce.Request(serviceNamePairingKey, pairingKey.Key, &deviceIDResp, natsRequestTimeout)
+	userID := c.Get("ID").(bson.ObjectId)
+	// неудачные попытки учитываются для каждого пользователя
+	request := struct {
+		Key    string
+		Caller string
+	}{
+		Key:    pairingKey.Key,
+		Caller: userID.Hex(),
+	}
+	var response struct {
+		DeviceID string
+		Error    string
+	}
+	err = nce.Request(serviceNamePairingKey, request, &response, natsRequestTimeout)
 	if err != nil {
 		llog.Error("NATS Pairing Key response error: %v", err)
 		return err
 	}
+	if response.Error == pairing.ErrLocked.Error() {
+		// блокировка снимается не позже, чем через период учета неудачных попыток
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(pairing.AttemptsWindow.Seconds())))
+		return echo.NewHTTPError(http.StatusTooManyRequests, response.Error)
+	}
+	if response.Error != "" {
+		llog.Error("NATS Pairing Key error: %v", response.Error)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
+	deviceIDResp := response.DeviceID
 	if deviceIDResp == "" {
 		return echo.NewHTTPError(http.StatusNotFound)
 	}
-	if deviceIDResp == deviceID {
-		// TODO: реально связать в базе
-		return echo.NewHTTPError(http.StatusOK)
+	if deviceID != "" && deviceIDResp != deviceID {
+		return echo.NewHTTPError(http.StatusBadRequest)
 	}
-	if deviceID == "" {
-		return c.JSON(http.StatusOK, map[string]string{"ID": deviceIDResp})
+	var device *devices.Device
+	if pairingKey.Transfer {
+		device, err = devicesDB.Transfer(groupID, deviceIDResp, userID)
+	} else {
+		device, err = devicesDB.Pair(groupID, deviceIDResp, userID)
+	}
+	if err == devices.ErrPaired {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		llog.Error("devicesDB error: %v", err)
+		return err
+	}
+	// выдаем устройству токен для передачи данных: ранее выданные токены перестают действовать
+	deviceToken, err := newDeviceToken(groupID, device.ID)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("Location", "/api/v1/devices/"+device.ID)
+	return c.JSON(http.StatusOK, map[string]string{
+		"ID":    device.ID,
+		"Token": deviceToken,
+	})
+}
+
+// newDeviceToken выдает устройству группы новый токен для передачи данных и сохраняет его
+// идентификатор как действующий.
+func newDeviceToken(groupID, deviceID string) (string, error) {
+	deviceToken, tokenID, err := tokenEngine.DeviceToken(groupID, deviceID)
+	if err != nil {
+		llog.Error("tokenEngine error: %v", err)
+		return "", err
+	}
+	if err := devicesDB.SetToken(groupID, deviceID, tokenID); err != nil {
+		llog.Error("devicesDB error: %v", err)
+		return "", err
+	}
+	return deviceToken, nil
+}
+
+// postDeviceToken выдает устройству группы новый токен для передачи данных. Ранее выданный
+// токен перестает действовать.
+func postDeviceToken(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	deviceID := c.Param("device-id")
+	_, err := devicesDB.Get(groupID, deviceID)
+	if err == devices.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("devicesDB error: %v", err)
+		return err
+	}
+	deviceToken, err := newDeviceToken(groupID, deviceID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]string{"Token": deviceToken})
+}
+
+// deleteDeviceToken отзывает токен устройства группы.
+func deleteDeviceToken(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	err := devicesDB.SetToken(groupID, c.Param("device-id"), "")
+	if err == devices.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("devicesDB error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// getDeviceState отдает текущее состояние устройства: последние координаты, уровень заряда,
+// последние значения сенсоров и признак нахождения на связи.
+func getDeviceState(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	deviceID := c.Param("device-id")
+	state, err := statesDB.Get(groupID, deviceID)
+	if err == mgo.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("statesDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, state)
+}
+
+// getDeviceStates отдает текущее состояние всех устройств группы.
+func getDeviceStates(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	list, err := statesDB.GetAll(groupID)
+	if err != nil {
+		llog.Error("statesDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// putDeviceTimeout задает время в минутах с момента получения последних данных от устройства,
+// после которого устройство считается отключенным. Нулевое значение восстанавливает значение
+// по умолчанию.
+func putDeviceTimeout(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	deviceID := c.Param("device-id")
+	var timeout struct {
+		Minutes int
+	}
+	if err := c.Bind(&timeout); err != nil || timeout.Minutes < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+	err := statesDB.SetTimeout(groupID, deviceID, time.Duration(timeout.Minutes)*time.Minute)
+	if err != nil {
+		llog.Error("statesDB error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// gapsPeriod задает период по умолчанию для отчета об отсутствии связи с устройством.
+const gapsPeriod = 7 * 24 * time.Hour
+
+// getDeviceGaps отдает список интервалов отсутствия связи с устройством за период,
+// заданный параметрами from и to в формате RFC 3339 (по умолчанию — последняя неделя).
+func getDeviceGaps(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	deviceID := c.Param("device-id")
+	from, to, err := timeRange(c, gapsPeriod)
+	if err != nil {
+		return err
+	}
+	gaps, err := statesDB.Gaps(groupID, deviceID, from, to)
+	if err != nil {
+		llog.Error("statesDB error: %v", err)
+		return err
 	}
-	return echo.NewHTTPError(http.StatusBadRequest)
+	return c.JSON(http.StatusOK, gaps)
 }
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/groups"
+	"github.com/mdigger/geotrack/users"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// inviteURL задает шаблон ссылки на приглашение: %s заменяется на код приглашения.
+var inviteURL string
+
+// getGroup отдает описание группы текущего пользователя.
+func getGroup(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	group, err := groupsDB.Get(groupID)
+	if err == groups.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("groupsDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, group)
+}
+
+// putGroup изменяет название и настройки группы текущего пользователя.
+func putGroup(c *echo.Context) error {
+	group := new(groups.Group)
+	if err := c.Bind(group); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+	group.ID = c.Get("GroupID").(string)
+	err := groupsDB.Update(group)
+	switch err {
+	case nil:
+		return c.NoContent(http.StatusNoContent)
+	case groups.ErrBadSettings:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case groups.ErrNotFound:
+		return echo.NewHTTPError(http.StatusNotFound)
+	default:
+		llog.Error("groupsDB error: %v", err)
+		return err
+	}
+}
+
+// invite описывает приглашение в группу вместе со ссылкой на него.
+type invite struct {
+	*users.Invite
+	Link string `json:",omitempty"` // ссылка на приглашение
+}
+
+// newInvite возвращает приглашение со ссылкой, если задан ее шаблон.
+func newInvite(info *users.Invite) invite {
+	result := invite{Invite: info}
+	if inviteURL != "" {
+		result.Link = fmt.Sprintf(inviteURL, info.Code)
+	}
+	return result
+}
+
+// postInvite создает приглашение для регистрации нового пользователя в группе текущего
+// пользователя. Роль приглашенного пользователя должна быть ниже роли текущего.
+func postInvite(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	userID := c.Get("ID").(bson.ObjectId)
+	var data struct {
+		Role string // роль приглашенного пользователя
+	}
+	if c.Request().ContentLength > 0 {
+		if err := c.Bind(&data); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest)
+		}
+	}
+	if data.Role == "" {
+		data.Role = users.RoleMember
+	}
+	if !users.CanManage(c.Get("Role").(string), data.Role) {
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	info, err := usersDB.CreateInvite(groupID, userID, data.Role)
+	if err == users.ErrBadRole {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, newInvite(info))
+}
+
+// getInvites отдает список действующих приглашений в группу текущего пользователя.
+func getInvites(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	list, err := usersDB.GetInvites(groupID)
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	result := make([]invite, len(list))
+	for i, info := range list {
+		result[i] = newInvite(info)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// deleteInvite отзывает приглашение в группу.
+func deleteInvite(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	err := usersDB.RevokeInvite(groupID, c.Param("code"))
+	if err == users.ErrBadToken {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// memberID возвращает идентификатор пользователя группы, указанного в запросе, и проверяет,
+// что текущий пользователь может им управлять.
+func memberID(c *echo.Context) (userID bson.ObjectId, err error) {
+	groupID := c.Get("GroupID").(string)
+	userIDStr := c.Param("user-id")
+	if !bson.IsObjectIdHex(userIDStr) {
+		return "", echo.NewHTTPError(http.StatusNotFound)
+	}
+	userID = bson.ObjectIdHex(userIDStr)
+	role, err := usersDB.GetRole(groupID, userID)
+	if err == mgo.ErrNotFound {
+		return "", echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return "", err
+	}
+	if !users.CanManage(c.Get("Role").(string), role) {
+		return "", echo.NewHTTPError(http.StatusForbidden)
+	}
+	return userID, nil
+}
+
+// putUserRole изменяет роль пользователя группы. Назначать можно только роли ниже своей
+// и только пользователям, чья роль ниже своей.
+func putUserRole(c *echo.Context) error {
+	var data struct {
+		Role string // новая роль пользователя
+	}
+	if err := c.Bind(&data); err != nil || !users.ValidRole(data.Role) {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+	userID, err := memberID(c)
+	if err != nil {
+		return err
+	}
+	if !users.CanManage(c.Get("Role").(string), data.Role) {
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	groupID := c.Get("GroupID").(string)
+	err = usersDB.SetRole(groupID, userID, data.Role)
+	if err == mgo.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// deleteUser удаляет пользователя из группы. Удалить владельца группы нельзя.
+func deleteUser(c *echo.Context) error {
+	userID, err := memberID(c)
+	if err != nil {
+		return err
+	}
+	groupID := c.Get("GroupID").(string)
+	err = usersDB.Remove(groupID, userID)
+	if err == mgo.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
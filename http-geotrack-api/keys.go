@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/rand"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/token"
+)
+
+// loadKeys загружает ключи для подписи токенов из файла или каталога. Если путь не указан,
+// то используется ключ из переменной окружения JWT_SECRET: закрытый ключ в формате PEM или
+// секретный ключ HS256 с префиксом token.SecretPrefix. Если не задан и он, то используется
+// новый случайный ключ: в этом случае после перезапуска сервера все выданные токены
+// перестают действовать.
+func loadKeys(path string) (*token.KeySet, error) {
+	if path != "" {
+		keys, err := token.LoadKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		llog.Info("JWT signing key: %v (%v)", keys.Current().ID, keys.Current().Method.Alg())
+		return keys, nil
+	}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		key, err := token.ParseKey("default", []byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		llog.Info("JWT signing key: %v (%v)", key.ID, key.Method.Alg())
+		return token.NewKeySet(key)
+	}
+	llog.Warn("JWT signing key is not set: tokens will be invalid after restart")
+	secret := make([]byte, 256)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return token.NewKeySet(token.NewHMACKey("default", secret))
+}
+
+// getJWKS отдает открытые ключи для проверки подписи токенов в формате JSON Web Key Set.
+func getJWKS(c *echo.Context) error {
+	return c.JSON(http.StatusOK, tokenEngine.Keys().JWKS())
+}
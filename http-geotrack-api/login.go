@@ -1,41 +1,133 @@
 package main
 
 import (
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/devices"
+	"github.com/mdigger/geotrack/policy"
+	"github.com/mdigger/geotrack/token"
+	"github.com/mdigger/geotrack/users"
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
-// login читает заголовок запроса с HTTP Basic авторизацией, проверяет пользователя
-// по базе данных и отдает в ответ авторизационный ключ в формате JWT.
-func login(c *echo.Context) error {
+// checkLogin читает заголовок запроса с HTTP Basic авторизацией и проверяет пользователя
+// по базе данных. В случае ошибки авторизации возвращается ошибка HTTP. Все попытки
+// авторизации сохраняются в журнале, а после неудачных попыток следующая попытка
+// возможна только через некоторое время: до этого возвращается код 429.
+func checkLogin(c *echo.Context) (*users.User, error) {
 	// получаем пароль из заголовка HTTP Basic авторизации
 	username, password, ok := c.Request().BasicAuth()
 	if !ok {
 		c.Response().Header().Set(echo.WWWAuthenticate, "Basic realm=Restricted")
-		return echo.NewHTTPError(http.StatusUnauthorized)
+		return nil, echo.NewHTTPError(http.StatusUnauthorized)
+	}
+	ip := clientIP(c.Request())
+	// проверяем, не заблокирована ли авторизация после неудачных попыток
+	wait, err := usersDB.LoginRetryAfter(username, ip)
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return nil, err
+	}
+	if wait > 0 {
+		logLogin(username, ip, users.ReasonLocked)
+		llog.Warn("Login %q from %v locked for %v", username, ip, wait)
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		return nil, echo.NewHTTPError(http.StatusTooManyRequests)
 	}
 	// получаем из хранилища информацию о пользователе
 	user, err := usersDB.Get(username)
 	if err == mgo.ErrNotFound {
-		return echo.NewHTTPError(http.StatusForbidden)
+		logLogin(username, ip, users.ReasonUnknownLogin)
+		return nil, echo.NewHTTPError(http.StatusForbidden)
 	}
 	if err != nil {
 		llog.Error("userDB error: %v", err)
-		return err
+		return nil, err
 	}
 	// сравниваем сохраненный пароль с тем, что указали в заголовке
 	if err := bcrypt.CompareHashAndPassword(user.Password, []byte(password)); err != nil {
-		return echo.NewHTTPError(http.StatusForbidden)
+		logLogin(username, ip, users.ReasonBadPassword)
+		return nil, echo.NewHTTPError(http.StatusForbidden)
 	}
-	// генерируем JWT-токен
-	tokenString, err := tokenEngine.Token(map[string]interface{}{
+	logLogin(username, ip, "")
+	// пересчитываем хеш пароля, если он был создан с меньшей сложностью
+	if users.NeedRehash(user.Password) {
+		if err := usersDB.SetPassword(user.ID, password); err != nil {
+			llog.Warn("Password rehash error: %v", err)
+		}
+	}
+	return user, nil
+}
+
+// logLogin сохраняет попытку авторизации в журнале. Если причина неудачи не указана, то
+// авторизация считается успешной.
+func logLogin(login, ip, reason string) {
+	err := usersDB.LogLogin(&users.LoginAttempt{
+		Login:   login,
+		IP:      ip,
+		Success: reason == "",
+		Reason:  reason,
+	})
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+	}
+}
+
+var (
+	trustProxy  bool // получать адрес клиента из заголовка X-Forwarded-For
+	trustRealIP bool // получать адрес клиента из заголовка X-Real-IP
+)
+
+// clientIP возвращает адрес, с которого выполнен запрос. Если сервер работает за прокси,
+// то адрес берется из заголовка X-Forwarded-For: используется последний адрес, добавленный
+// самим прокси, а предыдущие адреса передает клиент, и они могут быть подделаны. Заголовок
+// X-Real-IP используется, только если это задано отдельно: прокси, который только
+// дополняет X-Forwarded-For, передает этот заголовок от клиента без изменений.
+func clientIP(req *http.Request) string {
+	if trustRealIP {
+		if ip := req.Header.Get("X-Real-IP"); ip != "" {
+			return ip
+		}
+	}
+	if trustProxy {
+		if list := req.Header["X-Forwarded-For"]; len(list) > 0 {
+			ips := strings.Split(list[len(list)-1], ",")
+			if ip := strings.TrimSpace(ips[len(ips)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// tokenData возвращает данные пользователя для токена.
+func tokenData(user *users.User) map[string]interface{} {
+	return map[string]interface{}{
 		"id":    user.ID.Hex(),
 		"group": user.GroupID,
-	})
+	}
+}
+
+// login читает заголовок запроса с HTTP Basic авторизацией, проверяет пользователя
+// по базе данных и отдает в ответ авторизационный ключ в формате JWT.
+func login(c *echo.Context) error {
+	user, err := checkLogin(c)
+	if err != nil {
+		return err
+	}
+	// генерируем JWT-токен
+	tokenString, err := tokenEngine.Token(tokenData(user))
 	if err != nil {
 		llog.Error("tokenEngine error: %v", err)
 		return err
@@ -61,26 +153,123 @@ func auth(h echo.HandlerFunc) echo.HandlerFunc {
 			llog.Warn("Bad token: %v", err)
 			return echo.NewHTTPError(http.StatusForbidden)
 		}
-		groupID := data["group"].(string)
-		userID := data["id"].(string)
+		if token.IsDevice(data) { // токены устройств допускаются только для передачи данных
+			llog.Debug("Device token is not allowed: %v", data["device"])
+			return echo.NewHTTPError(http.StatusForbidden)
+		}
+		groupID, _ := data["group"].(string)
+		userID, _ := data["id"].(string)
 		if !bson.IsObjectIdHex(userID) {
 			llog.Warn("Bad user Object ID: %v", userID)
 			return echo.NewHTTPError(http.StatusForbidden)
 		}
 		userObjectId := bson.ObjectIdHex(userID)
-		// проверяем, что пользователь есть и входит в эту группу
-		exists, err := usersDB.Check(groupID, userObjectId)
+		// проверяем, что пользователь есть и входит в эту группу, и получаем его роль
+		role, err := usersDB.GetRole(groupID, userObjectId)
+		if err == mgo.ErrNotFound {
+			llog.Debug("Auth not exist: %v (%v)", userID, groupID)
+			return echo.NewHTTPError(http.StatusForbidden)
+		}
 		if err != nil {
 			llog.Error("usersDB error: %v", err)
 			return err
 		}
-		if !exists {
-			llog.Debug("Auth not exist: %v (%v)", userID, groupID)
-			return echo.NewHTTPError(http.StatusForbidden)
-		}
 		c.Set("GroupID", groupID) // сохраняем данные в контексте запроса
 		c.Set("ID", userObjectId)
-		llog.Debug("Auth: %v (%v)", userID, groupID)
+		c.Set("Token", data)
+		c.Set("Role", role)
+		c.Set("Subject", &policy.Subject{GroupID: groupID, Role: role})
+		llog.Debug("Auth: %v (%v, %v)", userID, groupID, role)
 		return h(c) // выполняем основной обработчик
 	}
 }
+
+// requireRole возвращает обработчик, проверяющий, что роль авторизованного пользователя
+// в группе не ниже указанной. Должен использоваться после auth.
+func requireRole(required string) func(echo.HandlerFunc) echo.HandlerFunc {
+	return func(h echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			role, _ := c.Get("Role").(string)
+			if !users.HasRole(role, required) {
+				llog.Debug("Role %q required: %v", required, role)
+				return echo.NewHTTPError(http.StatusForbidden)
+			}
+			return h(c)
+		}
+	}
+}
+
+// deviceAuth является вспомогательной функцией для запросов на передачу данных устройства,
+// разбирающей токен устройства или пользователя. Токен устройства должен быть действующим
+// токеном этого устройства в группе. Токены пользователей проверяются функцией auth.
+func deviceAuth(h echo.HandlerFunc) echo.HandlerFunc {
+	userAuth := auth(h)
+	return func(c *echo.Context) error {
+		data, err := tokenEngine.ParseRequest(c.Request()) // разбираем токен из запроса
+		if err != nil {
+			llog.Warn("Bad token: %v", err)
+			return echo.NewHTTPError(http.StatusForbidden)
+		}
+		if !token.IsDevice(data) {
+			return userAuth(c)
+		}
+		groupID, _ := data["group"].(string)
+		deviceID, _ := data["device"].(string)
+		tokenID, _ := data["jti"].(string)
+		// проверяем, что устройство все еще в группе и токен не был заменен
+		ok, err := devicesDB.CheckToken(groupID, deviceID, tokenID)
+		if err != nil {
+			llog.Error("devicesDB error: %v", err)
+			return err
+		}
+		if !ok {
+			llog.Debug("Device token replaced: %v (%v)", deviceID, groupID)
+			return echo.NewHTTPError(http.StatusForbidden)
+		}
+		scopes, _ := data["scope"].(string)
+		c.Set("GroupID", groupID) // сохраняем данные в контексте запроса
+		c.Set("DeviceID", deviceID)
+		c.Set("Token", data)
+		c.Set("Subject", &policy.Subject{
+			GroupID:  groupID,
+			DeviceID: deviceID,
+			Scopes:   strings.Fields(scopes),
+		})
+		llog.Debug("Device auth: %v (%v)", deviceID, groupID)
+		return h(c)
+	}
+}
+
+// deviceAccess возвращает обработчик, проверяющий по правилам доступа, разрешено ли
+// действие с устройством, указанным в пути запроса. Должен использоваться после auth
+// или deviceAuth.
+func deviceAccess(action policy.Action) func(echo.HandlerFunc) echo.HandlerFunc {
+	return func(h echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			subject, _ := c.Get("Subject").(*policy.Subject)
+			deviceID := c.Param("device-id")
+			device := &policy.Device{ID: deviceID}
+			info, err := devicesDB.Lookup(deviceID)
+			switch err {
+			case nil:
+				if info.ID == deviceID { // Lookup находит устройства и по IMEI
+					device.GroupID = info.GroupID
+				}
+			case devices.ErrNotFound: // устройство не зарегистрировано
+			default:
+				llog.Error("devicesDB error: %v", err)
+				return err
+			}
+			switch err := policy.Check(subject, action, device); err {
+			case nil:
+				return h(c)
+			case policy.ErrNotFound:
+				llog.Debug("Device %v not found for %+v", deviceID, subject)
+				return echo.NewHTTPError(http.StatusNotFound)
+			default:
+				llog.Debug("Device %v %s denied for %+v", deviceID, action, subject)
+				return echo.NewHTTPError(http.StatusForbidden)
+			}
+		}
+	}
+}
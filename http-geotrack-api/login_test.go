@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	req := &http.Request{RemoteAddr: "10.0.0.1:53124", Header: make(http.Header)}
+	req.Header.Add("X-Forwarded-For", "1.2.3.4, 5.6.7.8")
+	req.Header.Add("X-Forwarded-For", "192.0.2.1, 198.51.100.7")
+	req.Header.Set("X-Real-IP", "203.0.113.5") // подделан клиентом
+	defer func() { trustProxy, trustRealIP = false, false }()
+	if ip := clientIP(req); ip != "10.0.0.1" {
+		t.Errorf("proxy headers used: %v", ip)
+	}
+	trustProxy = true
+	// адреса, переданные клиентом, не используются
+	if ip := clientIP(req); ip != "198.51.100.7" {
+		t.Errorf("bad forwarded address: %v", ip)
+	}
+	trustRealIP = true
+	if ip := clientIP(req); ip != "203.0.113.5" {
+		t.Errorf("bad real address: %v", ip)
+	}
+}
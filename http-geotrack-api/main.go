@@ -4,14 +4,19 @@ import (
 	"flag"
 	"log"
 	"os"
-	"time"
 
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
 	logger "github.com/labstack/gommon/log"
+	"github.com/mdigger/geotrack/alerts"
+	"github.com/mdigger/geotrack/devices"
+	"github.com/mdigger/geotrack/groups"
+	"github.com/mdigger/geotrack/mail"
 	"github.com/mdigger/geotrack/mongo"
+	"github.com/mdigger/geotrack/oidc"
 	"github.com/mdigger/geotrack/places"
 	"github.com/mdigger/geotrack/sensors"
+	"github.com/mdigger/geotrack/states"
 	"github.com/mdigger/geotrack/token"
 	"github.com/mdigger/geotrack/tracks"
 	"github.com/mdigger/geotrack/users"
@@ -19,15 +24,19 @@ import (
 )
 
 var (
-	e           *echo.Echo
-	usersDB     *users.DB             // хранилище пользователей
-	placesDB    *places.DB            // хранилище мест
-	tracksDB    *tracks.DB            // хранилище треков
-	sensorsDB   *sensors.DB           // хранилище сенсоров
-	groupID     = users.SampleGroupID // уникальный идентификатор группы
-	tokenEngine *token.Engine         // генератор токенов
-	nce         *nats.EncodedConn     // соединение с NATS
-	llog        *logger.Logger        // вывод информации в лог
+	e               *echo.Echo
+	usersDB         *users.DB         // хранилище пользователей
+	placesDB        *places.DB        // хранилище мест
+	tracksDB        *tracks.DB        // хранилище треков
+	sensorsDB       *sensors.DB       // хранилище сенсоров
+	sensorsRegistry *sensors.Registry // справочник описаний сенсоров
+	alertsDB        *alerts.DB        // хранилище правил и уведомлений
+	statesDB        *states.DB        // хранилище текущего состояния устройств
+	devicesDB       *devices.DB       // хранилище зарегистрированных устройств
+	groupsDB        *groups.DB        // хранилище описаний групп
+	tokenEngine     *token.Engine     // генератор токенов
+	nce             *nats.EncodedConn // соединение с NATS
+	llog            *logger.Logger    // вывод информации в лог
 )
 
 func main() {
@@ -35,6 +44,16 @@ func main() {
 	mongoURL := flag.String("mongodb", "mongodb://localhost/watch", "MongoDB connection URL")
 	natsURL := flag.String("nats", nats.DefaultURL, "NATS connection URL")
 	docker := flag.Bool("docker", false, "for docker")
+	dev := flag.Bool("dev", false, "development mode (allow sample users)")
+	smtpAddr := flag.String("smtp", "", "SMTP server address & port")
+	mailFrom := flag.String("mailfrom", "noreply@xyzrd.com", "sender email address")
+	mailDir := flag.String("maildir", "", "directory for saving emails instead of sending")
+	flag.StringVar(&inviteURL, "inviteurl", "", "invitation link template (%s is replaced with code)")
+	flag.BoolVar(&trustProxy, "proxy", false, "trust X-Forwarded-For header")
+	flag.BoolVar(&trustRealIP, "realip", false, "trust X-Real-IP header set by proxy")
+	flag.DurationVar(&sensors.ReloadInterval, "schemas", sensors.ReloadInterval, "sensor schemas reload interval")
+	jwtKeys := flag.String("jwtkeys", os.Getenv("JWT_KEYS"), "JWT signing key file or directory")
+	oidcConfig := flag.String("oidc", os.Getenv("OIDC_PROVIDERS"), "OpenID Connect providers config file")
 	flag.Parse()
 
 	// Если запускается внутри контейнера
@@ -45,6 +64,17 @@ func main() {
 		mongoURL = &tmp2
 	}
 
+	// инициализируем отправку почты: без указания SMTP-сервера письма сохраняются
+	// в файлы или выводятся в лог
+	switch {
+	case *smtpAddr != "":
+		mailer = &mail.SMTP{Addr: *smtpAddr, From: *mailFrom}
+	case *mailDir != "":
+		mailer = &mail.File{Dir: *mailDir}
+	default:
+		mailer = new(mail.Log)
+	}
+
 	e = echo.New()     // инициализируем HTTP-обработку
 	e.Debug()          // режим отладки
 	e.SetLogPrefix("") // убираем префикс в логе
@@ -74,7 +104,41 @@ func main() {
 		llog.Error("Error initializing SensorsDB: %v", err)
 		return
 	}
-	groupID = usersDB.GetSampleGroupID() // временная инициализация пользователей
+	if sensorsRegistry, err = sensorsDB.LoadRegistry(); err != nil {
+		llog.Error("Error loading sensors registry: %v", err)
+		return
+	}
+	go sensorsDB.Watch(sensorsRegistry, func(err error) {
+		llog.Error("Error reloading sensors registry: %v", err)
+	})
+	if alertsDB, err = alerts.InitDB(mdb); err != nil {
+		llog.Error("Error initializing AlertsDB: %v", err)
+		return
+	}
+	if statesDB, err = states.InitDB(mdb); err != nil {
+		llog.Error("Error initializing StatesDB: %v", err)
+		return
+	}
+	if devicesDB, err = devices.InitDB(mdb); err != nil {
+		llog.Error("Error initializing DevicesDB: %v", err)
+		return
+	}
+	if groupsDB, err = groups.InitDB(mdb); err != nil {
+		llog.Error("Error initializing GroupsDB: %v", err)
+		return
+	}
+	// тестовые пользователи с известными паролями допустимы только в режиме разработки
+	if !*dev {
+		sample, err := usersDB.HasSampleCredentials()
+		if err != nil {
+			llog.Error("usersDB error: %v", err)
+			return
+		}
+		if sample {
+			llog.Error("Sample user credentials found: remove them with users-seed -remove or use -dev flag")
+			return
+		}
+	}
 
 	log.Println("Connecting to NATS...")
 	nc, err := nats.Connect(*natsURL)
@@ -90,41 +154,39 @@ func main() {
 	}
 
 	// инициализируем работу с токенами
-	tokenEngine, err = token.Init("com.xyzrd.geotracker", time.Minute*30, nil)
+	keys, err := loadKeys(*jwtKeys)
+	if err != nil {
+		llog.Error("Error loading JWT keys: %v", err)
+		return
+	}
+	tokenEngine = token.InitKeys("com.xyzrd.geotracker", tokenExpire, keys)
+	tokensDB, err := token.InitDB(mdb)
 	if err != nil {
-		llog.Error("Error initializing Token Engine: %v", err)
+		llog.Error("Error initializing TokensDB: %v", err)
 		return
 	}
-	llog.Debug("CryptoKey: %v", tokenEngine.CryptoKey())
+	tokenEngine.SetStore(tokensDB) // refresh-токены и список отозванных токенов
+
+	// инициализируем авторизацию через провайдеров OpenID Connect
+	if *oidcConfig != "" {
+		if oidcDB, err = oidc.InitDB(mdb); err != nil {
+			llog.Error("Error initializing OIDC DB: %v", err)
+			return
+		}
+		if ssoProviders, err = loadProviders(*oidcConfig); err != nil {
+			llog.Error("Error loading OpenID Connect providers: %v", err)
+			return
+		}
+	}
 
 	e.Use(Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.Gzip())
 
-	apiV1 := e.Group("/api/v1") // группа URL для обработки API версии 1.0.
-	apiV1.Get("/login", login)  // авторизация пользователя
+	e.Get("/.well-known/jwks.json", getJWKS) // открытые ключи для проверки токенов
 
-	apiV1Sec := apiV1.Group("") // группа запросов с авторизацией
-	apiV1Sec.Use(auth)          // добавляем проверку токена в заголовке
-
-	apiV1Sec.Get("/users", getUsers) // возвращает список пользователей
-
-	apiV1Sec.Get("/places", getPlaces)                // возвращает список интересующих мест
-	apiV1Sec.Post("/places", postPlace)               // добавляет определение нового места
-	apiV1Sec.Get("/places/:place-id", getPlace)       // возвращает информацию об указаном месте
-	apiV1Sec.Put("/places/:place-id", putPlace)       // изменяет определение места
-	apiV1Sec.Delete("/places/:place-id", deletePlace) // удаляет определение места
-
-	apiV1Sec.Get("/devices", getDevices)                      // возвращает список устройств
-	apiV1Sec.Post("/devices", postDevicePairing)              // привязка устройства к группе
-	apiV1Sec.Post("/devices/:device-id", postDevicePairing)   // привязка устройства к группе
-	apiV1Sec.Get("/devices/:device-id/tracks", getTracks)     // возвращает список трекингов устройства
-	apiV1Sec.Post("/devices/:device-id/tracks", postTracks)   // добавляет данные о треках устройства
-	apiV1Sec.Get("/devices/:device-id/sensors", getSensors)   // возвращает список трекингов устройства
-	apiV1Sec.Post("/devices/:device-id/sensors", postSensors) // добавляет данные о треках устройства
-
-	apiV1Sec.Post("/push/:push-type", postRegister)            // регистрирует устройство для отправки push-сообщений
-	apiV1Sec.Delete("/push/:push-type/:token", deleteRegister) // удаляет токен из хранилища
+	apiV1 := e.Group("/api/v1") // группа URL для обработки API версии 1.0.
+	addRoutes(apiV1, routes)    // проверки доступа задаются для каждого запроса
 
 	llog.Info("Starting HTTP server at %q...", *addr)
 	e.Run(*addr)
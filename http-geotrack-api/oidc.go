@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/oidc"
+	"github.com/mdigger/geotrack/users"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ssoProvider описывает настройки авторизации пользователей через провайдера OpenID Connect.
+type ssoProvider struct {
+	oidc.Config
+	GroupID   string `json:",omitempty"` // группа для регистрации новых пользователей
+	Role      string `json:",omitempty"` // роль новых пользователей в группе
+	LinkEmail bool   `json:",omitempty"` // привязывать к пользователю с тем же адресом почты
+	ReturnURL string `json:",omitempty"` // адрес приложения для возврата токенов
+	provider  *oidc.Provider
+}
+
+var (
+	ssoProviders map[string]*ssoProvider // провайдеры OpenID Connect по их названиям
+	oidcDB       *oidc.DB                // хранилище состояний авторизации
+)
+
+// loadProviders загружает описания провайдеров OpenID Connect из файла в формате JSON.
+// Провайдеры, описание которых не удалось получить, пропускаются.
+func loadProviders(filename string) (map[string]*ssoProvider, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var list []*ssoProvider
+	if err := json.NewDecoder(file).Decode(&list); err != nil {
+		return nil, err
+	}
+	result := make(map[string]*ssoProvider, len(list))
+	for _, sso := range list {
+		if sso.RedirectURL == "" {
+			return nil, fmt.Errorf("%s: missing redirect URL", sso.Name)
+		}
+		if sso.GroupID != "" {
+			if sso.Role == "" {
+				sso.Role = users.RoleMember
+			}
+			if !users.ValidRole(sso.Role) || sso.Role == users.RoleOwner {
+				return nil, fmt.Errorf("%s: %v", sso.Name, users.ErrBadRole)
+			}
+		}
+		if sso.provider, err = oidc.Discover(sso.Config); err != nil {
+			llog.Error("OpenID Connect provider %q error: %v", sso.Name, err)
+			continue
+		}
+		result[sso.Name] = sso
+		llog.Info("OpenID Connect provider: %v (%v)", sso.Name, sso.Issuer)
+	}
+	return result, nil
+}
+
+// getSSOProvider возвращает провайдера, указанного в запросе.
+func getSSOProvider(c *echo.Context) (*ssoProvider, error) {
+	sso, ok := ssoProviders[c.Param("provider")]
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound)
+	}
+	return sso, nil
+}
+
+// getOIDCProviders отдает список названий провайдеров OpenID Connect.
+func getOIDCProviders(c *echo.Context) error {
+	names := make([]string, 0, len(ssoProviders))
+	for name := range ssoProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return c.JSON(http.StatusOK, names)
+}
+
+// oidcCookie задает название cookie, которое привязывает состояние авторизации к браузеру,
+// начавшему авторизацию.
+const oidcCookie = "oidc_state"
+
+// newOIDCState создает и сохраняет новое состояние авторизации у провайдера и возвращает
+// адрес для перенаправления на него пользователя. Если указан пользователь, то после
+// авторизации к нему будет привязана учетная запись провайдера. Состояние привязывается
+// к браузеру с помощью cookie: возврат от провайдера в другом браузере не принимается.
+func newOIDCState(c *echo.Context, sso *ssoProvider, userID bson.ObjectId) (string, error) {
+	state := oidc.NewState(sso.Name)
+	state.UserID = userID
+	if err := oidcDB.SaveState(state); err != nil {
+		return "", err
+	}
+	http.SetCookie(c.Response(), &http.Cookie{
+		Name:     oidcCookie,
+		Value:    state.ID,
+		Path:     "/api/v1/oidc/" + sso.Name,
+		MaxAge:   int(oidc.StateExpire.Seconds()),
+		Secure:   strings.HasPrefix(sso.RedirectURL, "https:"),
+		HttpOnly: true,
+	})
+	return state.AuthCodeURL(sso.provider), nil
+}
+
+// takeOIDCState возвращает состояние авторизации, указанное в запросе возврата от провайдера,
+// если оно привязано к этому же браузеру.
+func takeOIDCState(c *echo.Context, sso *ssoProvider) (*oidc.State, error) {
+	stateID := c.Query("state")
+	cookie, err := c.Request().Cookie(oidcCookie)
+	if err != nil || stateID == "" ||
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateID)) != 1 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, oidc.ErrBadState.Error())
+	}
+	http.SetCookie(c.Response(), &http.Cookie{
+		Name:   oidcCookie,
+		Path:   "/api/v1/oidc/" + sso.Name,
+		MaxAge: -1,
+	})
+	state, err := oidcDB.TakeState(sso.Name, stateID)
+	if err == oidc.ErrBadState {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		llog.Error("oidcDB error: %v", err)
+		return nil, err
+	}
+	return state, nil
+}
+
+// getOIDCLogin перенаправляет пользователя на авторизацию у провайдера OpenID Connect.
+func getOIDCLogin(c *echo.Context) error {
+	sso, err := getSSOProvider(c)
+	if err != nil {
+		return err
+	}
+	authURL, err := newOIDCState(c, sso, "")
+	if err != nil {
+		llog.Error("oidcDB error: %v", err)
+		return err
+	}
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// postOIDCLink отдает адрес для авторизации у провайдера OpenID Connect, после которой его
+// учетная запись будет привязана к текущему пользователю. Авторизация должна выполняться
+// в том же браузере, который получил этот ответ.
+func postOIDCLink(c *echo.Context) error {
+	sso, err := getSSOProvider(c)
+	if err != nil {
+		return err
+	}
+	authURL, err := newOIDCState(c, sso, c.Get("ID").(bson.ObjectId))
+	if err != nil {
+		llog.Error("oidcDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]string{"URL": authURL})
+}
+
+// deleteOIDCLink отвязывает учетную запись провайдера OpenID Connect от текущего
+// пользователя.
+func deleteOIDCLink(c *echo.Context) error {
+	err := usersDB.UnlinkIdentity(c.Get("ID").(bson.ObjectId), c.Param("provider"))
+	switch err {
+	case nil:
+		return c.NoContent(http.StatusNoContent)
+	case mgo.ErrNotFound:
+		return echo.NewHTTPError(http.StatusNotFound)
+	case users.ErrLastIdentity:
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+}
+
+// errNotLinked возвращается, если учетная запись провайдера не привязана ни к одному
+// пользователю, а регистрация новых пользователей для провайдера не настроена.
+var errNotLinked = errors.New("account not linked")
+
+// ssoUser возвращает пользователя для учетной записи провайдера. Если учетная запись еще
+// не привязана, то она привязывается к единственному пользователю, подтвердившему тот же
+// адрес почты, что и провайдер (если это разрешено настройками провайдера), или для нее
+// регистрируется новый пользователь в заданной настройками группе.
+func ssoUser(sso *ssoProvider, identity *oidc.Identity) (*users.User, error) {
+	user, err := usersDB.FindByIdentity(sso.Name, identity.Subject)
+	if err != mgo.ErrNotFound {
+		return user, err
+	}
+	link := users.NewIdentity(sso.Name, identity.Subject, identity.Email)
+	if sso.LinkEmail && identity.EmailVerified && identity.Email != "" {
+		user, err = usersDB.FindByVerifiedEmail(identity.Email)
+		switch err {
+		case nil:
+			if err = usersDB.LinkIdentity(user.ID, &link); err != nil {
+				return nil, err
+			}
+			return user, nil
+		case mgo.ErrNotFound:
+		default:
+			return nil, err
+		}
+	}
+	if sso.GroupID == "" {
+		return nil, errNotLinked
+	}
+	user = &users.User{
+		Login:      link.Key,
+		GroupID:    sso.GroupID,
+		Name:       identity.Name,
+		Role:       sso.Role,
+		Identities: []users.Identity{link},
+	}
+	if identity.EmailVerified {
+		user.Email = identity.Email
+		user.EmailVerified = true
+	}
+	if err = usersDB.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// getOIDCCallback обрабатывает возврат пользователя от провайдера OpenID Connect: обменивает
+// код авторизации на ID-токен, находит по нему пользователя и выдает токены доступа, как и
+// при авторизации с паролем. Если задан адрес возврата в приложение, то токены передаются
+// в нем после знака #, иначе — в ответе в формате JSON. Если авторизация выполнялась для
+// привязки учетной записи, то она привязывается к пользователю, начавшему авторизацию.
+func getOIDCCallback(c *echo.Context) error {
+	sso, err := getSSOProvider(c)
+	if err != nil {
+		return err
+	}
+	if reason := c.Query("error"); reason != "" {
+		return echo.NewHTTPError(http.StatusForbidden, reason)
+	}
+	state, err := takeOIDCState(c, sso)
+	if err != nil {
+		return err
+	}
+	idToken, err := sso.provider.Exchange(c.Query("code"), state.Verifier)
+	if err != nil {
+		llog.Warn("OpenID Connect %q exchange error: %v", sso.Name, err)
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	identity, err := sso.provider.Verify(idToken, state.Nonce)
+	if err != nil {
+		llog.Warn("OpenID Connect %q token error: %v", sso.Name, err)
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	// привязка учетной записи к пользователю, начавшему авторизацию
+	if state.UserID.Valid() {
+		link := users.NewIdentity(sso.Name, identity.Subject, identity.Email)
+		err = usersDB.LinkIdentity(state.UserID, &link)
+		switch err {
+		case nil:
+		case mgo.ErrNotFound:
+			return echo.NewHTTPError(http.StatusNotFound)
+		case users.ErrIdentityLinked:
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		default:
+			llog.Error("usersDB error: %v", err)
+			return err
+		}
+		if sso.ReturnURL != "" {
+			return c.Redirect(http.StatusFound, sso.ReturnURL+"#"+url.Values{"linked": {sso.Name}}.Encode())
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+	user, err := ssoUser(sso, identity)
+	switch err {
+	case nil:
+	case errNotLinked:
+		llog.Warn("OpenID Connect %q account %q not linked", sso.Name, identity.Subject)
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case users.ErrIdentityLinked, users.ErrLoginExists:
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	logLogin(user.Login, clientIP(c.Request()), "")
+	result, err := newTokens(user)
+	if err != nil {
+		llog.Error("tokenEngine error: %v", err)
+		return err
+	}
+	if sso.ReturnURL != "" {
+		return c.Redirect(http.StatusFound, sso.ReturnURL+"#"+url.Values{
+			"access_token":  {result.AccessToken},
+			"refresh_token": {result.RefreshToken},
+			"expires_in":    {strconv.FormatInt(result.ExpiresIn, 10)},
+		}.Encode())
+	}
+	return c.JSON(http.StatusOK, result)
+}
@@ -2,17 +2,28 @@ package main
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/geo"
 	"github.com/mdigger/geotrack/places"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
 // getPlaces список мест, зарегистрированны для группы пользователей.
+// В параметрах запроса можно указать категорию мест и строку для поиска.
 func getPlaces(c *echo.Context) error {
 	groupID := c.Get("GroupID").(string)
-	places, err := placesDB.GetAll(groupID)
+	filter := places.Filter{
+		Category: c.Query("category"),
+		Query:    c.Query("q"),
+	}
+	if filter.Category != "" && !places.ValidCategory(filter.Category) {
+		return echo.NewHTTPError(http.StatusBadRequest, places.ErrBadCategory.Error())
+	}
+	places, err := placesDB.Find(groupID, filter)
 	if err == mgo.ErrNotFound {
 		return echo.NewHTTPError(http.StatusNotFound)
 	}
@@ -23,6 +34,77 @@ func getPlaces(c *echo.Context) error {
 	return c.JSON(http.StatusOK, places)
 }
 
+// nearbyLimit задает количество ближайших мест, отдаваемых по умолчанию.
+const nearbyLimit = 10
+
+// getPlacesNearby возвращает список мест, отсортированный по расстоянию до указанной точки.
+// Координаты точки задаются параметрами lon и lat. Дополнительно можно указать максимальное
+// количество мест (limit) и максимальное расстояние до них в метрах (max).
+func getPlacesNearby(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	lon, err := strconv.ParseFloat(c.Query("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad longitude")
+	}
+	lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad latitude")
+	}
+	limit, err := strconv.ParseUint(c.Query("limit"), 10, 16)
+	if err != nil || limit < 1 {
+		limit = nearbyLimit
+	}
+	maxDistance, err := strconv.ParseFloat(c.Query("max"), 64)
+	if err != nil || maxDistance < 0 {
+		maxDistance = 0
+	}
+	places, err := placesDB.Nearest(groupID, geo.NewPoint(lon, lat), int(limit), maxDistance)
+	if err != nil {
+		llog.Error("placesDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, places)
+}
+
+// suggestDays задает количество дней, за которые анализируются треки устройств
+// при поиске часто посещаемых мест.
+const suggestDays = 14
+
+// getPlacesSuggestions анализирует треки всех устройств группы и возвращает список
+// часто посещаемых мест, которые еще не определены пользователями. Количество анализируемых
+// дней можно задать параметром days. Для сохранения предложенного места достаточно
+// отправить его описание в запросе на добавление нового места.
+func getPlacesSuggestions(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	days, err := strconv.ParseUint(c.Query("days"), 10, 16)
+	if err != nil || days < 1 {
+		days = suggestDays
+	}
+	deviceIDs, err := tracksDB.GetDevicesID(groupID)
+	if err != nil {
+		llog.Error("tracksDB error: %v", err)
+		return err
+	}
+	opts := places.DefaultSuggestOptions
+	to := time.Now()
+	from := to.AddDate(0, 0, -int(days))
+	stays := make([]places.Stay, 0)
+	for _, deviceID := range deviceIDs {
+		tracks, err := tracksDB.GetRange(groupID, deviceID, from, to)
+		if err != nil {
+			llog.Error("tracksDB error: %v", err)
+			return err
+		}
+		stays = append(stays, places.Stays(tracks, opts)...)
+	}
+	suggestions, err := placesDB.Suggest(groupID, stays, opts)
+	if err != nil {
+		llog.Error("placesDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, suggestions)
+}
+
 // getPlace возвращает информацию о месте с заданным идентификатором.
 func getPlace(c *echo.Context) error {
 	groupID := c.Get("GroupID").(string)
@@ -49,17 +131,21 @@ func postPlace(c *echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
-	if place.Circle == nil && place.Polygon == nil {
+	if place.Circle == nil && place.Polygon == nil && place.Corridor == nil {
 		return echo.NewHTTPError(http.StatusBadRequest)
 	}
 	place.ID = ""
 	place.GroupID = groupID
+	place.CreatorID = c.Get("ID").(bson.ObjectId)
 	id, err := placesDB.Save(place)
+	if err == places.ErrBadCategory || err == places.ErrBadPlaceData {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 	if err != nil {
 		llog.Error("placesDB error: %v", err)
 		return err
 	}
-	c.Response().Header().Set("Location", e.URL(getPlace, id.Hex()))
+	c.Response().Header().Set("Location", "/api/v1/places/"+id.Hex())
 	return c.JSON(http.StatusCreated, map[string]interface{}{"ID": id.Hex()})
 }
 
@@ -75,15 +161,19 @@ func putPlace(c *echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
-	if place.Circle == nil && place.Polygon == nil {
+	if place.Circle == nil && place.Polygon == nil && place.Corridor == nil {
 		return echo.NewHTTPError(http.StatusBadRequest)
 	}
 	place.ID = bson.ObjectIdHex(placeID)
 	place.GroupID = groupID
+	place.CreatorID = c.Get("ID").(bson.ObjectId)
 	_, err = placesDB.Save(place)
 	if err == mgo.ErrNotFound {
 		return echo.NewHTTPError(http.StatusNotFound)
 	}
+	if err == places.ErrBadCategory || err == places.ErrBadPlaceData {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 	if err != nil {
 		llog.Error("placesDB error: %v", err)
 		return err
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/places"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	maxImportSize       = 10 << 20 // максимальный размер импортируемого файла
+	mimeGeoJSON         = "application/vnd.geo+json"
+	mimeKML             = "application/vnd.google-earth.kml+xml"
+	placesFormatKML     = "kml"
+	placesFormatGeoJSON = "geojson"
+)
+
+// placesFormat возвращает формат импорта или экспорта мест. Формат задается параметром
+// запроса format, а если он не указан, то определяется по типу передаваемых данных.
+// По умолчанию используется GeoJSON.
+func placesFormat(c *echo.Context) string {
+	if format := strings.ToLower(c.Query("format")); format != "" {
+		return format
+	}
+	if strings.Contains(c.Request().Header.Get(echo.ContentType), "kml") {
+		return placesFormatKML
+	}
+	return placesFormatGeoJSON
+}
+
+// getPlacesExport отдает описания всех мест группы в формате GeoJSON или KML.
+func getPlacesExport(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	format := placesFormat(c)
+	if format != placesFormatGeoJSON && format != placesFormatKML {
+		return echo.NewHTTPError(http.StatusBadRequest, "unsupported format")
+	}
+	list, err := placesDB.GetAll(groupID)
+	if err != nil {
+		llog.Error("placesDB error: %v", err)
+		return err
+	}
+	var (
+		data     []byte
+		mimeType string
+	)
+	if format == placesFormatKML {
+		data, err = places.ExportKML("places", list)
+		mimeType = mimeKML
+	} else {
+		var collection *places.FeatureCollection
+		if collection, err = places.ExportGeoJSON(list); err == nil {
+			data, err = json.Marshal(collection)
+		}
+		mimeType = mimeGeoJSON
+	}
+	if err != nil {
+		llog.Error("places export error: %v", err)
+		return err
+	}
+	response := c.Response()
+	response.Header().Set(echo.ContentType, mimeType)
+	response.Header().Set("Content-Disposition", "attachment; filename=places."+format)
+	response.WriteHeader(http.StatusOK)
+	response.Write(data)
+	return nil
+}
+
+// postPlacesImport добавляет места группы из файла в формате GeoJSON или KML.
+// Объекты с некорректной геометрией, в том числе отклоненные хранилищем, пропускаются,
+// а в ответе возвращается описание ошибки для каждого из них.
+func postPlacesImport(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	userID := c.Get("ID").(bson.ObjectId)
+	data, err := ioutil.ReadAll(io.LimitReader(c.Request().Body, maxImportSize))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	var (
+		list []places.Place
+		errs []places.FeatureError
+	)
+	switch placesFormat(c) {
+	case placesFormatKML:
+		list, errs, err = places.ImportKML(data)
+	case placesFormatGeoJSON:
+		list, errs, err = places.ImportGeoJSON(data)
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "unsupported format")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ids, errs, err := placesDB.Import(groupID, userID, list, errs)
+	if err != nil {
+		llog.Error("placesDB error: %v", err)
+		return err
+	}
+	placeIDs := make([]string, len(ids))
+	for i, id := range ids {
+		placeIDs[i] = id.Hex()
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"Imported": placeIDs,
+		"Errors":   errs,
+	})
+}
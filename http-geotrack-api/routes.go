@@ -0,0 +1,167 @@
+package main
+
+import (
+	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/policy"
+	"github.com/mdigger/geotrack/users"
+)
+
+// authType задает способ авторизации запроса.
+type authType int
+
+const (
+	authNone authType = iota // без авторизации
+	authUser                 // токен пользователя
+	authData                 // токен устройства или пользователя
+)
+
+// access описывает проверки, выполняемые перед обработкой запроса.
+type access struct {
+	Auth   authType      // способ авторизации
+	Role   string        // минимальная роль пользователя в группе
+	Action policy.Action // действие с устройством, указанным в пути запроса
+}
+
+// Проверки доступа к запросам API.
+var (
+	accessPublic       = access{}                                           // без авторизации
+	accessUser         = access{Auth: authUser}                             // любой пользователь группы
+	accessMember       = access{Auth: authUser, Role: users.RoleMember}     // изменение данных группы
+	accessAdmin        = access{Auth: authUser, Role: users.RoleAdmin}      // управление группой
+	accessDeviceRead   = access{Auth: authUser, Action: policy.Read}        // просмотр устройства
+	accessDeviceWrite  = access{Auth: authUser, Action: policy.Write}       // изменение устройства
+	accessDeviceManage = access{Auth: authUser, Action: policy.Manage}      // управление устройством
+	accessPostTracks   = access{Auth: authData, Action: policy.PostTracks}  // передача треков
+	accessPostSensors  = access{Auth: authData, Action: policy.PostSensors} // передача данных сенсоров
+)
+
+// wrap возвращает обработчик запроса, выполняющий перед ним проверки доступа.
+func (a access) wrap(h echo.HandlerFunc) echo.HandlerFunc {
+	if a.Action != "" {
+		h = deviceAccess(a.Action)(h)
+	}
+	if a.Role != "" {
+		h = requireRole(a.Role)(h)
+	}
+	switch a.Auth {
+	case authUser:
+		h = auth(h)
+	case authData:
+		h = deviceAuth(h)
+	}
+	return h
+}
+
+// route описывает запрос API версии 1.0.
+type route struct {
+	Method  string           // метод HTTP
+	Path    string           // путь относительно /api/v1
+	Handler echo.HandlerFunc // обработчик запроса
+	Access  access           // проверки доступа
+}
+
+// routes задает список запросов API версии 1.0.
+//
+// Проверки доступа задаются для каждого запроса отдельно, а не группами echo: echo
+// сохраняет цепочку middleware для пути целиком, поэтому при регистрации одного пути
+// с разными методами в разных группах ко всем методам применялись бы проверки группы,
+// зарегистрировавшей путь последней.
+var routes = []route{
+	{"GET", "/login", login, accessPublic},                         // авторизация пользователя
+	{"POST", "/login", postLogin, accessPublic},                    // авторизация с получением refresh-токена
+	{"POST", "/token/refresh", postRefresh, accessPublic},          // обновление токена доступа
+	{"POST", "/signup", postSignup, accessPublic},                  // регистрация нового пользователя
+	{"POST", "/password/forgot", postPasswordForgot, accessPublic}, // запрос на восстановление пароля
+	{"POST", "/password/reset", postPasswordReset, accessPublic},   // установка нового пароля по токену
+	{"POST", "/email/confirm", postEmailConfirm, accessPublic},     // подтверждение адреса почты по токену
+
+	{"GET", "/oidc", getOIDCProviders, accessPublic},                   // список провайдеров OpenID Connect
+	{"GET", "/oidc/:provider/login", getOIDCLogin, accessPublic},       // авторизация через провайдера
+	{"GET", "/oidc/:provider/callback", getOIDCCallback, accessPublic}, // возврат от провайдера с кодом авторизации
+	{"POST", "/oidc/:provider/link", postOIDCLink, accessUser},         // привязывает учетную запись провайдера
+	{"DELETE", "/oidc/:provider/link", deleteOIDCLink, accessUser},     // отвязывает учетную запись провайдера
+
+	{"GET", "/users", getUsers, accessUser},                       // возвращает список пользователей
+	{"GET", "/users/me", getMe, accessUser},                       // возвращает профиль текущего пользователя
+	{"PATCH", "/users/me", patchMe, accessUser},                   // изменяет профиль текущего пользователя
+	{"GET", "/users/me/avatar", getAvatar, accessUser},            // возвращает аватар текущего пользователя
+	{"PUT", "/users/me/avatar", putAvatar, accessUser},            // загружает аватар текущего пользователя
+	{"DELETE", "/users/me/avatar", deleteAvatar, accessUser},      // удаляет аватар текущего пользователя
+	{"POST", "/users/invites", postInvite, accessAdmin},           // создает приглашение в группу
+	{"GET", "/users/invites", getInvites, accessAdmin},            // возвращает список приглашений
+	{"DELETE", "/users/invites/:code", deleteInvite, accessAdmin}, // отзывает приглашение
+	{"GET", "/users/:user-id/avatar", getAvatar, accessUser},      // возвращает аватар пользователя
+	{"PATCH", "/users/:user-id", patchUser, accessAdmin},          // изменяет профиль пользователя группы
+	{"PUT", "/users/:user-id/role", putUserRole, accessAdmin},     // изменяет роль пользователя
+	{"DELETE", "/users/:user-id", deleteUser, accessAdmin},        // удаляет пользователя из группы
+	{"POST", "/logout", postLogout, accessUser},                   // завершает текущий сеанс
+	{"POST", "/logout/all", postLogoutAll, accessUser},            // завершает все сеансы пользователя
+	{"PUT", "/password", putPassword, accessUser},                 // изменяет пароль текущего пользователя
+	{"POST", "/email/verify", postEmailVerify, accessUser},        // отправляет код подтверждения адреса почты
+
+	{"GET", "/group", getGroup, accessUser},  // возвращает описание группы
+	{"PUT", "/group", putGroup, accessAdmin}, // изменяет название и настройки группы
+
+	{"GET", "/places", getPlaces, accessUser},                        // возвращает список интересующих мест
+	{"POST", "/places", postPlace, accessMember},                     // добавляет определение нового места
+	{"GET", "/places/nearby", getPlacesNearby, accessUser},           // возвращает ближайшие к точке места
+	{"GET", "/places/suggestions", getPlacesSuggestions, accessUser}, // предлагает часто посещаемые места
+	{"GET", "/places/export", getPlacesExport, accessUser},           // экспорт мест в GeoJSON или KML
+	{"POST", "/places/import", postPlacesImport, accessMember},       // импорт мест из GeoJSON или KML
+	{"GET", "/places/:place-id", getPlace, accessUser},               // возвращает информацию об указаном месте
+	{"PUT", "/places/:place-id", putPlace, accessMember},             // изменяет определение места
+	{"DELETE", "/places/:place-id", deletePlace, accessMember},       // удаляет определение места
+
+	{"GET", "/sensors/schemas", getSensorSchemas, accessUser}, // возвращает описания сенсоров
+
+	{"GET", "/alerts", getAlerts, accessUser},                             // возвращает список уведомлений
+	{"POST", "/alerts/:alert-id/ack", postAlertAck, accessMember},         // отмечает уведомление как просмотренное
+	{"POST", "/alerts/:alert-id/resolve", postAlertResolve, accessMember}, // отмечает уведомление как решенное
+	{"GET", "/alerts/rules", getAlertRules, accessUser},                   // возвращает список правил уведомлений
+	{"POST", "/alerts/rules", postAlertRule, accessMember},                // добавляет новое правило уведомлений
+	{"PUT", "/alerts/rules/:rule-id", putAlertRule, accessMember},         // изменяет правило уведомлений
+	{"DELETE", "/alerts/rules/:rule-id", deleteAlertRule, accessMember},   // удаляет правило уведомлений
+
+	{"GET", "/devices", getDevices, accessUser},                                     // возвращает список устройств
+	{"POST", "/devices", postDevicePairing, accessMember},                           // привязка устройства к группе
+	{"GET", "/devices/states", getDeviceStates, accessUser},                         // возвращает состояние всех устройств
+	{"POST", "/devices/:device-id", postDevicePairing, accessMember},                // привязка устройства к группе
+	{"GET", "/devices/:device-id", getDevice, accessDeviceRead},                     // возвращает описание устройства
+	{"PUT", "/devices/:device-id", putDevice, accessDeviceWrite},                    // изменяет описание устройства
+	{"DELETE", "/devices/:device-id", deleteDevice, accessDeviceManage},             // удаляет устройство из группы
+	{"POST", "/devices/:device-id/token", postDeviceToken, accessDeviceManage},      // выдает устройству новый токен
+	{"DELETE", "/devices/:device-id/token", deleteDeviceToken, accessDeviceManage},  // отзывает токен устройства
+	{"GET", "/devices/:device-id/state", getDeviceState, accessDeviceRead},          // возвращает текущее состояние устройства
+	{"PUT", "/devices/:device-id/timeout", putDeviceTimeout, accessDeviceWrite},     // задает время до отключения устройства
+	{"GET", "/devices/:device-id/gaps", getDeviceGaps, accessDeviceRead},            // возвращает интервалы отсутствия связи
+	{"GET", "/devices/:device-id/battery", getBattery, accessDeviceRead},            // возвращает анализ уровня заряда
+	{"GET", "/devices/:device-id/tracks", getTracks, accessDeviceRead},              // возвращает список трекингов устройства
+	{"POST", "/devices/:device-id/tracks", postTracks, accessPostTracks},            // добавляет данные о треках устройства
+	{"GET", "/devices/:device-id/sensors", getSensors, accessDeviceRead},            // возвращает список трекингов устройства
+	{"POST", "/devices/:device-id/sensors", postSensors, accessPostSensors},         // добавляет данные сенсоров устройства
+	{"GET", "/devices/:device-id/sensors/:name", getSensorSeries, accessDeviceRead}, // возвращает значения сенсора за период
+
+	{"POST", "/push/:push-type", postRegister, accessUser},            // регистрирует устройство для отправки push-сообщений
+	{"DELETE", "/push/:push-type/:token", deleteRegister, accessUser}, // удаляет токен из хранилища
+}
+
+// addRoutes регистрирует запросы в группе URL с проверками доступа к каждому из них.
+func addRoutes(g *echo.Group, list []route) {
+	for _, r := range list {
+		h := r.Access.wrap(r.Handler)
+		switch r.Method {
+		case "GET":
+			g.Get(r.Path, h)
+		case "POST":
+			g.Post(r.Path, h)
+		case "PUT":
+			g.Put(r.Path, h)
+		case "PATCH":
+			g.Patch(r.Path, h)
+		case "DELETE":
+			g.Delete(r.Path, h)
+		default:
+			panic("unsupported method: " + r.Method)
+		}
+	}
+}
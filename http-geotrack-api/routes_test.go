@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestRoutes(t *testing.T) {
+	registered := make(map[string]access, len(routes))
+	for _, r := range routes {
+		key := r.Method + " " + r.Path
+		if _, ok := registered[key]; ok {
+			t.Errorf("duplicate route: %v", key)
+		}
+		if r.Handler == nil {
+			t.Errorf("missing handler: %v", key)
+		}
+		if r.Access.Action != "" && r.Access.Auth == authNone {
+			t.Errorf("device access without auth: %v", key)
+		}
+		registered[key] = r.Access
+	}
+	// один и тот же путь с разными методами требует разных проверок доступа
+	for key, want := range map[string]access{
+		"GET /places/:place-id":            accessUser,
+		"PUT /places/:place-id":            accessMember,
+		"DELETE /places/:place-id":         accessMember,
+		"GET /group":                       accessUser,
+		"PUT /group":                       accessAdmin,
+		"GET /devices":                     accessUser,
+		"POST /devices":                    accessMember,
+		"GET /alerts/rules":                accessUser,
+		"POST /alerts/rules":               accessMember,
+		"POST /devices/:device-id":         accessMember,
+		"GET /devices/:device-id":          accessDeviceRead,
+		"PUT /devices/:device-id":          accessDeviceWrite,
+		"DELETE /devices/:device-id":       accessDeviceManage,
+		"GET /devices/:device-id/tracks":   accessDeviceRead,
+		"POST /devices/:device-id/tracks":  accessPostTracks,
+		"GET /devices/:device-id/sensors":  accessDeviceRead,
+		"POST /devices/:device-id/sensors": accessPostSensors,
+		"POST /login":                      accessPublic,
+	} {
+		got, ok := registered[key]
+		if !ok {
+			t.Errorf("route not registered: %v", key)
+			continue
+		}
+		if got != want {
+			t.Errorf("%v: access %+v, want %+v", key, got, want)
+		}
+	}
+}
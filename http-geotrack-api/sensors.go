@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/mdigger/geotrack/sensors"
@@ -32,23 +33,112 @@ func getSensors(c *echo.Context) error {
 	return c.JSON(http.StatusOK, sensors)
 }
 
+const (
+	seriesStep      = 60    // интервал агрегации значений сенсора по умолчанию в минутах
+	seriesMaxPoints = 10000 // максимальное количество интервалов агрегации в ответе
+)
+
+// timeRange возвращает период, заданный параметрами запроса from и to в формате RFC 3339.
+// Если окончание периода не указано, то используется текущее время, а если не указано
+// начало — то оно отстоит от окончания на указанную длительность.
+func timeRange(c *echo.Context, period time.Duration) (from, to time.Time, err error) {
+	to = time.Now()
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return from, to, echo.NewHTTPError(http.StatusBadRequest, "bad to time")
+		}
+	}
+	from = to.Add(-period)
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return from, to, echo.NewHTTPError(http.StatusBadRequest, "bad from time")
+		}
+	}
+	if !from.Before(to) {
+		return from, to, echo.NewHTTPError(http.StatusBadRequest, "bad time range")
+	}
+	return from, to, nil
+}
+
+// seriesStepDuration возвращает интервал агрегации значений сенсора, заданный в минутах.
+// Интервал проверяется до преобразования в time.Duration, чтобы большие значения не приводили
+// к переполнению: он не может быть больше периода, а количество интервалов в периоде
+// ограничено seriesMaxPoints. Интервал по умолчанию сокращается до длительности периода.
+func seriesStepDuration(value string, from, to time.Time) (time.Duration, error) {
+	period := to.Sub(from)
+	maxStep := uint64(period / time.Minute)
+	if maxStep < 1 {
+		maxStep = 1 // период короче минуты агрегируется в один интервал
+	}
+	step, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || step < 1 {
+		step = seriesStep
+		if step > maxStep {
+			step = maxStep
+		}
+	} else if step > maxStep {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "step is too large for time range")
+	}
+	stepDuration := time.Duration(step) * time.Minute
+	if period/stepDuration > seriesMaxPoints {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "step is too small for time range")
+	}
+	return stepDuration, nil
+}
+
+// getSensorSeries отдает значения указанного числового сенсора устройства за период,
+// агрегированные по интервалам. Период задается параметрами from и to в формате RFC 3339
+// (по умолчанию — последние сутки), а длительность интервала в минутах — параметром step.
+func getSensorSeries(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	deviceID := c.Param("device-id")
+	name := c.Param("name")
+	from, to, err := timeRange(c, 24*time.Hour)
+	if err != nil {
+		return err
+	}
+	stepDuration, err := seriesStepDuration(c.Query("step"), from, to)
+	if err != nil {
+		return err
+	}
+	series, err := sensorsDB.Series(groupID, deviceID, name, from, to, stepDuration)
+	if err != nil {
+		llog.Error("sensorsDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, series)
+}
+
+// getSensorSchemas отдает список описаний поддерживаемых сенсоров.
+func getSensorSchemas(c *echo.Context) error {
+	return c.JSON(http.StatusOK, sensorsRegistry.Schemas())
+}
+
 // postSensors добавляет новые данные о сенсорах устройства в хранилище.
+// Если значение хотя бы одного сенсора не соответствует его описанию и должно быть
+// отброшено, то данные не принимаются, а в ответ возвращается список проблем.
 func postSensors(c *echo.Context) error {
 	groupID := c.Get("GroupID").(string)
 	deviceID := c.Param("device-id")
-	var sensors = make([]sensors.SensorData, 0)
-	err := c.Bind(&sensors)
+	var list = make([]sensors.SensorData, 0)
+	err := c.Bind(&list)
 	if err != nil || len(deviceID) < 12 {
 		return echo.NewHTTPError(http.StatusBadRequest)
 	}
-	// добавляем идентификатор группы и устройства
-	for i, sensor := range sensors {
+	// добавляем идентификатор группы и устройства и проверяем значения сенсоров
+	var issues = make([]sensors.Issue, 0)
+	for i, sensor := range list {
 		sensor.DeviceID = deviceID
 		sensor.GroupID = groupID
-		sensors[i] = sensor
+		list[i] = sensor
+		_, sensorIssues := sensorsRegistry.Validate(sensor)
+		issues = append(issues, sensorIssues...)
+	}
+	if sensors.Rejected(issues) {
+		return c.JSON(http.StatusBadRequest, issues)
 	}
 	// пропускаем через NATS, а не на прямую в базу
-	err = nce.Publish(serviceNameSensors, sensors)
+	err = nce.Publish(serviceNameSensors, list)
 	// err = sensorsDB.Add(sensors...)
 	if err != nil {
 		llog.Error("sensors NATS publishing error: %v", err)
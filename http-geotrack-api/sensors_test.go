@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeriesStepDuration(t *testing.T) {
+	to := time.Now()
+	for _, test := range []struct {
+		step   string
+		period time.Duration
+		want   time.Duration // 0 — интервал отклоняется
+	}{
+		{"", 24 * time.Hour, time.Hour},
+		{"15", 24 * time.Hour, 15 * time.Minute},
+		{"", 30 * time.Minute, 30 * time.Minute},
+		{"", 10 * time.Second, time.Minute},
+		{"1440", 24 * time.Hour, 24 * time.Hour},
+		{"1441", 24 * time.Hour, 0},
+		{"4294967295", 24 * time.Hour, 0},
+		{"18446744073709551615", 24 * time.Hour, 0},
+		{"1", 365 * 24 * time.Hour, 0},
+	} {
+		got, err := seriesStepDuration(test.step, to.Add(-test.period), to)
+		if test.want == 0 {
+			if err == nil {
+				t.Errorf("step %q for %v: accepted %v", test.step, test.period, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("step %q for %v: %v, %v; want %v", test.step, test.period, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/token"
+	"github.com/mdigger/geotrack/users"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var tokenExpire = time.Minute * 30 // время жизни токена доступа
+
+// tokens описывает ответ с токеном доступа и refresh-токеном.
+type tokens struct {
+	AccessToken  string // токен доступа в формате JWT
+	RefreshToken string // токен для получения нового токена доступа
+	ExpiresIn    int64  // время жизни токена доступа в секундах
+}
+
+// newTokens формирует новый токен доступа и refresh-токен для нового сеанса пользователя.
+func newTokens(user *users.User) (*tokens, error) {
+	data := tokenData(user)
+	access, err := tokenEngine.Token(data)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := tokenEngine.Refresh(user.ID.Hex(), data)
+	if err != nil {
+		return nil, err
+	}
+	return &tokens{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(tokenExpire.Seconds()),
+	}, nil
+}
+
+// postLogin проверяет пользователя по заголовку с HTTP Basic авторизацией и отдает в ответ
+// токен доступа вместе с refresh-токеном для его обновления.
+func postLogin(c *echo.Context) error {
+	user, err := checkLogin(c)
+	if err != nil {
+		return err
+	}
+	result, err := newTokens(user)
+	if err != nil {
+		llog.Error("tokenEngine error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// postRefresh обменивает refresh-токен на новую пару токенов. Использованный refresh-токен
+// становится не действительным.
+func postRefresh(c *echo.Context) error {
+	var data struct {
+		RefreshToken string
+	}
+	if err := c.Bind(&data); err != nil || data.RefreshToken == "" {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+	access, refresh, claims, err := tokenEngine.Rotate(data.RefreshToken)
+	switch err {
+	case nil:
+	case token.ErrRefreshNotFound:
+		return echo.NewHTTPError(http.StatusForbidden)
+	case token.ErrRefreshReused:
+		llog.Warn("Refresh token reused: session closed")
+		return echo.NewHTTPError(http.StatusForbidden)
+	default:
+		llog.Error("tokenEngine error: %v", err)
+		return err
+	}
+	// проверяем, что пользователь все еще есть и входит в эту группу
+	groupID, _ := claims["group"].(string)
+	userID, _ := claims["id"].(string)
+	exists := false
+	if bson.IsObjectIdHex(userID) {
+		if exists, err = usersDB.Check(groupID, bson.ObjectIdHex(userID)); err != nil {
+			llog.Error("usersDB error: %v", err)
+			return err
+		}
+	}
+	if !exists {
+		if err := tokenEngine.Logout(refresh); err != nil {
+			llog.Error("tokenEngine error: %v", err)
+		}
+		return echo.NewHTTPError(http.StatusForbidden)
+	}
+	return c.JSON(http.StatusOK, &tokens{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(tokenExpire.Seconds()),
+	})
+}
+
+// postLogout завершает текущий сеанс пользователя: отзывает используемый токен доступа и,
+// если он указан, refresh-токен этого сеанса.
+func postLogout(c *echo.Context) error {
+	var data struct {
+		RefreshToken string
+	}
+	if c.Request().ContentLength > 0 {
+		if err := c.Bind(&data); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest)
+		}
+	}
+	if err := tokenEngine.Revoke(c.Get("Token").(map[string]interface{})); err != nil {
+		llog.Error("tokenEngine error: %v", err)
+		return err
+	}
+	if data.RefreshToken != "" {
+		err := tokenEngine.Logout(data.RefreshToken)
+		if err != nil && err != token.ErrRefreshNotFound {
+			llog.Error("tokenEngine error: %v", err)
+			return err
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// postLogoutAll завершает все сеансы текущего пользователя: отзывает все выданные ему
+// токены доступа и refresh-токены.
+func postLogoutAll(c *echo.Context) error {
+	userID := c.Get("ID").(bson.ObjectId)
+	if err := tokenEngine.Revoke(c.Get("Token").(map[string]interface{})); err != nil {
+		llog.Error("tokenEngine error: %v", err)
+		return err
+	}
+	if err := tokenEngine.LogoutAll(userID.Hex()); err != nil {
+		llog.Error("tokenEngine error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
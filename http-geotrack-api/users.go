@@ -1,10 +1,15 @@
 package main
 
 import (
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
 
 	"github.com/labstack/echo"
+	"github.com/mdigger/geotrack/users"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 // getUsers отдает список зарегистрированных пользователей, которые относятся к той же
@@ -21,3 +26,130 @@ func getUsers(c *echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, users)
 }
+
+// getMe отдает профиль текущего пользователя.
+func getMe(c *echo.Context) error {
+	user, err := usersDB.GetByID(c.Get("ID").(bson.ObjectId))
+	if err == mgo.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+// updateProfile изменяет профиль пользователя группы по данным из запроса. Адрес почты
+// изменяется, только если разрешено.
+func updateProfile(c *echo.Context, userID bson.ObjectId, allowEmail bool) error {
+	profile := new(users.Profile)
+	if err := c.Bind(profile); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+	if profile.Email != nil && !allowEmail {
+		return echo.NewHTTPError(http.StatusBadRequest, "email can be changed only by user")
+	}
+	groupID := c.Get("GroupID").(string)
+	err := usersDB.UpdateProfile(groupID, userID, profile)
+	switch err {
+	case nil:
+		return c.NoContent(http.StatusNoContent)
+	case users.ErrBadLocale, users.ErrBadTimezone, users.ErrBadUnits:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case mgo.ErrNotFound:
+		return echo.NewHTTPError(http.StatusNotFound)
+	default:
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+}
+
+// patchMe изменяет профиль текущего пользователя. Изменяются только переданные поля.
+func patchMe(c *echo.Context) error {
+	return updateProfile(c, c.Get("ID").(bson.ObjectId), true)
+}
+
+// patchUser изменяет профиль пользователя группы. Изменять можно только профили
+// пользователей, чья роль ниже своей. Адрес почты пользователь изменяет только сам:
+// иначе администратор мог бы подменить адрес для восстановления пароля.
+func patchUser(c *echo.Context) error {
+	userID, err := memberID(c)
+	if err != nil {
+		return err
+	}
+	return updateProfile(c, userID, false)
+}
+
+// putAvatar сохраняет изображение аватара текущего пользователя. Изображение передается
+// в теле запроса с соответствующим типом в заголовке Content-Type.
+func putAvatar(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	userID := c.Get("ID").(bson.ObjectId)
+	req := c.Request()
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(users.MaxAvatarSize)+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get(echo.ContentType))
+	avatarID, err := usersDB.SetAvatar(groupID, userID, contentType, data)
+	switch err {
+	case nil:
+		return c.JSON(http.StatusOK, map[string]string{"Avatar": avatarID.Hex()})
+	case users.ErrBadAvatar:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case mgo.ErrNotFound:
+		return echo.NewHTTPError(http.StatusNotFound)
+	default:
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+}
+
+// deleteAvatar удаляет изображение аватара текущего пользователя.
+func deleteAvatar(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	err := usersDB.DeleteAvatar(groupID, c.Get("ID").(bson.ObjectId))
+	if err == mgo.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getAvatar отдает изображение аватара пользователя той же группы. Если пользователь
+// не указан, то отдается аватар текущего пользователя.
+func getAvatar(c *echo.Context) error {
+	groupID := c.Get("GroupID").(string)
+	userID, _ := c.Get("ID").(bson.ObjectId)
+	if userIDStr := c.Param("user-id"); userIDStr != "" {
+		if !bson.IsObjectIdHex(userIDStr) {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		userID = bson.ObjectIdHex(userIDStr)
+	}
+	avatar, err := usersDB.GetAvatar(groupID, userID)
+	if err == mgo.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		llog.Error("usersDB error: %v", err)
+		return err
+	}
+	// тип изображения, сохраненного до проверки содержимого, может не соответствовать ему
+	contentType := avatar.ContentType
+	if http.DetectContentType(avatar.Data) != contentType {
+		contentType = "application/octet-stream"
+	}
+	response := c.Response()
+	response.Header().Set(echo.ContentType, contentType)
+	response.Header().Set("X-Content-Type-Options", "nosniff")
+	response.Header().Set("Last-Modified", avatar.Updated.UTC().Format(http.TimeFormat))
+	response.Header().Set("ETag", `"`+avatar.ID.Hex()+`"`)
+	response.WriteHeader(http.StatusOK)
+	response.Write(avatar.Data)
+	return nil
+}
@@ -20,7 +20,7 @@ import (
 var (
 	tracksDB *tracks.DB
 	placesDB *places.DB
-	groupID  = users.SampleGroupID
+	groupID  string // идентификатор отображаемой группы
 )
 
 // Template provides HTML template rendering
@@ -37,6 +37,7 @@ func main() {
 	mongoURL := flag.String("mongodb", "mongodb://localhost/watch", "MongoDB connection URL")
 	addr := flag.String("http", ":8080", "Server address & port")
 	docker := flag.Bool("docker", false, "for docker")
+	flag.StringVar(&groupID, "group", users.SampleGroupID, "group ID")
 	flag.Parse()
 
 	// Если запускается внутри контейнера
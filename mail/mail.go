@@ -0,0 +1,88 @@
+// Package mail описывает отправку почтовых сообщений пользователям.
+//
+// Способ отправки задается реализацией интерфейса Mailer: для работы используется отправка
+// через SMTP-сервер, а для разработки и отладки — сохранение сообщений в файлы или вывод
+// их в лог.
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Message описывает почтовое сообщение.
+type Message struct {
+	To      string // адрес получателя
+	Subject string // тема сообщения
+	Body    string // текст сообщения
+}
+
+// Mailer описывает интерфейс отправки почтовых сообщений.
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// data возвращает сообщение в формате RFC 822.
+func (m *Message) data(from string, date time.Time) []byte {
+	var buf bytes.Buffer
+	if from != "" {
+		fmt.Fprintf(&buf, "From: %s\r\n", from)
+	}
+	fmt.Fprintf(&buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(m.Body)
+	return buf.Bytes()
+}
+
+// SMTP отправляет сообщения через SMTP-сервер.
+type SMTP struct {
+	Addr string    // адрес и порт сервера
+	From string    // адрес отправителя
+	Auth smtp.Auth // авторизация на сервере (может быть не задана)
+}
+
+// Send отправляет сообщение через SMTP-сервер.
+func (s *SMTP) Send(msg *Message) error {
+	return smtp.SendMail(s.Addr, s.Auth, s.From, []string{msg.To}, msg.data(s.From, time.Now()))
+}
+
+// File сохраняет сообщения в файлы в указанном каталоге вместо их отправки. Каждое
+// сообщение сохраняется в отдельный файл с расширением .eml.
+type File struct {
+	Dir string // каталог для сохранения сообщений
+}
+
+// Send сохраняет сообщение в файл.
+func (f *File) Send(msg *Message) error {
+	if err := os.MkdirAll(f.Dir, 0700); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := filepath.Join(f.Dir, fmt.Sprintf("%d.eml", now.UnixNano()))
+	return ioutil.WriteFile(name, msg.data("", now), 0600)
+}
+
+// Log выводит сообщения в лог вместо их отправки.
+type Log struct {
+	Logger *log.Logger // лог для вывода (если не задан, то используется стандартный)
+}
+
+// Send выводит сообщение в лог.
+func (l *Log) Send(msg *Message) error {
+	text := fmt.Sprintf("MAIL to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	if l.Logger != nil {
+		l.Logger.Println(text)
+	} else {
+		log.Println(text)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package mail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var mailer Mailer = &File{Dir: dir}
+	err = mailer.Send(&Message{
+		To:      "user@example.com",
+		Subject: "Восстановление пароля",
+		Body:    "token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("bad files: %v, %v", files, err)
+	}
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	if !strings.Contains(text, "To: user@example.com\r\n") || !strings.HasSuffix(text, "\r\n\r\ntoken") {
+		t.Errorf("bad message:\n%s", text)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/mdigger/geotrack/alerts"
+	"github.com/mdigger/geotrack/sensors"
+	"github.com/mdigger/geotrack/tracks"
+	"github.com/nats-io/nats"
+)
+
+// noDataInterval задает интервал проверки правил отсутствия данных.
+var noDataInterval = time.Minute
+
+// alertMonitor проверяет данные сенсоров и трекинга по правилам групп, сохраняет сработавшие
+// уведомления в хранилище и публикует их в NATS.
+type alertMonitor struct {
+	alertsDB *alerts.DB
+	engine   *alerts.Engine
+	nce      *nats.EncodedConn
+}
+
+// newAlertMonitor возвращает новый инициализированный монитор уведомлений.
+func newAlertMonitor(alertsDB *alerts.DB, nce *nats.EncodedConn) *alertMonitor {
+	return &alertMonitor{
+		alertsDB: alertsDB,
+		engine:   alerts.NewEngine(),
+		nce:      nce,
+	}
+}
+
+// Check проверяет данные сенсоров по правилам группы.
+func (m *alertMonitor) Check(data sensors.SensorData) {
+	rules, err := m.alertsDB.GetRules(data.GroupID)
+	if err != nil {
+		log.WithError(err).Error("ALERT rules error")
+		return
+	}
+	m.publish(m.engine.Check(rules, data))
+}
+
+// CheckTracks проверяет уровень заряда устройств из данных трекинга по правилам групп.
+func (m *alertMonitor) CheckTracks(list []tracks.TrackData) {
+	rules := make(map[string][]alerts.Rule)
+	for _, track := range list {
+		groupRules, ok := rules[track.GroupID]
+		if !ok {
+			var err error
+			if groupRules, err = m.alertsDB.GetRules(track.GroupID); err != nil {
+				log.WithError(err).Error("ALERT rules error")
+				return
+			}
+			rules[track.GroupID] = groupRules
+		}
+		m.publish(m.engine.CheckTrack(groupRules, track))
+	}
+}
+
+// CheckNoData периодически проверяет правила отсутствия данных от устройств.
+// Функция не возвращает управление и должна запускаться в отдельном потоке.
+func (m *alertMonitor) CheckNoData() {
+	for now := range time.Tick(noDataInterval) {
+		rules, err := m.alertsDB.GetRulesByType(alerts.RuleNoData)
+		if err != nil {
+			log.WithError(err).Error("ALERT rules error")
+			continue
+		}
+		m.publish(m.engine.CheckNoData(rules, now))
+	}
+}
+
+// publish сохраняет уведомления и публикует их. Уведомления, для которых уже есть
+// нерешенное уведомление по тому же правилу и устройству, пропускаются.
+func (m *alertMonitor) publish(list []alerts.Alert) {
+	for _, alert := range list {
+		logger := log.WithField("alert", alert)
+		added, err := m.alertsDB.Add(alert)
+		if err != nil {
+			logger.WithError(err).Error("ALERT error")
+			continue
+		}
+		if !added {
+			continue
+		}
+		if err := m.nce.Publish(serviceNameAlert, alert); err != nil {
+			logger.WithError(err).Error("ALERT publishing error")
+		} else {
+			logger.Debug("ALERT")
+		}
+	}
+}
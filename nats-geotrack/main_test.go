@@ -45,6 +45,7 @@ func TestSubscription(t *testing.T) {
 	defer nc.Close()
 
 	// запускаем подписку на получение данных и их обработку
+	devMode = true // тест использует тестовую группу
 	if err := subscribe(mdb, nc); err != nil {
 		log.WithError(err).Error("Error initializing NATS subscription")
 		return
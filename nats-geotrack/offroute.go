@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mdigger/geotrack/geo"
+	"github.com/mdigger/geotrack/places"
+	"github.com/mdigger/geotrack/tracks"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// OffRouteEvent описывает событие выхода устройства за пределы маршрутов.
+type OffRouteEvent struct {
+	GroupID  string          // идентификатор группы
+	DeviceID string          // уникальный идентификатор устройства
+	Time     time.Time       // временная метка
+	Location geo.Point       // координаты точки
+	PlaceIDs []bson.ObjectId // идентификаторы маршрутов, которые устройство покинуло
+}
+
+// routeMonitor отслеживает нахождение устройств на маршрутах и формирует события только
+// при выходе устройства с маршрута, на котором оно находилось, а не для каждой точки трека
+// и не для маршрутов, на которых устройство не было.
+type routeMonitor struct {
+	placesDB *places.DB
+	onRoute  map[string]map[bson.ObjectId]bool // маршруты, внутри которых находится устройство
+}
+
+// newRouteMonitor возвращает новый инициализированный монитор маршрутов.
+func newRouteMonitor(placesDB *places.DB) *routeMonitor {
+	return &routeMonitor{
+		placesDB: placesDB,
+		onRoute:  make(map[string]map[bson.ObjectId]bool),
+	}
+}
+
+// Check проверяет точку трека и возвращает событие, если устройство покинуло хотя бы
+// один из маршрутов, внутри которого находилось в предыдущей точке. Если новых выходов
+// за пределы маршрутов нет, то возвращается nil.
+func (m *routeMonitor) Check(track tracks.TrackData) (*OffRouteEvent, error) {
+	inside, outside, err := m.placesDB.Routes(track)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[bson.ObjectId]bool, len(inside))
+	for _, placeID := range inside {
+		current[placeID] = true
+	}
+	var event *OffRouteEvent
+	for _, placeID := range outside {
+		if !m.onRoute[track.DeviceID][placeID] {
+			continue // устройство не было внутри этого маршрута
+		}
+		if event == nil {
+			event = &OffRouteEvent{
+				GroupID:  track.GroupID,
+				DeviceID: track.DeviceID,
+				Time:     track.Time,
+				Location: track.Location,
+			}
+		}
+		event.PlaceIDs = append(event.PlaceIDs, placeID)
+	}
+	m.onRoute[track.DeviceID] = current
+	return event, nil
+}
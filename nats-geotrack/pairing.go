@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mdigger/geotrack/pairing"
+)
+
+// pairRequest описывает расширенный запрос ключа для привязки устройства.
+type pairRequest struct {
+	DeviceID   string // уникальный идентификатор устройства
+	Length     int    // длина ключа
+	Dictionary string // название словаря для генерации ключа
+}
+
+// pairKeyRequest описывает расширенный запрос проверки ключа привязки.
+type pairKeyRequest struct {
+	Key    string // ключ привязки
+	Caller string // источник запроса для учета неудачных попыток
+}
+
+// pairKeyResponse описывает ответ на расширенный запрос проверки ключа привязки.
+type pairKeyResponse struct {
+	DeviceID string `json:",omitempty"` // уникальный идентификатор устройства
+	Error    string `json:",omitempty"` // описание ошибки
+}
+
+// isObject возвращает true, если запрос передан в виде JSON-объекта, а не строки.
+func isObject(data string) bool {
+	return strings.HasPrefix(strings.TrimSpace(data), "{")
+}
+
+// parsePairRequest разбирает запрос ключа для привязки устройства. Запрос может быть
+// передан как строка с идентификатором устройства или как объект с параметрами ключа.
+func parsePairRequest(data string) (deviceID string, length int, dictionary pairing.Dictionary, ok bool) {
+	if !isObject(data) {
+		return data, 0, "", data != ""
+	}
+	var req pairRequest
+	if err := json.Unmarshal([]byte(data), &req); err != nil || req.DeviceID == "" {
+		return
+	}
+	if req.Dictionary != "" {
+		if dictionary, ok = pairing.Dictionaries[req.Dictionary]; !ok {
+			return
+		}
+	}
+	return req.DeviceID, req.Length, dictionary, true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/mdigger/geotrack/states"
+	"github.com/nats-io/nats"
+)
+
+// watchdogInterval задает интервал проверки отключения устройств.
+var watchdogInterval = time.Minute
+
+// watchdog отслеживает получение данных от устройств и публикует события их подключения
+// и отключения.
+type watchdog struct {
+	statesDB *states.DB
+	nce      *nats.EncodedConn
+}
+
+// newWatchdog возвращает новый инициализированный монитор подключения устройств.
+func newWatchdog(statesDB *states.DB, nce *nats.EncodedConn) *watchdog {
+	return &watchdog{statesDB: statesDB, nce: nce}
+}
+
+// Run периодически проверяет устройства и отмечает как отключенные те из них, от которых
+// давно не поступали данные. Функция не возвращает управление и должна запускаться
+// в отдельном потоке.
+func (w *watchdog) Run() {
+	for now := range time.Tick(watchdogInterval) {
+		events, err := w.statesDB.CheckOffline(now)
+		if err != nil {
+			log.WithError(err).Error("OFFLINE error")
+		}
+		w.Publish(events)
+	}
+}
+
+// Publish публикует события подключения и отключения устройств.
+func (w *watchdog) Publish(events []states.Event) {
+	for _, event := range events {
+		subject := serviceNameOffline
+		if event.Online {
+			subject = serviceNameOnline
+		}
+		logger := log.WithField("event", event)
+		if err := w.nce.Publish(subject, event); err != nil {
+			logger.WithError(err).Error("ONLINE publishing error")
+		} else {
+			logger.Debug("ONLINE")
+		}
+	}
+}
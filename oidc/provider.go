@@ -0,0 +1,331 @@
+// Package oidc реализует авторизацию пользователей через внешних провайдеров OpenID Connect
+// по схеме authorization code с PKCE.
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mdigger/geotrack/token"
+)
+
+var (
+	// HTTPClient используется для запросов к провайдерам.
+	HTTPClient = &http.Client{Timeout: time.Second * 10}
+	// DefaultScopes задает запрашиваемые по умолчанию области доступа.
+	DefaultScopes = []string{"openid", "email", "profile"}
+	// KeysRefresh задает минимальный интервал между повторными загрузками ключей провайдера.
+	KeysRefresh = time.Minute
+)
+
+var (
+	// ErrBadIDToken возвращается, если ID-токен не прошел проверку.
+	ErrBadIDToken = errors.New("invalid id token")
+	// ErrNoIDToken возвращается, если провайдер не вернул ID-токен.
+	ErrNoIDToken = errors.New("missing id token")
+)
+
+// Config описывает настройки провайдера OpenID Connect.
+type Config struct {
+	Name         string   // название провайдера в URL
+	Issuer       string   // адрес провайдера: используется для получения его описания
+	ClientID     string   // идентификатор приложения у провайдера
+	ClientSecret string   `json:",omitempty"` // секретный ключ приложения
+	RedirectURL  string   // адрес, на который провайдер возвращает код авторизации
+	Scopes       []string `json:",omitempty"` // запрашиваемые области доступа
+}
+
+// Provider описывает провайдера OpenID Connect.
+type Provider struct {
+	Config
+	AuthURL  string // адрес авторизации пользователя
+	TokenURL string // адрес получения токенов
+	JWKSURL  string // адрес открытых ключей провайдера
+
+	keys       map[string]interface{} // открытые ключи провайдера по их идентификаторам
+	keysLoaded time.Time              // время последней загрузки ключей
+	mu         sync.Mutex
+}
+
+// getJSON выполняет GET-запрос и разбирает ответ в формате JSON.
+func getJSON(url string, v interface{}) error {
+	resp, err := HTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// Discover загружает описание провайдера по адресу Issuer/.well-known/openid-configuration
+// и возвращает инициализированного провайдера.
+func Discover(config Config) (*Provider, error) {
+	if config.Name == "" || config.Issuer == "" || config.ClientID == "" {
+		return nil, errors.New("missing provider name, issuer or client id")
+	}
+	var meta struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	err := getJSON(strings.TrimSuffix(config.Issuer, "/")+"/.well-known/openid-configuration", &meta)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Issuer != config.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: %q", meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("incomplete provider metadata")
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+	return &Provider{
+		Config:   config,
+		AuthURL:  meta.AuthorizationEndpoint,
+		TokenURL: meta.TokenEndpoint,
+		JWKSURL:  meta.JWKSURI,
+	}, nil
+}
+
+// randomString возвращает случайную строку в кодировке base64url.
+func randomString(size int) string {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Challenge возвращает значение code_challenge для PKCE по методу S256.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL возвращает адрес для перенаправления пользователя на авторизацию у провайдера.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	if strings.Contains(p.AuthURL, "?") {
+		return p.AuthURL + "&" + params.Encode()
+	}
+	return p.AuthURL + "?" + params.Encode()
+}
+
+// Exchange обменивает код авторизации на токены провайдера и возвращает ID-токен.
+func (p *Provider) Exchange(code, verifier string) (string, error) {
+	params := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest("POST", p.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("token response: %s", resp.Status)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("token error: %s %s", result.Error, result.Description)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token response: %s", resp.Status)
+	}
+	if result.IDToken == "" {
+		return "", ErrNoIDToken
+	}
+	return result.IDToken, nil
+}
+
+// Identity описывает пользователя, авторизованного провайдером.
+type Identity struct {
+	Issuer        string // провайдер
+	Subject       string // идентификатор пользователя у провайдера
+	Email         string // адрес электронной почты
+	EmailVerified bool   // адрес электронной почты подтвержден провайдером
+	Name          string // имя пользователя
+}
+
+// Verify проверяет подпись и содержимое ID-токена и возвращает информацию о пользователе.
+func (p *Provider) Verify(idToken, nonce string) (*Identity, error) {
+	parsed, err := jwt.Parse(idToken, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims := parsed.Claims
+	if _, ok := claims["exp"]; !ok {
+		return nil, ErrBadIDToken
+	}
+	if claims["iss"] != p.Issuer || !hasAudience(claims["aud"], p.ClientID) {
+		return nil, ErrBadIDToken
+	}
+	if nonce != "" && claims["nonce"] != nonce {
+		return nil, ErrBadIDToken
+	}
+	identity := &Identity{Issuer: p.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string: // некоторые провайдеры отдают значение строкой
+		identity.EmailVerified = verified == "true"
+	}
+	if identity.Subject == "" {
+		return nil, ErrBadIDToken
+	}
+	return identity, nil
+}
+
+// hasAudience возвращает true, если токен выдан для указанного приложения.
+func hasAudience(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, item := range aud {
+			if item == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key возвращает открытый ключ провайдера с указанным идентификатором. Если ключ не найден,
+// то ключи провайдера загружаются повторно, но не чаще чем раз в KeysRefresh.
+func (p *Provider) key(kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysLoaded) < KeysRefresh {
+		return nil, token.ErrUnknownKey
+	}
+	var jwks token.JWKS
+	if err := getJSON(p.JWKSURL, &jwks); err != nil {
+		return nil, err
+	}
+	p.keysLoaded = time.Now()
+	p.keys = make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := publicKey(jwk); err == nil {
+			p.keys[jwk.Kid] = key
+		}
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, token.ErrUnknownKey
+}
+
+// publicKey возвращает открытый ключ из его описания в формате JSON Web Key.
+func publicKey(jwk *token.JWK) (interface{}, error) {
+	decode := func(s string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %v", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %v", jwk.Kty)
+	}
+}
@@ -0,0 +1,190 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mdigger/geotrack/token"
+)
+
+// mockProvider описывает тестовый провайдер OpenID Connect.
+type mockProvider struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	codes map[string]url.Values // параметры запросов авторизации по выданным кодам
+	mu    sync.Mutex
+}
+
+const (
+	mockClientID     = "geotrack"
+	mockClientSecret = "secret"
+	mockRedirectURL  = "https://example.com/api/v1/oidc/mock/callback"
+)
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{key: key, codes: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		keys, _ := token.NewKeySet(token.NewRSAKey("mock", p.key))
+		json.NewEncoder(w).Encode(keys.JWKS())
+	})
+	// пользователь авторизуется сразу и возвращается с кодом авторизации
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("client_id") != mockClientID || query.Get("redirect_uri") != mockRedirectURL ||
+			query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		code := randomString(16)
+		p.mu.Lock()
+		p.codes[code] = query
+		p.mu.Unlock()
+		http.Redirect(w, r, mockRedirectURL+"?"+url.Values{
+			"code":  {code},
+			"state": {query.Get("state")},
+		}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		fail := func(code string) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": code})
+		}
+		clientID, secret, _ := r.BasicAuth()
+		if clientID != mockClientID || secret != mockClientSecret {
+			fail("invalid_client")
+			return
+		}
+		p.mu.Lock()
+		query, ok := p.codes[r.PostFormValue("code")]
+		delete(p.codes, r.PostFormValue("code")) // код используется только один раз
+		p.mu.Unlock()
+		if !ok || r.PostFormValue("grant_type") != "authorization_code" ||
+			r.PostFormValue("redirect_uri") != query.Get("redirect_uri") ||
+			Challenge(r.PostFormValue("code_verifier")) != query.Get("code_challenge") {
+			fail("invalid_grant")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     p.idToken(t, p.key, mockClientID, query.Get("nonce")),
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// idToken возвращает ID-токен тестового пользователя.
+func (p *mockProvider) idToken(t *testing.T, key *rsa.PrivateKey, audience, nonce string) string {
+	token := jwt.New(jwt.SigningMethodRS256)
+	token.Header["kid"] = "mock"
+	token.Claims["iss"] = p.URL
+	token.Claims["sub"] = "user-1"
+	token.Claims["aud"] = audience
+	token.Claims["nonce"] = nonce
+	token.Claims["email"] = "user@example.com"
+	token.Claims["email_verified"] = true
+	token.Claims["name"] = "Test User"
+	token.Claims["iat"] = time.Now().Unix()
+	token.Claims["exp"] = time.Now().Add(time.Minute).Unix()
+	data, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// authorize выполняет авторизацию у тестового провайдера и возвращает полученный код.
+func authorize(t *testing.T, authURL, state string) string {
+	req, err := http.NewRequest("GET", authURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// перенаправление на адрес возврата не выполняется
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Query().Get("state") != state {
+		t.Fatalf("bad state: %v", location)
+	}
+	return location.Query().Get("code")
+}
+
+func TestProvider(t *testing.T) {
+	mock := newMockProvider(t)
+	defer mock.Close()
+
+	provider, err := Discover(Config{
+		Name:         "mock",
+		Issuer:       mock.URL,
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		RedirectURL:  mockRedirectURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := NewState(provider.Name)
+	code := authorize(t, state.AuthCodeURL(provider), state.ID)
+	idToken, err := provider.Exchange(code, state.Verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := provider.Verify(idToken, state.Nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Issuer != mock.URL || identity.Subject != "user-1" ||
+		identity.Email != "user@example.com" || !identity.EmailVerified || identity.Name != "Test User" {
+		t.Errorf("bad identity: %+v", identity)
+	}
+	// код авторизации можно использовать только один раз
+	if _, err := provider.Exchange(code, state.Verifier); err == nil {
+		t.Error("authorization code reused")
+	}
+	// без правильного code_verifier код не обменивается на токены
+	code = authorize(t, state.AuthCodeURL(provider), state.ID)
+	if _, err := provider.Exchange(code, NewState(provider.Name).Verifier); err == nil {
+		t.Error("bad code verifier accepted")
+	}
+	if _, err := provider.Verify(idToken, "other nonce"); err != ErrBadIDToken {
+		t.Errorf("bad nonce accepted: %v", err)
+	}
+	if _, err := provider.Verify(mock.idToken(t, mock.key, "other", state.Nonce), state.Nonce); err != ErrBadIDToken {
+		t.Errorf("bad audience accepted: %v", err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Verify(mock.idToken(t, other, mockClientID, state.Nonce), state.Nonce); err == nil {
+		t.Error("bad signature accepted")
+	}
+}
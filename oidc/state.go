@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mdigger/geotrack/mongo"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	StatesCollectionName = "oidc.states"    // коллекция с состояниями незавершенных авторизаций
+	StateExpire          = time.Minute * 10 // время на авторизацию у провайдера
+)
+
+// ErrBadState возвращается, если состояние авторизации не найдено или устарело.
+var ErrBadState = errors.New("invalid or expired state")
+
+// State описывает состояние авторизации пользователя у провайдера между перенаправлением
+// на провайдера и возвратом от него.
+type State struct {
+	ID       string        `bson:"_id"` // значение параметра state
+	Provider string        // название провайдера
+	Verifier string        // code_verifier для PKCE
+	Nonce    string        // значение nonce для проверки ID-токена
+	UserID   bson.ObjectId `bson:",omitempty"` // пользователь, к которому привязывается учетная запись
+	Created  time.Time     // время создания
+}
+
+// NewState возвращает новое состояние авторизации со случайными значениями state, nonce и
+// code_verifier.
+func NewState(provider string) *State {
+	return &State{
+		ID:       randomString(24),
+		Provider: provider,
+		Verifier: randomString(32),
+		Nonce:    randomString(16),
+		Created:  time.Now(),
+	}
+}
+
+// AuthCodeURL возвращает адрес для перенаправления пользователя на авторизацию у провайдера
+// с этим состоянием.
+func (s *State) AuthCodeURL(p *Provider) string {
+	return p.AuthCodeURL(s.ID, s.Nonce, s.Verifier)
+}
+
+// DB описывает хранилище состояний авторизации в MongoDB.
+type DB struct {
+	*mongo.DB // соединение с MongoDB
+}
+
+// InitDB инициализирует хранилище состояний авторизации. Устаревшие состояния удаляются
+// MongoDB автоматически.
+func InitDB(mdb *mongo.DB) (db *DB, err error) {
+	db = &DB{mdb}
+	coll := mdb.GetCollection(StatesCollectionName)
+	err = coll.EnsureIndex(mgo.Index{
+		Key:         []string{"created"},
+		ExpireAfter: StateExpire,
+	})
+	mdb.FreeCollection(coll)
+	return
+}
+
+// SaveState сохраняет состояние авторизации.
+func (db *DB) SaveState(state *State) (err error) {
+	coll := db.GetCollection(StatesCollectionName)
+	err = coll.Insert(state)
+	db.FreeCollection(coll)
+	return
+}
+
+// TakeState возвращает состояние авторизации для указанного провайдера и удаляет его:
+// каждое состояние может быть использовано только один раз.
+func (db *DB) TakeState(provider, id string) (state *State, err error) {
+	coll := db.GetCollection(StatesCollectionName)
+	state = new(State)
+	_, err = coll.Find(bson.M{
+		"_id":      id,
+		"provider": provider,
+		"created":  bson.M{"$gt": time.Now().Add(-StateExpire)},
+	}).Apply(mgo.Change{Remove: true}, state)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		return nil, ErrBadState
+	}
+	return
+}
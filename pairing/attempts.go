@@ -0,0 +1,86 @@
+package pairing
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	MaxCallerAttempts = 10               // количество неудачных попыток с одного источника
+	MaxKeyAttempts    = 1000             // неудачных попыток со всех источников за время жизни ключа
+	AttemptsWindow    = time.Minute * 15 // период учета неудачных попыток и время блокировки
+)
+
+// ErrLocked возвращается, если превышено количество неудачных попыток привязки.
+var ErrLocked = errors.New("too many pairing attempts")
+
+// Причины неудачных попыток привязки.
+const (
+	ReasonNotFound = "not found" // ключ не найден
+	ReasonExpired  = "expired"   // время жизни ключа истекло
+	ReasonLocked   = "locked"    // превышено количество попыток
+	ReasonGuessed  = "guessed"   // ключ отклонен после множества попыток подбора
+)
+
+// Attempt описывает неудачную попытку привязки устройства.
+type Attempt struct {
+	Caller string    `json:",omitempty"` // источник запроса
+	Key    string    // проверяемый ключ
+	Reason string    // причина неудачи
+	Time   time.Time // время попытки
+}
+
+// fail сохраняет информацию о неудачной попытке привязки.
+func (p *Pairs) fail(store Store, caller, key, reason string) error {
+	return store.Fail(&Attempt{
+		Caller: caller,
+		Key:    key,
+		Reason: reason,
+		Time:   time.Now(),
+	})
+}
+
+// Check возвращает уникальный идентификатор устройства, связанный с указанным ключем
+// активации, и удаляет ключ. Если такого устройства не найдено или ключ просрочен, то
+// возвращается пустая строка, а неудачная попытка сохраняется.
+//
+// Если количество неудачных попыток с указанного источника за AttemptsWindow превышает
+// допустимое, то ключ не проверяется и возвращается ErrLocked. Все запросы без указания
+// источника учитываются как запросы с одного источника. Заблокированные запросы не
+// учитываются, поэтому блокировка снимается через AttemptsWindow после последней неудачи.
+//
+// Подбираемые ключи каждый раз разные, поэтому от подбора с многих источников защищает
+// ограничение для выданного ключа: если с момента его выдачи со всех источников было
+// сделано MaxKeyAttempts неудачных попыток, то ключ считается подобранным и отклоняется,
+// а устройство должно получить новый ключ. Проверка других ключей при этом не блокируется.
+func (p *Pairs) Check(caller, key string) (string, error) {
+	store := p.store()
+	byCaller, _, err := store.Failures(caller, time.Now().Add(-AttemptsWindow))
+	if err != nil {
+		return "", err
+	}
+	if byCaller >= MaxCallerAttempts {
+		if err := p.fail(store, caller, key, ReasonLocked); err != nil {
+			return "", err
+		}
+		return "", ErrLocked
+	}
+	info, err := store.Take(key)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case info == nil:
+		return "", p.fail(store, caller, key, ReasonNotFound)
+	case info.Expired():
+		return "", p.fail(store, caller, key, ReasonExpired)
+	}
+	_, total, err := store.Failures(caller, info.Time)
+	if err != nil {
+		return "", err
+	}
+	if total >= MaxKeyAttempts {
+		return "", p.fail(store, caller, key, ReasonGuessed)
+	}
+	return info.DeviceID, nil
+}
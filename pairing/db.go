@@ -0,0 +1,156 @@
+package pairing
+
+import (
+	"time"
+
+	"github.com/mdigger/geotrack/mongo"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	// CollectionName описывает название коллекции с ключами для спаривания устройств.
+	CollectionName = "pairing"
+	// AttemptsCollectionName описывает название коллекции с неудачными попытками привязки.
+	AttemptsCollectionName = "pairing.attempts"
+	// AttemptsExpireAfter задает время хранения информации о неудачных попытках привязки.
+	AttemptsExpireAfter = time.Hour * 24 * 30
+)
+
+// DB описывает хранилище ключей в MongoDB. В отличие от хранилища в памяти, ключи
+// сохраняются при перезапуске сервиса и могут использоваться несколькими его копиями.
+type DB struct {
+	*mongo.DB // соединение с MongoDB
+}
+
+// InitDB инициализирует хранилище ключей в MongoDB. Ключи автоматически удаляются
+// MongoDB после истечения времени их жизни, а информация о неудачных попытках привязки —
+// по истечении AttemptsExpireAfter.
+//
+// Необходимо обратить внимание, что значение KeyExpired используется при создании индекса
+// удаления данных, поэтому его изменение вступит в силу только при пересоздании индекса.
+func InitDB(mdb *mongo.DB) (db *DB, err error) {
+	db = &DB{mdb}
+	coll := mdb.GetCollection(CollectionName)
+	defer mdb.FreeCollection(coll)
+	if err = coll.EnsureIndex(mgo.Index{
+		Key:         []string{"time"},
+		ExpireAfter: KeyExpired,
+	}); err != nil {
+		return
+	}
+	if err = coll.EnsureIndex(mgo.Index{
+		Key:    []string{"key"},
+		Unique: true,
+	}); err != nil {
+		return
+	}
+	// ранее индекс по устройству не был уникальным: его необходимо пересоздать
+	indexes, err := coll.Indexes()
+	if err != nil {
+		return
+	}
+	for _, index := range indexes {
+		if len(index.Key) == 1 && index.Key[0] == "deviceid" && !index.Unique {
+			if err = coll.DropIndexName(index.Name); err != nil {
+				return
+			}
+		}
+	}
+	if err = coll.EnsureIndex(mgo.Index{
+		Key:    []string{"deviceid"},
+		Unique: true,
+	}); err != nil {
+		return
+	}
+	coll = mdb.GetCollection(AttemptsCollectionName)
+	defer mdb.FreeCollection(coll)
+	if err = coll.EnsureIndex(mgo.Index{
+		Key:         []string{"time"},
+		ExpireAfter: AttemptsExpireAfter,
+	}); err != nil {
+		return
+	}
+	err = coll.EnsureIndexKey("caller", "time")
+	return
+}
+
+// Add сохраняет новый ключ для устройства, заменяя ранее сохраненный ключ этого устройства.
+// Уникальность ключа и устройства обеспечивается индексами, поэтому несколько копий сервиса
+// не могут выдать одинаковые ключи или два ключа для одного устройства.
+func (db *DB) Add(info *KeyInfo) (bool, error) {
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	added, err := upsertKey(coll, info)
+	if added || err != nil {
+		return added, err
+	}
+	// MongoDB удаляет устаревшие записи не сразу, поэтому удаляем устаревший ключ сами
+	err = coll.Remove(bson.M{
+		"key":      info.Key,
+		"deviceid": bson.M{"$ne": info.DeviceID},
+		"time":     bson.M{"$lte": time.Now().Add(-KeyExpired)},
+	})
+	if err == mgo.ErrNotFound {
+		return false, nil // ключ используется и не устарел
+	}
+	if err != nil {
+		return false, err
+	}
+	return upsertKey(coll, info)
+}
+
+// upsertKey атомарно заменяет ключ устройства или сохраняет новый. Если такой же ключ уже
+// используется другим устройством или ключ устройства одновременно сохраняется другой копией
+// сервиса, то ключ не сохраняется и возвращается false.
+func upsertKey(coll *mgo.Collection, info *KeyInfo) (bool, error) {
+	_, err := coll.Find(bson.M{"deviceid": info.DeviceID}).
+		Apply(mgo.Change{Update: info, Upsert: true}, nil)
+	if mgo.IsDup(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Take возвращает информацию о ключе и удаляет его из хранилища.
+func (db *DB) Take(key string) (*KeyInfo, error) {
+	coll := db.GetCollection(CollectionName)
+	info := new(KeyInfo)
+	_, err := coll.Find(bson.M{"key": key}).Select(bson.M{"_id": 0}).
+		Apply(mgo.Change{Remove: true}, info)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Fail сохраняет информацию о неудачной попытке привязки.
+func (db *DB) Fail(attempt *Attempt) (err error) {
+	coll := db.GetCollection(AttemptsCollectionName)
+	err = coll.Insert(attempt)
+	db.FreeCollection(coll)
+	return
+}
+
+// Failures возвращает количество неудачных попыток привязки.
+func (db *DB) Failures(caller string, since time.Time) (byCaller, total int, err error) {
+	coll := db.GetCollection(AttemptsCollectionName)
+	defer db.FreeCollection(coll)
+	byCaller, err = coll.Find(bson.M{
+		"caller": caller,
+		"time":   bson.M{"$gte": since},
+		"reason": bson.M{"$ne": ReasonLocked},
+	}).Count()
+	if err != nil {
+		return
+	}
+	total, err = coll.Find(bson.M{
+		"time":   bson.M{"$gte": since},
+		"reason": bson.M{"$ne": ReasonLocked},
+	}).Count()
+	return
+}
@@ -0,0 +1,54 @@
+package pairing
+
+import (
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdigger/geotrack/mongo"
+)
+
+func TestDB(t *testing.T) {
+	mdb, err := mongo.Connect("mongodb://localhost/watch")
+	if err != nil {
+		log.Println("Error connecting to MongoDB:", err)
+		return
+	}
+	defer mdb.Close()
+
+	db, err := InitDB(mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs := Pairs{Store: db}
+	key := pairs.Generate("test0123456789")
+	if key == "" {
+		t.Fatal("empty key")
+	}
+	if id := pairs.GetDeviceID(key); id != "test0123456789" {
+		t.Errorf("bad device id: %q", id)
+	}
+	if id := pairs.GetDeviceID(key); id != "" {
+		t.Error("key is not deleted")
+	}
+	// новый ключ устройства заменяет ранее выданный
+	first := pairs.Generate("test0123456789")
+	second := pairs.Generate("test0123456789")
+	if first == "" || second == "" {
+		t.Fatal("empty key")
+	}
+	if id := pairs.GetDeviceID(first); id != "" {
+		t.Error("old key is not replaced")
+	}
+	// ключ, выданный другому устройству, не сохраняется
+	added, err := db.Add(&KeyInfo{DeviceID: "test9876543210", Key: second, Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added {
+		t.Error("duplicate key added")
+	}
+	if id := pairs.GetDeviceID(second); id != "test0123456789" {
+		t.Errorf("bad device id: %q", id)
+	}
+}
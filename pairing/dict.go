@@ -1,25 +1,28 @@
 package pairing
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"math/big"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 // Dictionary описывает словарь символов, из которых может генерироваться код для активации.
 // Для простоты я не стал проверять словарь на то, что он содержит юникодные символы, описывающиеся
 // несколькими байтами, поэтому для корректной работы рекомендуется, чтобы в словаре использовались
 // только печатные ASCII символы.
 type Dictionary string
 
-// Generate возвращает случайный набор символов из словаря заданной длинны.
+// Generate возвращает случайный набор символов из словаря заданной длинны. Для генерации
+// используется криптографически стойкий генератор случайных чисел. В случае ошибки
+// генератора возвращается пустая строка.
 func (d Dictionary) Generate(length int) string {
+	max := big.NewInt(int64(len(d)))
 	response := make([]byte, length)
 	for i := range response {
-		response[i] = d[rand.Intn(len(d))] // заполняем случайным набором из словаря
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return ""
+		}
+		response[i] = d[n.Int64()] // заполняем случайным набором из словаря
 	}
 	return string(response)
 }
@@ -30,3 +33,9 @@ var (
 	DictAlfa               = DictNumber + "ABCDEFGHIJKLMNOPQRSTUVWXYZ" // цифры и буквы
 	DictDefault            = DictNumber                                // словарь по умолчанию
 )
+
+// Dictionaries содержит именованные словари, которые можно указать при запросе ключа.
+var Dictionaries = map[string]Dictionary{
+	"number": DictNumber,
+	"alfa":   DictAlfa,
+}
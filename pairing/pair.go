@@ -6,96 +6,209 @@ import (
 )
 
 var (
-	KeyLength    = 4                // длина ключа
+	KeyLength    = 6                // длина ключа по умолчанию
+	MinKeyLength = 4                // минимальная длина ключа
+	MaxKeyLength = 16               // максимальная длина ключа
 	KeyExpired   = time.Minute * 30 // время жизни ключа
 	MaxIterCount = 1000             // максимальное количество попыток генерации нового ключа
 )
 
-const initialCount = 100 // изначально выделяем память для хранения стольких одновременных ключей
-
-// keyInfo содержит информацию об устройстве и времени генерации ключа.
-type keyInfo struct {
+// KeyInfo содержит информацию об устройстве и времени генерации ключа.
+type KeyInfo struct {
 	DeviceID string    // уникальный идентификатор устройства
 	Key      string    // уникальный ключ
 	Time     time.Time // время генерации ключа
 }
 
-// Pairs описывает список ключей для спаривания устройств.
+// Expired возвращает true, если время жизни ключа истекло.
+func (k *KeyInfo) Expired() bool {
+	return time.Since(k.Time) >= KeyExpired
+}
+
+// Store описывает интерфейс хранилища ключей для спаривания устройств.
+type Store interface {
+	// Add сохраняет новый ключ для устройства, удаляя ранее сохраненный ключ этого
+	// устройства. Если такой же ключ уже используется и его время жизни еще не истекло,
+	// то ключ не сохраняется и возвращается false.
+	Add(info *KeyInfo) (bool, error)
+	// Take возвращает информацию о ключе и удаляет его из хранилища. Если ключ
+	// не найден, то возвращается nil.
+	Take(key string) (*KeyInfo, error)
+	// Fail сохраняет информацию о неудачной попытке привязки.
+	Fail(attempt *Attempt) error
+	// Failures возвращает количество неудачных попыток привязки с указанного источника и
+	// общее количество неудачных попыток, начиная с заданного времени. Заблокированные
+	// попытки не учитываются.
+	Failures(caller string, since time.Time) (byCaller, total int, err error)
+}
+
+// Pairs описывает список ключей для спаривания устройств. Если хранилище ключей не задано,
+// то ключи хранятся в памяти.
 type Pairs struct {
-	Dictionary                     // словарь букв ключа для генерации
-	devices    map[string]*keyInfo // справочник ключей для устройств
-	keys       map[string]*keyInfo // справочник устройств по сгенерированным ключам
+	Dictionary       // словарь букв ключа для генерации
+	Store      Store // хранилище ключей
 	mu         sync.Mutex
 }
 
+// store возвращает хранилище ключей, инициализируя хранилище в памяти, если оно не задано.
+func (p *Pairs) store() Store {
+	p.mu.Lock()
+	if p.Store == nil {
+		p.Store = NewMemoryStore()
+	}
+	store := p.Store
+	p.mu.Unlock()
+	return store
+}
+
 // Generate возвращает новый уникальный ключ для спаривания устройства.
 //
 // Если ключ для этого устройства уже был сгенерирован, то старый ключ удаляется и становится
-// не действительным, а создается новый ключ, привязанный к этому устройству. Так же автоматически
-// удаляются те ключи, которые уже устарели. Если новый ключ не удается получить за заданное
-// количество попыток, то возвращается пустое значение ключа, так что необходима проверка.
-//
-// Параллельное выполнение нескольких функций генерации блокируется. Но, т.к. это достаточно
-// быстрый процесс, то обычно это никак не сказывается на производительности.
-func (p *Pairs) Generate(deviceID string) (key string) {
-	p.mu.Lock() // одновременно выполняется только одна копия
-	// инициализируем списки ключей и словарь, если они не были инициализированы до этого
-	if p.devices == nil {
-		p.devices = make(map[string]*keyInfo, initialCount)
+// не действительным, а создается новый ключ, привязанный к этому устройству. Ключи, время
+// жизни которых истекло, могут быть выданы повторно. Если новый ключ не удается получить
+// за заданное количество попыток или произошла ошибка хранилища, то возвращается пустое
+// значение ключа, так что необходима проверка.
+func (p *Pairs) Generate(deviceID string) string {
+	return p.GenerateKey(deviceID, 0, "")
+}
+
+// GenerateKey возвращает новый уникальный ключ заданной длины из символов указанного словаря.
+// Если длина или словарь не заданы, то используются значения по умолчанию. Если длина ключа
+// выходит за допустимые пределы, то возвращается пустая строка.
+func (p *Pairs) GenerateKey(deviceID string, length int, dictionary Dictionary) string {
+	if length == 0 {
+		length = KeyLength
 	}
-	if p.keys == nil {
-		p.keys = make(map[string]*keyInfo, initialCount)
+	if length < MinKeyLength || length > MaxKeyLength {
+		return ""
 	}
-	if len(p.Dictionary) == 0 {
-		p.Dictionary = DictDefault // инициализируем словарь, если он не инициализирован
+	if len(dictionary) == 0 {
+		dictionary = p.Dictionary
 	}
-	// проверяем, что для данного устройства нет сгенерированного ключа
-	if kInfo, ok := p.devices[deviceID]; ok {
-		delete(p.keys, kInfo.Key) // удаляем ключ из списка
-		delete(p.devices, kInfo.DeviceID)
-		// log.Printf("Delete key for %q", deviceID)
+	if len(dictionary) == 0 {
+		dictionary = DictDefault // используем словарь по умолчанию, если он не задан
 	}
+	store := p.store()
 	// делаем несколько попыток генерации нового уникального ключа
 	for i := 0; i < MaxIterCount; i++ {
-		key = p.Dictionary.Generate(KeyLength) // генерируем случайный ключ по словарю
-		// проверяем, что этот ключ сейчас не используется
-		if kInfo, ok := p.keys[key]; ok {
-			if time.Since(kInfo.Time) < KeyExpired {
-				continue // время жизни ключа еще не истекло — пробуем дальше
-			}
-			// ключ используется, но устарел — удаляем записи о нем
-			delete(p.keys, kInfo.Key) // удаляем ключ из списка
-			delete(p.devices, kInfo.DeviceID)
-			// log.Printf("Delete expired key %q", key)
+		key := dictionary.Generate(length) // генерируем случайный ключ по словарю
+		if key == "" {
+			return "" // ошибка генератора случайных чисел
 		}
-		// сгенерированный ключ можно использовать как новый
-		kInfo := &keyInfo{
+		added, err := store.Add(&KeyInfo{
 			DeviceID: deviceID,
 			Key:      key,
 			Time:     time.Now(),
+		})
+		if err != nil {
+			return ""
+		}
+		if added {
+			return key
 		}
-		// заносим его в справочник ключей для устройств
-		p.devices[deviceID] = kInfo
-		p.keys[key] = kInfo
-		// log.Printf("Add new key %q for device %q", key, deviceID)
-		break
 	}
-	p.mu.Unlock()
-	return
+	return ""
 }
 
 // GetDeviceID возвращает уникальный идентификатор устройства, связанный с указанным ключем
 // активации. При этом запись об этом устройстве из базы удаляется. Если такого устройства не
-// найдено или ключ просрочен, то возвращается пустая строка.
-func (p *Pairs) GetDeviceID(key string) (deviceID string) {
-	p.mu.Lock()
-	if kInfo, ok := p.keys[key]; ok {
-		delete(p.keys, kInfo.Key)
-		delete(p.devices, kInfo.DeviceID)
-		if time.Since(kInfo.Time) < KeyExpired {
-			deviceID = kInfo.DeviceID
+// найдено, ключ просрочен или заблокирован, то возвращается пустая строка.
+//
+// Все такие запросы учитываются как запросы с одного источника: для учета источника
+// запросов необходимо использовать Check.
+func (p *Pairs) GetDeviceID(key string) string {
+	deviceID, _ := p.Check("", key)
+	return deviceID
+}
+
+const initialCount = 100 // изначально выделяем память для хранения стольких одновременных ключей
+
+// MemoryStore описывает хранилище ключей в памяти. Безопасно для одновременного использования,
+// но ключи не сохраняются при перезапуске и не разделяются между несколькими процессами.
+type MemoryStore struct {
+	devices  map[string]*KeyInfo // справочник ключей для устройств
+	keys     map[string]*KeyInfo // справочник устройств по сгенерированным ключам
+	attempts []*Attempt          // неудачные попытки привязки
+	mu       sync.Mutex
+}
+
+// NewMemoryStore возвращает новое хранилище ключей в памяти.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		devices: make(map[string]*KeyInfo, initialCount),
+		keys:    make(map[string]*KeyInfo, initialCount),
+	}
+}
+
+// Add сохраняет новый ключ для устройства.
+func (s *MemoryStore) Add(info *KeyInfo) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// удаляем ранее сгенерированный ключ для данного устройства
+	if old, ok := s.devices[info.DeviceID]; ok {
+		s.delete(old)
+	}
+	// проверяем, что этот ключ сейчас не используется
+	if old, ok := s.keys[info.Key]; ok {
+		if !old.Expired() {
+			return false, nil // время жизни ключа еще не истекло
 		}
+		s.delete(old) // ключ используется, но устарел — удаляем записи о нем
 	}
-	p.mu.Unlock()
+	s.devices[info.DeviceID] = info
+	s.keys[info.Key] = info
+	return true, nil
+}
+
+// Take возвращает информацию о ключе и удаляет его из хранилища.
+func (s *MemoryStore) Take(key string) (*KeyInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.keys[key]
+	if !ok {
+		return nil, nil
+	}
+	s.delete(info)
+	return info, nil
+}
+
+// delete удаляет записи о ключе.
+func (s *MemoryStore) delete(info *KeyInfo) {
+	delete(s.keys, info.Key)
+	delete(s.devices, info.DeviceID)
+}
+
+// Fail сохраняет информацию о неудачной попытке привязки. Попытки хранятся только
+// в течение AttemptsWindow.
+func (s *MemoryStore) Fail(attempt *Attempt) error {
+	s.mu.Lock()
+	s.expire(time.Now().Add(-AttemptsWindow))
+	s.attempts = append(s.attempts, attempt)
+	s.mu.Unlock()
+	return nil
+}
+
+// Failures возвращает количество неудачных попыток привязки.
+func (s *MemoryStore) Failures(caller string, since time.Time) (byCaller, total int, err error) {
+	s.mu.Lock()
+	for _, attempt := range s.attempts {
+		if attempt.Time.Before(since) || attempt.Reason == ReasonLocked {
+			continue
+		}
+		if attempt.Caller == caller {
+			byCaller++
+		}
+		total++
+	}
+	s.mu.Unlock()
 	return
 }
+
+// expire удаляет информацию о попытках, сделанных раньше указанного времени.
+func (s *MemoryStore) expire(before time.Time) {
+	i := 0
+	for i < len(s.attempts) && s.attempts[i].Time.Before(before) {
+		i++
+	}
+	s.attempts = s.attempts[i:]
+}
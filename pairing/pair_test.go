@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"testing"
+	"time"
 )
 
 func TestPairs(t *testing.T) {
@@ -15,3 +16,89 @@ func TestPairs(t *testing.T) {
 		fmt.Println(deviceID, key, pairs.GetDeviceID(key))
 	}
 }
+
+func TestMemoryStore(t *testing.T) {
+	pairs := Pairs{Store: NewMemoryStore()}
+	key := pairs.Generate("device")
+	if key == "" {
+		t.Fatal("empty key")
+	}
+	// повторная генерация ключа удаляет предыдущий ключ устройства
+	key2 := pairs.Generate("device")
+	if key2 != key && pairs.GetDeviceID(key) != "" {
+		t.Error("old key is active")
+	}
+	if id := pairs.GetDeviceID(key2); id != "device" {
+		t.Errorf("bad device id: %q", id)
+	}
+	if id := pairs.GetDeviceID(key2); id != "" {
+		t.Error("key is not deleted")
+	}
+	// просроченный ключ не возвращает устройство и может быть выдан повторно
+	store := NewMemoryStore()
+	old := &KeyInfo{DeviceID: "old", Key: "1234", Time: time.Now().Add(-KeyExpired)}
+	if added, _ := store.Add(old); !added {
+		t.Fatal("key not added")
+	}
+	if added, _ := store.Add(&KeyInfo{DeviceID: "new", Key: "1234", Time: time.Now()}); !added {
+		t.Error("expired key is not reused")
+	}
+	if added, _ := store.Add(&KeyInfo{DeviceID: "other", Key: "1234", Time: time.Now()}); added {
+		t.Error("active key is reused")
+	}
+	pairs = Pairs{Store: store}
+	if pairs.GetDeviceID("1234") != "new" {
+		t.Error("bad reused key")
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	pairs := Pairs{Store: NewMemoryStore()}
+	if pairs.GenerateKey("device", MinKeyLength-1, "") != "" {
+		t.Error("short key generated")
+	}
+	key := pairs.GenerateKey("device", 8, DictAlfa)
+	if len(key) != 8 {
+		t.Fatalf("bad key length: %q", key)
+	}
+	// с одного источника допускается ограниченное количество неудачных попыток
+	for i := 0; i < MaxCallerAttempts; i++ {
+		if id, err := pairs.Check("user", fmt.Sprintf("bad%02d", i)); id != "" || err != nil {
+			t.Fatalf("unexpected result: %q, %v", id, err)
+		}
+	}
+	if _, err := pairs.Check("user", key); err != ErrLocked {
+		t.Errorf("caller is not locked: %v", err)
+	}
+	if id, err := pairs.Check("other", key); id != "device" || err != nil {
+		t.Errorf("bad check by other caller: %q, %v", id, err)
+	}
+	// запросы без указания источника учитываются как запросы с одного источника
+	key = pairs.Generate("device")
+	for i := 0; i < MaxCallerAttempts; i++ {
+		if id, err := pairs.Check("", fmt.Sprintf("anon%02d", i)); id != "" || err != nil {
+			t.Fatalf("unexpected result: %q, %v", id, err)
+		}
+	}
+	if _, err := pairs.Check("", key); err != ErrLocked {
+		t.Errorf("requests without caller are not locked: %v", err)
+	}
+	// заблокированные запросы не продлевают блокировку
+	if byCaller, _, _ := pairs.Store.Failures("", time.Now().Add(-AttemptsWindow)); byCaller != MaxCallerAttempts {
+		t.Errorf("locked attempts counted: %d", byCaller)
+	}
+	// после многих неудачных попыток с разных источников выданный ключ отклоняется,
+	// но другие источники не блокируются
+	key = pairs.Generate("device")
+	for i := 0; i < MaxKeyAttempts; i++ {
+		pairs.Store.Fail(&Attempt{Caller: fmt.Sprintf("caller%d", i), Key: fmt.Sprintf("key%04d", i),
+			Reason: ReasonNotFound, Time: time.Now()})
+	}
+	if id, err := pairs.Check("another", key); id != "" || err != nil {
+		t.Errorf("guessed key accepted: %q, %v", id, err)
+	}
+	key = pairs.Generate("device")
+	if id, err := pairs.Check("another", key); id != "device" || err != nil {
+		t.Errorf("new key rejected: %q, %v", id, err)
+	}
+}
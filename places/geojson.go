@@ -0,0 +1,253 @@
+package places
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mdigger/geotrack/geo"
+)
+
+// Названия свойств, используемых при импорте и экспорте мест.
+const (
+	PropName     = "name"     // название
+	PropCategory = "category" // категория
+	PropIcon     = "icon"     // иконка
+	PropColor    = "color"    // цвет
+	PropAddress  = "address"  // адрес
+	PropNotes    = "notes"    // заметки
+	PropRadius   = "radius"   // радиус круга в метрах
+	PropWidth    = "width"    // ширина буферной зоны маршрута в метрах
+)
+
+// FeatureCollection описывает коллекцию объектов в формате GeoJSON.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature описывает объект в формате GeoJSON.
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id,omitempty"`
+	Geometry   *Geometry              `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry описывает геометрию объекта в формате GeoJSON.
+type Geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// FeatureError описывает ошибку импорта отдельного объекта.
+type FeatureError struct {
+	Index int    // порядковый номер объекта, начиная с 0
+	Name  string `json:",omitempty"` // название объекта, если оно было указано
+	Error string // описание ошибки
+}
+
+// Ошибки разбора и проверки геометрии мест.
+var (
+	ErrBadGeometry    = errors.New("bad geometry")
+	ErrNoGeometry     = errors.New("missing geometry")
+	ErrBadRadius      = errors.New("missing or bad radius property")
+	ErrBadWidth       = errors.New("missing or bad width property")
+	ErrUnsupportedGeo = errors.New("unsupported geometry type")
+)
+
+// Validate проверяет корректность описания геометрии места: координаты точек должны
+// находиться в допустимых пределах, каждый контур полигона должен состоять минимум
+// из четырех точек и быть замкнутым, а радиус круга и ширина маршрута — положительными.
+func (p Place) Validate() error {
+	switch {
+	case p.Circle != nil:
+		if !validPoint(p.Circle.Center) {
+			return ErrBadGeometry
+		}
+		if p.Circle.Radius <= 0 {
+			return ErrBadRadius
+		}
+	case p.Polygon != nil:
+		if len(*p.Polygon) == 0 {
+			return ErrBadGeometry
+		}
+		for _, ring := range *p.Polygon {
+			if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+				return ErrBadGeometry
+			}
+			for _, point := range ring {
+				if !validPoint(point) {
+					return ErrBadGeometry
+				}
+			}
+		}
+	case p.Corridor != nil:
+		if len(p.Corridor.Line) < 2 {
+			return ErrBadGeometry
+		}
+		for _, point := range p.Corridor.Line {
+			if !validPoint(point) {
+				return ErrBadGeometry
+			}
+		}
+		if p.Corridor.Width <= 0 {
+			return ErrBadWidth
+		}
+	default:
+		return ErrBadPlaceData
+	}
+	if p.Category != "" && !ValidCategory(p.Category) {
+		return ErrBadCategory
+	}
+	return nil
+}
+
+// validPoint возвращает true, если координаты точки находятся в допустимых пределах.
+func validPoint(p geo.Point) bool {
+	return p.Longitude() >= -180 && p.Longitude() <= 180 &&
+		p.Latitude() >= -90 && p.Latitude() <= 90
+}
+
+// properties возвращает описательные свойства места.
+func (p Place) properties() map[string]interface{} {
+	props := make(map[string]interface{})
+	for name, value := range map[string]string{
+		PropName:     p.Name,
+		PropCategory: p.Category,
+		PropIcon:     p.Icon,
+		PropColor:    p.Color,
+		PropAddress:  p.Address,
+		PropNotes:    p.Notes,
+	} {
+		if value != "" {
+			props[name] = value
+		}
+	}
+	return props
+}
+
+// setProperties заполняет описательные поля места из свойств.
+// Свойства, которые не являются строками, игнорируются.
+func (p *Place) setProperties(props map[string]interface{}) {
+	for name, field := range map[string]*string{
+		PropName:     &p.Name,
+		PropCategory: &p.Category,
+		PropIcon:     &p.Icon,
+		PropColor:    &p.Color,
+		PropAddress:  &p.Address,
+		PropNotes:    &p.Notes,
+	} {
+		if value, ok := props[name].(string); ok {
+			*field = value
+		}
+	}
+}
+
+// ExportGeoJSON возвращает описание мест в виде коллекции объектов GeoJSON.
+// Круг описывается точкой центра со свойством radius, а маршрут — линией со свойством width.
+func ExportGeoJSON(places []Place) (*FeatureCollection, error) {
+	collection := &FeatureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]Feature, 0, len(places)),
+	}
+	for _, place := range places {
+		feature := Feature{
+			Type:       "Feature",
+			Properties: place.properties(),
+		}
+		if place.ID.Valid() {
+			feature.ID = place.ID.Hex()
+		}
+		var (
+			geoType     string
+			coordinates interface{}
+		)
+		switch {
+		case place.Circle != nil:
+			geoType, coordinates = "Point", place.Circle.Center
+			feature.Properties[PropRadius] = place.Circle.Radius
+		case place.Polygon != nil:
+			geoType, coordinates = "Polygon", place.Polygon
+		case place.Corridor != nil:
+			geoType, coordinates = "LineString", place.Corridor.Line
+			feature.Properties[PropWidth] = place.Corridor.Width
+		default:
+			continue
+		}
+		data, err := json.Marshal(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		feature.Geometry = &Geometry{Type: geoType, Coordinates: data}
+		collection.Features = append(collection.Features, feature)
+	}
+	return collection, nil
+}
+
+// ImportGeoJSON разбирает коллекцию объектов GeoJSON и возвращает список описаний мест.
+// Объекты с ошибками в список не попадают: для каждого из них возвращается описание ошибки.
+// Ошибка возвращается только в том случае, если не удалось разобрать коллекцию целиком.
+func ImportGeoJSON(data []byte) (places []Place, errs []FeatureError, err error) {
+	var collection FeatureCollection
+	if err = json.Unmarshal(data, &collection); err != nil {
+		return nil, nil, err
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, nil, fmt.Errorf("unsupported GeoJSON type %q", collection.Type)
+	}
+	places = make([]Place, 0, len(collection.Features))
+	errs = make([]FeatureError, 0)
+	for i, feature := range collection.Features {
+		var place Place
+		place.setProperties(feature.Properties)
+		if err := place.setGeometry(feature.Geometry, feature.Properties); err != nil {
+			errs = append(errs, FeatureError{Index: i, Name: place.Name, Error: err.Error()})
+			continue
+		}
+		if err := place.Validate(); err != nil {
+			errs = append(errs, FeatureError{Index: i, Name: place.Name, Error: err.Error()})
+			continue
+		}
+		places = append(places, place)
+	}
+	return places, errs, nil
+}
+
+// setGeometry заполняет описание геометрии места из объекта GeoJSON.
+func (p *Place) setGeometry(geometry *Geometry, props map[string]interface{}) error {
+	if geometry == nil {
+		return ErrNoGeometry
+	}
+	switch geometry.Type {
+	case "Point":
+		var center geo.Point
+		if err := json.Unmarshal(geometry.Coordinates, &center); err != nil {
+			return ErrBadGeometry
+		}
+		radius, ok := props[PropRadius].(float64)
+		if !ok || radius <= 0 {
+			return ErrBadRadius
+		}
+		p.Circle = &geo.Circle{Center: center, Radius: radius}
+	case "Polygon":
+		var polygon geo.Polygon
+		if err := json.Unmarshal(geometry.Coordinates, &polygon); err != nil {
+			return ErrBadGeometry
+		}
+		p.Polygon = &polygon
+	case "LineString":
+		var line geo.LineString
+		if err := json.Unmarshal(geometry.Coordinates, &line); err != nil {
+			return ErrBadGeometry
+		}
+		width, ok := props[PropWidth].(float64)
+		if !ok || width <= 0 {
+			return ErrBadWidth
+		}
+		p.Corridor = &geo.Corridor{Line: line, Width: width}
+	default:
+		return ErrUnsupportedGeo
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package places
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mdigger/geotrack/geo"
+)
+
+var samplePlaces = []Place{
+	{Name: "Дом", Category: CategoryHome,
+		Circle: &geo.Circle{Center: geo.Point{37.589248, 55.765944}, Radius: 200}},
+	{Name: "Работа", Category: CategoryWork, Notes: "пятый этаж",
+		Polygon: &geo.Polygon{{
+			{37.5667, 55.7152}, {37.5688, 55.7167}, {37.5703, 55.7169},
+			{37.5661, 55.7145}, {37.5667, 55.7152}}}},
+	{Name: "Дорога в школу",
+		Corridor: &geo.Corridor{
+			Line:  geo.LineString{{37.589248, 55.765944}, {37.57351, 55.715084}},
+			Width: 50}},
+}
+
+func checkImported(t *testing.T, places []Place) {
+	if len(places) != len(samplePlaces) {
+		t.Fatalf("bad places count: %d", len(places))
+	}
+	for i, place := range places {
+		expected := samplePlaces[i]
+		if place.Name != expected.Name || place.Category != expected.Category ||
+			place.Notes != expected.Notes {
+			t.Errorf("bad place properties: %+v", place)
+		}
+		if err := place.Validate(); err != nil {
+			t.Errorf("bad place %q: %v", place.Name, err)
+		}
+	}
+	if places[0].Circle == nil || places[0].Circle.Radius != 200 {
+		t.Error("bad circle")
+	}
+	if places[1].Polygon == nil || len((*places[1].Polygon)[0]) != 5 {
+		t.Error("bad polygon")
+	}
+	if places[2].Corridor == nil || places[2].Corridor.Width != 50 {
+		t.Error("bad corridor")
+	}
+}
+
+func TestGeoJSON(t *testing.T) {
+	collection, err := ExportGeoJSON(samplePlaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	places, errs, err := ImportGeoJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("import errors: %v", errs)
+	}
+	checkImported(t, places)
+
+	// объекты с ошибками пропускаются с описанием ошибки
+	data = []byte(`{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "geometry": {"type": "Point", "coordinates": [37.5, 55.7]},
+		 "properties": {"name": "без радиуса"}},
+		{"type": "Feature", "geometry": {"type": "Polygon",
+		 "coordinates": [[[37.5, 55.7], [37.6, 55.7], [37.5, 55.7]]]},
+		 "properties": {"name": "незамкнутый"}},
+		{"type": "Feature", "geometry": {"type": "Point", "coordinates": [37.5, 55.7]},
+		 "properties": {"name": "круг", "radius": 100}}
+	]}`)
+	places, errs, err = ImportGeoJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(places) != 1 || places[0].Name != "круг" {
+		t.Errorf("bad imported places: %v", places)
+	}
+	if len(errs) != 2 || errs[0].Index != 0 || errs[1].Index != 1 {
+		t.Errorf("bad import errors: %v", errs)
+	}
+}
+
+func TestKML(t *testing.T) {
+	data, err := ExportKML("test", samplePlaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	places, errs, err := ImportKML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("import errors: %v", errs)
+	}
+	checkImported(t, places)
+}
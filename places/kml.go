@@ -0,0 +1,233 @@
+package places
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mdigger/geotrack/geo"
+)
+
+// KMLNamespace описывает пространство имен формата KML.
+const KMLNamespace = "http://www.opengis.net/kml/2.2"
+
+// kml описывает корневой элемент документа KML.
+type kml struct {
+	XMLName  xml.Name    `xml:"kml"`
+	XMLNS    string      `xml:"xmlns,attr,omitempty"`
+	Document kmlDocument `xml:"Document"`
+}
+
+// kmlDocument описывает документ или папку KML.
+type kmlDocument struct {
+	Name       string         `xml:"name,omitempty"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+	Folders    []kmlDocument  `xml:"Folder"`
+}
+
+// placemarks возвращает список всех объектов документа, включая вложенные папки.
+func (d kmlDocument) placemarks() []kmlPlacemark {
+	result := d.Placemarks
+	for _, folder := range d.Folders {
+		result = append(result, folder.placemarks()...)
+	}
+	return result
+}
+
+// kmlPlacemark описывает объект KML.
+type kmlPlacemark struct {
+	ID          string      `xml:"id,attr,omitempty"`
+	Name        string      `xml:"name,omitempty"`
+	Description string      `xml:"description,omitempty"`
+	Address     string      `xml:"address,omitempty"`
+	Data        []kmlData   `xml:"ExtendedData>Data"`
+	Point       *kmlCoords  `xml:"Point"`
+	LineString  *kmlCoords  `xml:"LineString"`
+	Polygon     *kmlPolygon `xml:"Polygon"`
+}
+
+// kmlData описывает дополнительное именованное свойство объекта KML.
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+// kmlCoords описывает элемент KML со списком координат.
+type kmlCoords struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+// kmlPolygon описывает полигон в формате KML.
+type kmlPolygon struct {
+	Outer kmlCoords   `xml:"outerBoundaryIs>LinearRing"`
+	Inner []kmlCoords `xml:"innerBoundaryIs>LinearRing"`
+}
+
+// formatCoordinates возвращает строковое представление списка точек в формате KML.
+func formatCoordinates(points ...geo.Point) kmlCoords {
+	list := make([]string, len(points))
+	for i, point := range points {
+		list[i] = strconv.FormatFloat(point.Longitude(), 'f', -1, 64) + "," +
+			strconv.FormatFloat(point.Latitude(), 'f', -1, 64)
+	}
+	return kmlCoords{Coordinates: strings.Join(list, " ")}
+}
+
+// parseCoordinates разбирает список координат в формате KML. Высота, если она указана,
+// игнорируется.
+func parseCoordinates(coords kmlCoords) ([]geo.Point, error) {
+	fields := strings.Fields(coords.Coordinates)
+	points := make([]geo.Point, len(fields))
+	for i, field := range fields {
+		values := strings.Split(field, ",")
+		if len(values) < 2 || len(values) > 3 {
+			return nil, ErrBadGeometry
+		}
+		lon, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return nil, ErrBadGeometry
+		}
+		lat, err := strconv.ParseFloat(values[1], 64)
+		if err != nil {
+			return nil, ErrBadGeometry
+		}
+		points[i] = geo.Point{lon, lat}
+	}
+	return points, nil
+}
+
+// ExportKML возвращает описание мест в виде документа KML. Круг описывается точкой центра
+// с дополнительным свойством radius, а маршрут — линией со свойством width.
+func ExportKML(name string, places []Place) ([]byte, error) {
+	doc := kml{
+		XMLNS: KMLNamespace,
+		Document: kmlDocument{
+			Name:       name,
+			Placemarks: make([]kmlPlacemark, 0, len(places)),
+		},
+	}
+	for _, place := range places {
+		placemark := kmlPlacemark{
+			Name:        place.Name,
+			Description: place.Notes,
+			Address:     place.Address,
+		}
+		if place.ID.Valid() {
+			placemark.ID = place.ID.Hex()
+		}
+		for _, item := range []kmlData{
+			{PropCategory, place.Category},
+			{PropIcon, place.Icon},
+			{PropColor, place.Color},
+		} {
+			if item.Value != "" {
+				placemark.Data = append(placemark.Data, item)
+			}
+		}
+		switch {
+		case place.Circle != nil:
+			coords := formatCoordinates(place.Circle.Center)
+			placemark.Point = &coords
+			placemark.Data = append(placemark.Data, kmlData{PropRadius,
+				strconv.FormatFloat(place.Circle.Radius, 'f', -1, 64)})
+		case place.Polygon != nil && len(*place.Polygon) > 0:
+			polygon := *place.Polygon
+			placemark.Polygon = &kmlPolygon{Outer: formatCoordinates(polygon[0]...)}
+			for _, ring := range polygon[1:] {
+				placemark.Polygon.Inner = append(placemark.Polygon.Inner,
+					formatCoordinates(ring...))
+			}
+		case place.Corridor != nil:
+			coords := formatCoordinates(place.Corridor.Line...)
+			placemark.LineString = &coords
+			placemark.Data = append(placemark.Data, kmlData{PropWidth,
+				strconv.FormatFloat(place.Corridor.Width, 'f', -1, 64)})
+		default:
+			continue
+		}
+		doc.Document.Placemarks = append(doc.Document.Placemarks, placemark)
+	}
+	data, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// ImportKML разбирает документ KML и возвращает список описаний мест, включая объекты
+// из вложенных папок. Объекты с ошибками в список не попадают: для каждого из них
+// возвращается описание ошибки. Ошибка возвращается только в том случае, если не удалось
+// разобрать документ целиком.
+func ImportKML(data []byte) (places []Place, errs []FeatureError, err error) {
+	var doc kml
+	if err = xml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	placemarks := doc.Document.placemarks()
+	places = make([]Place, 0, len(placemarks))
+	errs = make([]FeatureError, 0)
+	for i, placemark := range placemarks {
+		place, err := placemark.place()
+		if err == nil {
+			err = place.Validate()
+		}
+		if err != nil {
+			errs = append(errs, FeatureError{Index: i, Name: placemark.Name, Error: err.Error()})
+			continue
+		}
+		places = append(places, place)
+	}
+	return places, errs, nil
+}
+
+// place возвращает описание места для объекта KML.
+func (p kmlPlacemark) place() (place Place, err error) {
+	place = Place{
+		Name:    p.Name,
+		Notes:   strings.TrimSpace(p.Description),
+		Address: p.Address,
+	}
+	props := make(map[string]string, len(p.Data))
+	for _, item := range p.Data {
+		props[item.Name] = item.Value
+	}
+	place.Category = props[PropCategory]
+	place.Icon = props[PropIcon]
+	place.Color = props[PropColor]
+	switch {
+	case p.Point != nil:
+		points, err := parseCoordinates(*p.Point)
+		if err != nil || len(points) != 1 {
+			return place, ErrBadGeometry
+		}
+		radius, err := strconv.ParseFloat(props[PropRadius], 64)
+		if err != nil || radius <= 0 {
+			return place, ErrBadRadius
+		}
+		place.Circle = &geo.Circle{Center: points[0], Radius: radius}
+	case p.Polygon != nil:
+		polygon := make(geo.Polygon, 0, len(p.Polygon.Inner)+1)
+		for _, coords := range append([]kmlCoords{p.Polygon.Outer}, p.Polygon.Inner...) {
+			ring, err := parseCoordinates(coords)
+			if err != nil {
+				return place, err
+			}
+			polygon = append(polygon, ring)
+		}
+		place.Polygon = &polygon
+	case p.LineString != nil:
+		line, err := parseCoordinates(*p.LineString)
+		if err != nil {
+			return place, err
+		}
+		width, err := strconv.ParseFloat(props[PropWidth], 64)
+		if err != nil || width <= 0 {
+			return place, ErrBadWidth
+		}
+		place.Corridor = &geo.Corridor{Line: line, Width: width}
+	default:
+		return place, fmt.Errorf("%v: Point, Polygon or LineString expected", ErrNoGeometry)
+	}
+	return place, nil
+}
@@ -2,10 +2,15 @@ package places
 
 import (
 	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"time"
 
 	"github.com/mdigger/geotrack/geo"
 	"github.com/mdigger/geotrack/mongo"
 	"github.com/mdigger/geotrack/tracks"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -22,30 +27,59 @@ func InitDB(mdb *mongo.DB) (db *DB, err error) {
 	if err = coll.EnsureIndexKey("groupid", "$2dsphere:geo"); err != nil {
 		return
 	}
+	if err = coll.EnsureIndexKey("groupid", "category"); err != nil {
+		return
+	}
 	return
 }
 
+// Категории мест.
+const (
+	CategoryHome   = "home"   // дом
+	CategorySchool = "school" // школа
+	CategoryWork   = "work"   // работа
+	CategoryCustom = "custom" // произвольное место, определенное пользователем
+)
+
 // Place описывает географическое место.
 type Place struct {
-	ID      bson.ObjectId `bson:"_id"`                          // уникальный идентификатор
-	Name    string        `json:",omitempty"`                   // название
-	GroupID string        `json:",omitempty"`                   // идентификатор группы
-	Circle  *geo.Circle   `json:",omitempty" bson:",omitempty"` // описывает круг
-	Polygon *geo.Polygon  `json:",omitempty" bson:",omitempty"` // описывает область
-	Geo     interface{}   `json:"-"`                            // описание координат места для поиска
+	ID        bson.ObjectId `bson:"_id"`                          // уникальный идентификатор
+	Name      string        `json:",omitempty"`                   // название
+	GroupID   string        `json:",omitempty"`                   // идентификатор группы
+	Category  string        `json:",omitempty"`                   // категория места
+	Icon      string        `json:",omitempty" bson:",omitempty"` // идентификатор иконки
+	Color     string        `json:",omitempty" bson:",omitempty"` // цвет отображения места
+	Address   string        `json:",omitempty" bson:",omitempty"` // почтовый адрес
+	Notes     string        `json:",omitempty" bson:",omitempty"` // произвольные заметки
+	Created   time.Time     `json:",omitempty" bson:",omitempty"` // время создания
+	Updated   time.Time     `json:",omitempty" bson:",omitempty"` // время последнего изменения
+	CreatorID bson.ObjectId `json:",omitempty" bson:",omitempty"` // идентификатор создавшего пользователя
+	Circle    *geo.Circle   `json:",omitempty" bson:",omitempty"` // описывает круг
+	Polygon   *geo.Polygon  `json:",omitempty" bson:",omitempty"` // описывает область
+	Corridor  *geo.Corridor `json:",omitempty" bson:",omitempty"` // описывает маршрут
+	Geo       interface{}   `json:"-"`                            // описание координат места для поиска
 }
 
 var (
-	// ErrBadPlaceData возвращается, если в описании места не указано ни круга, ни полигона.
+	// ErrBadPlaceData возвращается, если в описании места не указано ни круга, ни полигона,
+	// ни маршрута, или описание маршрута не корректно.
 	ErrBadPlaceData = errors.New("bad place data")
 	ErrBadID        = errors.New("bad place id")
+	// ErrBadCategory возвращается, если указана неподдерживаемая категория места.
+	ErrBadCategory = errors.New("bad place category")
 )
 
+// Filter описывает параметры отбора мест при запросе списка.
+type Filter struct {
+	Category string // категория места
+	Query    string // строка для поиска в названии, адресе и заметках
+}
+
 func (db *DB) Get(groupID string, placeID bson.ObjectId) (place *Place, err error) {
 	coll := db.GetCollection(CollectionName)
 	place = new(Place)
 	selector := bson.M{"groupid": 0, "geo": 0}
-	err = coll.Find(bson.M{"_id": placeID, "groupid": groupID}).Select(selector).All(&place)
+	err = coll.Find(bson.M{"_id": placeID, "groupid": groupID}).Select(selector).One(place)
 	db.FreeCollection(coll)
 	return
 }
@@ -54,40 +88,166 @@ func (db *DB) Get(groupID string, placeID bson.ObjectId) (place *Place, err erro
 // Результат содержит только информацию с описание круга или полигона. Информация
 // о группе и сформированном внутреннем индексном объекте Geo не возвращается.
 func (db *DB) GetAll(groupID string) (places []Place, err error) {
+	return db.Find(groupID, Filter{})
+}
+
+// Find возвращает список описаний мест для указанной группы, удовлетворяющих фильтру.
+// Поиск по строке осуществляется без учета регистра символов.
+func (db *DB) Find(groupID string, filter Filter) (places []Place, err error) {
 	coll := db.GetCollection(CollectionName)
 	places = make([]Place, 0)
+	search := bson.M{"groupid": groupID}
+	if filter.Category != "" {
+		search["category"] = filter.Category
+	}
+	if filter.Query != "" {
+		regex := bson.RegEx{Pattern: regexp.QuoteMeta(filter.Query), Options: "i"}
+		search["$or"] = []bson.M{
+			{"name": regex},
+			{"address": regex},
+			{"notes": regex},
+		}
+	}
 	selector := bson.M{"groupid": 0, "geo": 0}
-	err = coll.Find(bson.M{"groupid": groupID}).Select(selector).All(&places)
+	err = coll.Find(search).Select(selector).All(&places)
 	db.FreeCollection(coll)
 	return
 }
 
+// ValidCategory возвращает true, если категория места поддерживается.
+func ValidCategory(category string) bool {
+	switch category {
+	case CategoryHome, CategorySchool, CategoryWork, CategoryCustom:
+		return true
+	default:
+		return false
+	}
+}
+
 // Save сохраняет описание места в хранилище.
-// В объекте должно быть указано хотя бы одно описание места: либо круг, либо полигон.
-// Если указано и то, и другое, то используется только круг. Если не указано ни того,
-// ни другого, то такая запись игнорируется.
+// В объекте должно быть указано хотя бы одно описание места: круг, полигон или маршрут.
+// Если указано несколько, то используется только одно из них в указанном порядке. Если не
+// указано ни одного, то такая запись игнорируется.
+//
+// Для маршрута в индекс сохраняется полигон, содержащий всю его буферную зону, поэтому
+// попадание точки в маршрут дополнительно проверяется при анализе треков.
+//
+// Время создания и идентификатор создателя сохраняются только при добавлении нового места
+// и не изменяются при последующих сохранениях. Время изменения обновляется всегда.
 func (db *DB) Save(place Place) (id bson.ObjectId, err error) {
 	coll := db.GetCollection(CollectionName)
 	defer db.FreeCollection(coll)
+	if place.Category == "" {
+		place.Category = CategoryCustom
+	} else if !ValidCategory(place.Category) {
+		return "", ErrBadCategory
+	}
 	// анализируем описание места и формируем данные для индексации
 	if place.Circle != nil {
 		place.Polygon = nil
+		place.Corridor = nil
 		place.Geo = place.Circle.Geo()
 	} else if place.Polygon != nil {
 		place.Circle = nil
+		place.Corridor = nil
 		place.Geo = place.Polygon.Geo()
+	} else if place.Corridor != nil && place.Corridor.Valid() {
+		place.Circle = nil
+		place.Polygon = nil
+		place.Geo = place.Corridor.Geo()
 	} else {
 		return "", ErrBadPlaceData
 	}
 	if !place.ID.Valid() {
 		place.ID = bson.NewObjectId()
 	}
-	if _, err = coll.UpsertId(place.ID, place); err != nil {
+	place.Updated = time.Now()
+	onInsert := bson.M{"created": place.Updated}
+	if place.CreatorID.Valid() {
+		onInsert["creatorid"] = place.CreatorID
+	}
+	// формируем список изменяемых полей без учета тех, что задаются только при создании
+	var update bson.M
+	data, err := bson.Marshal(place)
+	if err != nil {
+		return "", err
+	}
+	if err = bson.Unmarshal(data, &update); err != nil {
+		return "", err
+	}
+	delete(update, "_id")
+	delete(update, "created")
+	delete(update, "creatorid")
+	// пустые поля необходимо удалить из сохраненного описания места
+	unset := bson.M{}
+	for _, name := range []string{"icon", "color", "address", "notes", "circle", "polygon",
+		"corridor"} {
+		if _, ok := update[name]; !ok {
+			unset[name] = ""
+		}
+	}
+	change := bson.M{"$set": update, "$setOnInsert": onInsert}
+	if len(unset) > 0 {
+		change["$unset"] = unset
+	}
+	if _, err = coll.Upsert(bson.M{"_id": place.ID, "groupid": place.GroupID}, change); err != nil {
 		return "", err
 	}
 	return place.ID, nil
 }
 
+// Rejected возвращает true, если место не было сохранено из-за ошибки в его описании,
+// в том числе, если хранилище отказалось его сохранить, например, из-за полигона, который
+// не удалось проиндексировать. Остальные ошибки относятся к соединению с хранилищем.
+func Rejected(err error) bool {
+	switch err.(type) {
+	case *mgo.LastError, *mgo.QueryError:
+		return true
+	}
+	return err == ErrBadCategory || err == ErrBadPlaceData
+}
+
+// Import сохраняет в хранилище места группы, полученные при импорте, и возвращает их
+// идентификаторы. Места, которые не удалось сохранить из-за ошибок в их описании, пропускаются:
+// описания ошибок добавляются к ошибкам разбора errs с порядковым номером объекта в исходном
+// файле. Ошибка возвращается только в том случае, если сохранение прервано из-за ошибки
+// соединения с хранилищем.
+func (db *DB) Import(groupID string, creatorID bson.ObjectId, list []Place, errs []FeatureError) (
+	ids []bson.ObjectId, _ []FeatureError, err error) {
+	// места в списке идут в порядке исходных объектов, за исключением объектов с ошибками
+	skipped := make(map[int]bool, len(errs))
+	for _, ferr := range errs {
+		skipped[ferr.Index] = true
+	}
+	ids = make([]bson.ObjectId, 0, len(list))
+	index := 0
+	for _, place := range list {
+		for skipped[index] {
+			index++
+		}
+		place.GroupID = groupID
+		place.CreatorID = creatorID
+		id, err := db.Save(place)
+		if Rejected(err) {
+			errs = append(errs, FeatureError{Index: index, Name: place.Name, Error: err.Error()})
+		} else if err != nil {
+			return ids, errs, err
+		} else {
+			ids = append(ids, id)
+		}
+		index++
+	}
+	sort.Sort(byIndex(errs))
+	return ids, errs, nil
+}
+
+// byIndex используется для сортировки ошибок импорта по порядковому номеру объекта.
+type byIndex []FeatureError
+
+func (e byIndex) Len() int           { return len(e) }
+func (e byIndex) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e byIndex) Less(i, j int) bool { return e[i].Index < e[j].Index }
+
 func (db *DB) Delete(groupID string, placeID bson.ObjectId) (err error) {
 	coll := db.GetCollection(CollectionName)
 	err = coll.Remove(bson.M{"_id": placeID, "groupid": groupID})
@@ -99,7 +259,7 @@ func (db *DB) Delete(groupID string, placeID bson.ObjectId) (err error) {
 // которым соответствует данная точка трекера.
 func (db *DB) Track(track tracks.TrackData) (placeIDs []bson.ObjectId, err error) {
 	coll := db.GetCollection(CollectionName)
-	placeIDs = make([]bson.ObjectId, 0)
+	places := make([]Place, 0)
 	err = coll.Find(bson.M{
 		"groupid": track.GroupID,
 		"geo": bson.M{
@@ -107,6 +267,95 @@ func (db *DB) Track(track tracks.TrackData) (placeIDs []bson.ObjectId, err error
 				"$geometry": track.Location.Geo(),
 			},
 		},
-	}).Distinct("_id", &placeIDs)
-	return
+	}).Select(bson.M{"_id": 1, "corridor": 1}).All(&places)
+	db.FreeCollection(coll)
+	if err != nil {
+		return nil, err
+	}
+	placeIDs = make([]bson.ObjectId, 0, len(places))
+	for _, place := range places {
+		// индекс маршрута описывает область больше самого маршрута
+		if place.Corridor != nil && !place.Corridor.Contains(track.Location) {
+			continue
+		}
+		placeIDs = append(placeIDs, place.ID)
+	}
+	return placeIDs, nil
 }
+
+// Routes возвращает списки идентификаторов маршрутов, определенных для группы, внутри
+// которых и за пределами которых находится данная точка трекера.
+func (db *DB) Routes(track tracks.TrackData) (inside, outside []bson.ObjectId, err error) {
+	coll := db.GetCollection(CollectionName)
+	places := make([]Place, 0)
+	err = coll.Find(bson.M{
+		"groupid":  track.GroupID,
+		"corridor": bson.M{"$exists": true},
+	}).Select(bson.M{"_id": 1, "corridor": 1}).All(&places)
+	db.FreeCollection(coll)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, place := range places {
+		if place.Corridor.Contains(track.Location) {
+			inside = append(inside, place.ID)
+		} else {
+			outside = append(outside, place.ID)
+		}
+	}
+	return inside, outside, nil
+}
+
+// Distance возвращает расстояние в метрах от точки до границы места. Для полигона это
+// расстояние до ближайшего ребра, для круга — расстояние до центра за вычетом радиуса,
+// для маршрута — расстояние до линии за вычетом ширины буферной зоны.
+// Если точка находится внутри места, то возвращается 0.
+func (p Place) Distance(point geo.Point) float64 {
+	switch {
+	case p.Circle != nil:
+		return p.Circle.Distance(point)
+	case p.Polygon != nil:
+		return p.Polygon.Distance(point)
+	case p.Corridor != nil:
+		return p.Corridor.Distance(point)
+	default:
+		return math.Inf(1)
+	}
+}
+
+// PlaceDistance описывает место и расстояние до него.
+type PlaceDistance struct {
+	Place    `bson:",inline"`
+	Distance float64 // расстояние в метрах
+}
+
+// Nearest возвращает список мест группы, отсортированный по расстоянию от указанной точки.
+// Если maxDistance больше нуля, то места, находящиеся дальше, в результат не попадают.
+// Если limit больше нуля, то он ограничивает количество возвращаемых мест.
+func (db *DB) Nearest(groupID string, point geo.Point, limit int, maxDistance float64) (
+	places []PlaceDistance, err error) {
+	list, err := db.GetAll(groupID)
+	if err != nil {
+		return nil, err
+	}
+	places = make([]PlaceDistance, 0, len(list))
+	for _, place := range list {
+		dist := place.Distance(point)
+		if math.IsInf(dist, 1) || (maxDistance > 0 && dist > maxDistance) {
+			continue
+		}
+		places = append(places, PlaceDistance{Place: place, Distance: dist})
+	}
+	sort.Sort(byDistance(places))
+	if limit > 0 && len(places) > limit {
+		places = places[:limit]
+	}
+	return places, nil
+}
+
+// byDistance используется для сортировки мест по расстоянию.
+type byDistance []PlaceDistance
+
+func (p byDistance) Len() int           { return len(p) }
+func (p byDistance) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byDistance) Less(i, j int) bool { return p[i].Distance < p[j].Distance }
@@ -113,3 +113,42 @@ func TestPlaces2(t *testing.T) {
 		fmt.Println("id:", id.Hex())
 	}
 }
+
+func TestImport(t *testing.T) {
+	mdb, err := mongo.Connect("mongodb://localhost/watch")
+	if err != nil {
+		log.Println("Error connecting to MongoDB:", err)
+		return
+	}
+	defer mdb.Close()
+
+	db, err := InitDB(mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupID := users.SampleGroupID
+	list := []Place{
+		Place{Circle: &geo.Circle{geo.Point{37.589248, 55.765944}, 200.0}, Name: "Дом"},
+		// самопересекающийся полигон не индексируется MongoDB
+		Place{Polygon: &geo.Polygon{{
+			{37.6256, 55.7522}, {37.6310, 55.7499}, {37.6310, 55.7522},
+			{37.6256, 55.7499}, {37.6256, 55.7522}}}, Name: "Восьмерка"},
+		Place{Circle: &geo.Circle{geo.Point{37.57351, 55.715084}, 100.0}, Name: "Работа"},
+	}
+	errs := []FeatureError{{Index: 1, Name: "Стадион", Error: ErrBadRadius.Error()}}
+	ids, errs, err := db.Import(groupID, "", list, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if err := db.Delete(groupID, id); err != nil {
+			t.Error(err)
+		}
+	}
+	if len(ids) != 2 {
+		t.Errorf("imported %d places, want 2", len(ids))
+	}
+	if len(errs) != 2 || errs[0].Index != 1 || errs[1].Index != 2 || errs[1].Name != "Восьмерка" {
+		t.Errorf("bad import errors: %+v", errs)
+	}
+}
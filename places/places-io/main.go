@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mdigger/geotrack/mongo"
+	"github.com/mdigger/geotrack/places"
+)
+
+func main() {
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.Ltime)
+	mongourl := flag.String("mongo", "mongodb://localhost/watch", "mongoDB connection URL")
+	groupID := flag.String("group", "", "group ID (required)")
+	format := flag.String("format", "", "file format: geojson or kml (default by file extension)")
+	export := flag.Bool("export", false, "export places to file instead of import")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, "Import or export group places as GeoJSON or KML\n")
+		fmt.Fprintf(os.Stderr, "%s [-params] -group <id> places.geojson\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *groupID == "" {
+		flag.Usage()
+		return
+	}
+	filename := flag.Arg(0)
+	if *format == "" {
+		*format = strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+		if *format == "json" {
+			*format = "geojson"
+		}
+	}
+	if *format != "geojson" && *format != "kml" {
+		log.Printf("Unsupported format %q", *format)
+		return
+	}
+
+	// устанавливаем соединение с сервером MongoDB
+	log.Printf("Connecting to MongoDB %q...", *mongourl)
+	mdb, err := mongo.Connect(*mongourl)
+	if err != nil {
+		log.Printf("Error connecting to MongoDB: %v", err)
+		return
+	}
+	defer mdb.Close()
+
+	db, err := places.InitDB(mdb)
+	if err != nil {
+		log.Printf("Error initializing indexes: %v", err)
+		return
+	}
+
+	if *export {
+		list, err := db.GetAll(*groupID)
+		if err != nil {
+			log.Printf("Error reading places: %v", err)
+			return
+		}
+		var data []byte
+		if *format == "kml" {
+			data, err = places.ExportKML(*groupID, list)
+		} else {
+			var collection *places.FeatureCollection
+			if collection, err = places.ExportGeoJSON(list); err == nil {
+				data, err = json.MarshalIndent(collection, "", "\t")
+			}
+		}
+		if err != nil {
+			log.Printf("Error exporting places: %v", err)
+			return
+		}
+		if err = ioutil.WriteFile(filename, data, 0644); err != nil {
+			log.Printf("Error writing file: %v", err)
+			return
+		}
+		log.Printf("Exported %d places to %q", len(list), filename)
+		return
+	}
+
+	log.Printf("Reading places from %q...", filename)
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Printf("Error reading file: %v", err)
+		return
+	}
+	var (
+		list []places.Place
+		errs []places.FeatureError
+	)
+	if *format == "kml" {
+		list, errs, err = places.ImportKML(data)
+	} else {
+		list, errs, err = places.ImportGeoJSON(data)
+	}
+	if err != nil {
+		log.Printf("Error parsing file: %v", err)
+		return
+	}
+	ids, errs, err := db.Import(*groupID, "", list, errs)
+	for _, ferr := range errs {
+		log.Printf("Skip feature #%d %q: %s", ferr.Index, ferr.Name, ferr.Error)
+	}
+	if err != nil {
+		log.Printf("Error saving places: %v", err)
+		return
+	}
+	log.Printf("Imported %d places, skipped %d", len(ids), len(errs))
+}
@@ -0,0 +1,266 @@
+package places
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mdigger/geotrack/geo"
+	"github.com/mdigger/geotrack/tracks"
+)
+
+// SuggestOptions описывает параметры анализа треков для поиска часто посещаемых мест.
+type SuggestOptions struct {
+	StayRadius    float64        // радиус в метрах, в пределах которого устройство считается неподвижным
+	MinStay       time.Duration  // минимальное время пребывания на одном месте
+	MaxAccuracy   float64        // точки трека с большей погрешностью в метрах не учитываются
+	ClusterRadius float64        // максимальное расстояние в метрах между соседними стоянками места
+	MinVisits     int            // минимальное количество стоянок для формирования места
+	Location      *time.Location // часовой пояс для анализа времени суток
+}
+
+// DefaultSuggestOptions описывает параметры анализа треков по умолчанию.
+var DefaultSuggestOptions = SuggestOptions{
+	StayRadius:    100,
+	MinStay:       time.Minute * 15,
+	MaxAccuracy:   500,
+	ClusterRadius: 150,
+	MinVisits:     3,
+}
+
+// Stay описывает стоянку: интервал времени, в течение которого устройство находилось
+// на одном месте.
+type Stay struct {
+	Location geo.Point // координаты стоянки
+	Accuracy float64   // средняя погрешность координат в метрах
+	Start    time.Time // время начала стоянки
+	End      time.Time // время окончания стоянки
+}
+
+// Duration возвращает продолжительность стоянки.
+func (s Stay) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// weight возвращает вес стоянки при вычислении центра места: чем дольше стоянка и чем
+// точнее ее координаты, тем больше вес.
+func (s Stay) weight() float64 {
+	return s.Duration().Hours() / math.Max(s.Accuracy, 10)
+}
+
+// Stays выделяет из списка треков устройства стоянки. Треки должны быть отсортированы
+// в хронологическом порядке. Точки с погрешностью больше допустимой пропускаются.
+func Stays(list []tracks.Track, opts SuggestOptions) []Stay {
+	stays := make([]Stay, 0)
+	var group []tracks.Track // точки текущей стоянки
+	flush := func() {
+		if len(group) < 2 {
+			return
+		}
+		stay := Stay{
+			Start: group[0].Time,
+			End:   group[len(group)-1].Time,
+		}
+		if stay.Duration() < opts.MinStay {
+			return
+		}
+		points := make([]geo.Point, len(group))
+		weights := make([]float64, len(group))
+		for i, track := range group {
+			points[i] = track.Location
+			accuracy := math.Max(track.Accuracy, 10)
+			weights[i] = 1 / (accuracy * accuracy)
+			stay.Accuracy += track.Accuracy
+		}
+		stay.Location = weightedCentroid(points, weights)
+		stay.Accuracy /= float64(len(group))
+		stays = append(stays, stay)
+	}
+	for _, track := range list {
+		if opts.MaxAccuracy > 0 && track.Accuracy > opts.MaxAccuracy {
+			continue
+		}
+		if len(group) > 0 && group[0].Location.Distance(track.Location) > opts.StayRadius {
+			flush()
+			group = group[:0]
+		}
+		group = append(group, track)
+	}
+	flush()
+	return stays
+}
+
+// Suggestion описывает предлагаемое для сохранения место.
+type Suggestion struct {
+	Place  `bson:",inline"`
+	Visits int     // количество стоянок в этом месте
+	Hours  float64 // суммарное время пребывания в часах
+}
+
+// Cluster объединяет стоянки в места методом DBSCAN и возвращает список предлагаемых мест,
+// отсортированный по суммарному времени пребывания. Категория места определяется по времени
+// суток: место, где устройство преимущественно находится ночью, считается домом, а место,
+// где оно находится в будние дни с утра до обеда — школой.
+func Cluster(stays []Stay, opts SuggestOptions) []Suggestion {
+	const (
+		noise      = -1
+		unassigned = 0
+	)
+	labels := make([]int, len(stays))
+	neighbors := func(i int) []int {
+		result := make([]int, 0)
+		for j := range stays {
+			if stays[i].Location.Distance(stays[j].Location) <= opts.ClusterRadius {
+				result = append(result, j)
+			}
+		}
+		return result
+	}
+	var cluster int
+	for i := range stays {
+		if labels[i] != unassigned {
+			continue
+		}
+		seeds := neighbors(i)
+		if len(seeds) < opts.MinVisits {
+			labels[i] = noise
+			continue
+		}
+		cluster++
+		labels[i] = cluster
+		for k := 0; k < len(seeds); k++ {
+			j := seeds[k]
+			if labels[j] == noise {
+				labels[j] = cluster
+			}
+			if labels[j] != unassigned {
+				continue
+			}
+			labels[j] = cluster
+			if next := neighbors(j); len(next) >= opts.MinVisits {
+				seeds = append(seeds, next...)
+			}
+		}
+	}
+	// формируем описания мест из полученных кластеров
+	suggestions := make([]Suggestion, 0, cluster)
+	for c := 1; c <= cluster; c++ {
+		var (
+			points  []geo.Point
+			weights []float64
+			members []Stay
+		)
+		for i, label := range labels {
+			if label == c {
+				points = append(points, stays[i].Location)
+				weights = append(weights, stays[i].weight())
+				members = append(members, stays[i])
+			}
+		}
+		center := weightedCentroid(points, weights)
+		radius := opts.StayRadius
+		var hours float64
+		for _, stay := range members {
+			if dist := center.Distance(stay.Location); dist > radius {
+				radius = dist
+			}
+			hours += stay.Duration().Hours()
+		}
+		category := classify(members, opts.Location)
+		suggestions = append(suggestions, Suggestion{
+			Place: Place{
+				Name:     suggestNames[category],
+				Category: category,
+				Circle:   &geo.Circle{Center: center, Radius: math.Ceil(radius)},
+			},
+			Visits: len(members),
+			Hours:  hours,
+		})
+	}
+	sort.Sort(byHours(suggestions))
+	return suggestions
+}
+
+// suggestNames содержит названия предлагаемых мест в зависимости от категории.
+var suggestNames = map[string]string{
+	CategoryHome:   "Дом",
+	CategorySchool: "Школа",
+	CategoryCustom: "Часто посещаемое место",
+}
+
+// classify определяет категорию места по времени суток, в которое оно посещалось.
+// Время стоянок анализируется с шагом в 15 минут.
+func classify(stays []Stay, loc *time.Location) string {
+	const step = time.Minute * 15
+	if loc == nil {
+		loc = time.Local
+	}
+	var total, night, school int
+	for _, stay := range stays {
+		for t := stay.Start; t.Before(stay.End); t = t.Add(step) {
+			total++
+			lt := t.In(loc)
+			hour := lt.Hour()
+			switch {
+			case hour >= 22 || hour < 6:
+				night++
+			case hour >= 8 && hour < 15 &&
+				lt.Weekday() != time.Saturday && lt.Weekday() != time.Sunday:
+				school++
+			}
+		}
+	}
+	switch {
+	case total == 0:
+		return CategoryCustom
+	case night*2 >= total:
+		return CategoryHome
+	case school*2 >= total:
+		return CategorySchool
+	default:
+		return CategoryCustom
+	}
+}
+
+// weightedCentroid возвращает центр точек с учетом их веса.
+func weightedCentroid(points []geo.Point, weights []float64) geo.Point {
+	var lon, lat, total float64
+	for i, point := range points {
+		lon += point.Longitude() * weights[i]
+		lat += point.Latitude() * weights[i]
+		total += weights[i]
+	}
+	if total == 0 {
+		return geo.Centroid(points...)
+	}
+	return geo.Point{lon / total, lat / total}
+}
+
+// byHours используется для сортировки предлагаемых мест по времени пребывания.
+type byHours []Suggestion
+
+func (s byHours) Len() int           { return len(s) }
+func (s byHours) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byHours) Less(i, j int) bool { return s[i].Hours > s[j].Hours }
+
+// Suggest возвращает список предлагаемых мест для группы на основании стоянок ее устройств.
+// Места, центр которых попадает в уже определенные для группы места (кроме маршрутов),
+// в результат не входят.
+func (db *DB) Suggest(groupID string, stays []Stay, opts SuggestOptions) (
+	suggestions []Suggestion, err error) {
+	places, err := db.GetAll(groupID)
+	if err != nil {
+		return nil, err
+	}
+	suggestions = make([]Suggestion, 0)
+next:
+	for _, suggestion := range Cluster(stays, opts) {
+		for _, place := range places {
+			if place.Corridor == nil && place.Distance(suggestion.Circle.Center) == 0 {
+				continue next
+			}
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, nil
+}
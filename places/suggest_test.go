@@ -0,0 +1,61 @@
+package places
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdigger/geotrack/geo"
+	"github.com/mdigger/geotrack/tracks"
+)
+
+func TestSuggest(t *testing.T) {
+	var (
+		home   = geo.NewPoint(37.589248, 55.765944)
+		school = geo.NewPoint(37.57351, 55.715084)
+		list   []tracks.Track
+	)
+	// добавляет точки трека с интервалом в 5 минут
+	add := func(point geo.Point, from, to time.Time) {
+		for t := from; t.Before(to); t = t.Add(time.Minute * 5) {
+			list = append(list, tracks.Track{
+				Time:     t,
+				Location: point.Move(20, float64(t.Minute()*6)),
+				Accuracy: 30,
+			})
+		}
+	}
+	// понедельник, 5 рабочих дней: ночью дома, днем в школе
+	day := time.Date(2015, 12, 7, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		add(home, day.Add(time.Hour*0), day.Add(time.Hour*7))
+		add(school, day.Add(time.Hour*9), day.Add(time.Hour*14))
+		add(home, day.Add(time.Hour*21), day.Add(time.Hour*24))
+		day = day.AddDate(0, 0, 1)
+	}
+	opts := DefaultSuggestOptions
+	opts.Location = time.UTC
+	stays := Stays(list, opts)
+	// ночные стоянки дома соседних дней объединяются в одну
+	if len(stays) != 11 {
+		t.Fatalf("bad stays count: %d", len(stays))
+	}
+	suggestions := Cluster(stays, opts)
+	if len(suggestions) != 2 {
+		t.Fatalf("bad suggestions count: %d", len(suggestions))
+	}
+	for i, expected := range []struct {
+		category string
+		center   geo.Point
+	}{
+		{CategoryHome, home},
+		{CategorySchool, school},
+	} {
+		suggestion := suggestions[i]
+		if suggestion.Category != expected.category {
+			t.Errorf("bad category: %q, expected %q", suggestion.Category, expected.category)
+		}
+		if dist := suggestion.Circle.Center.Distance(expected.center); dist > 50 {
+			t.Errorf("%s center is too far: %.1f m", suggestion.Category, dist)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Package policy описывает правила доступа пользователей и устройств к устройствам группы.
+//
+// Пользователь получает доступ к устройству только через свою группу: устройство должно
+// быть зарегистрировано в ней, а разрешенные действия определяются ролью пользователя
+// в группе. Устройство с собственным токеном может только передавать свои данные, если это
+// разрешено областями доступа токена.
+package policy
+
+import (
+	"errors"
+
+	"github.com/mdigger/geotrack/token"
+	"github.com/mdigger/geotrack/users"
+)
+
+// Action описывает действие с устройством.
+type Action string
+
+// Действия с устройством.
+const (
+	Read        Action = "read"         // просмотр описания, состояния и данных устройства
+	Write       Action = "write"        // изменение описания и настроек устройства
+	Manage      Action = "manage"       // отвязка устройства и управление его токенами
+	PostTracks  Action = "post.tracks"  // передача данных о треках устройства
+	PostSensors Action = "post.sensors" // передача данных сенсоров устройства
+)
+
+var (
+	// ErrForbidden возвращается, если действие с устройством не разрешено.
+	ErrForbidden = errors.New("access denied")
+	// ErrNotFound возвращается, если устройство не относится к группе. Чтобы нельзя было
+	// узнать о существовании устройств других групп, эта ошибка возвращается вместо
+	// ErrForbidden.
+	ErrNotFound = errors.New("device not found")
+)
+
+// roles задает минимальную роль пользователя в группе, необходимую для действия.
+var roles = map[Action]string{
+	Read:        users.RoleViewer,
+	Write:       users.RoleMember,
+	Manage:      users.RoleAdmin,
+	PostTracks:  users.RoleMember,
+	PostSensors: users.RoleMember,
+}
+
+// scopes задает область доступа токена устройства, необходимую для действия. Действия,
+// которых нет в этом списке, устройствам не разрешены.
+var scopes = map[Action]string{
+	PostTracks:  token.ScopeTracks,
+	PostSensors: token.ScopeSensors,
+}
+
+// Subject описывает того, кто выполняет действие: пользователя или устройство.
+type Subject struct {
+	GroupID  string   // идентификатор группы
+	Role     string   // роль пользователя в группе
+	DeviceID string   // идентификатор устройства, если действие выполняется устройством
+	Scopes   []string // области доступа токена устройства
+}
+
+// IsDevice возвращает true, если действие выполняется устройством.
+func (s *Subject) IsDevice() bool {
+	return s.DeviceID != ""
+}
+
+// hasScope возвращает true, если у устройства есть указанная область доступа.
+func (s *Subject) hasScope(scope string) bool {
+	for _, name := range s.Scopes {
+		if name == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Device описывает устройство, с которым выполняется действие.
+type Device struct {
+	ID      string // идентификатор устройства
+	GroupID string // группа, в которой зарегистрировано устройство; пустая, если не зарегистрировано
+}
+
+// Check проверяет, разрешено ли действие с устройством. Возвращает nil, если действие
+// разрешено, ErrNotFound, если устройство не относится к группе, и ErrForbidden, если
+// действие запрещено.
+//
+// Данные устройств, не зарегистрированных ни в одной группе, пользователи могут только
+// просматривать: при этом им доступны только данные, полученные их группой.
+func Check(subject *Subject, action Action, device *Device) error {
+	if subject == nil || device == nil || subject.GroupID == "" {
+		return ErrForbidden
+	}
+	if _, ok := roles[action]; !ok {
+		return ErrForbidden
+	}
+	if subject.IsDevice() {
+		// устройство может передавать только свои данные
+		scope, ok := scopes[action]
+		if !ok || subject.DeviceID != device.ID || subject.GroupID != device.GroupID {
+			return ErrForbidden
+		}
+		if !subject.hasScope(scope) {
+			return ErrForbidden
+		}
+		return nil
+	}
+	switch device.GroupID {
+	case subject.GroupID:
+	case "":
+		if action != Read {
+			return ErrNotFound
+		}
+	default:
+		return ErrNotFound
+	}
+	if !users.HasRole(subject.Role, roles[action]) {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/mdigger/geotrack/token"
+	"github.com/mdigger/geotrack/users"
+)
+
+func TestCheck(t *testing.T) {
+	var (
+		own      = &Device{ID: "device0000000001", GroupID: "group"}
+		foreign  = &Device{ID: "device0000000002", GroupID: "other"}
+		unpaired = &Device{ID: "device0000000003"}
+		viewer   = &Subject{GroupID: "group", Role: users.RoleViewer}
+		member   = &Subject{GroupID: "group", Role: users.RoleMember}
+		admin    = &Subject{GroupID: "group", Role: users.RoleAdmin}
+		owner    = &Subject{GroupID: "group", Role: users.RoleOwner}
+		tracker  = &Subject{GroupID: "group", DeviceID: own.ID, Scopes: token.DeviceScopes}
+		tracks   = &Subject{GroupID: "group", DeviceID: own.ID, Scopes: []string{token.ScopeTracks}}
+		stranger = &Subject{GroupID: "other", DeviceID: own.ID, Scopes: token.DeviceScopes}
+	)
+	for i, test := range []struct {
+		subject *Subject
+		action  Action
+		device  *Device
+		err     error
+	}{
+		// пользователи группы
+		{viewer, Read, own, nil},
+		{viewer, Write, own, ErrForbidden},
+		{viewer, PostTracks, own, ErrForbidden},
+		{viewer, Manage, own, ErrForbidden},
+		{member, Read, own, nil},
+		{member, Write, own, nil},
+		{member, PostTracks, own, nil},
+		{member, PostSensors, own, nil},
+		{member, Manage, own, ErrForbidden},
+		{admin, Manage, own, nil},
+		{owner, Manage, own, nil},
+		{&Subject{GroupID: "group"}, Read, own, ErrForbidden},
+		{&Subject{GroupID: "group", Role: "guest"}, Read, own, ErrForbidden},
+		{owner, Action("delete"), own, ErrForbidden},
+		// устройства других групп
+		{viewer, Read, foreign, ErrNotFound},
+		{member, PostTracks, foreign, ErrNotFound},
+		{owner, Manage, foreign, ErrNotFound},
+		// устройства, не зарегистрированные в группах
+		{viewer, Read, unpaired, nil},
+		{member, Write, unpaired, ErrNotFound},
+		{member, PostTracks, unpaired, ErrNotFound},
+		{owner, Manage, unpaired, ErrNotFound},
+		// токены устройств
+		{tracker, PostTracks, own, nil},
+		{tracker, PostSensors, own, nil},
+		{tracks, PostTracks, own, nil},
+		{tracks, PostSensors, own, ErrForbidden},
+		{tracker, Read, own, ErrForbidden},
+		{tracker, Write, own, ErrForbidden},
+		{tracker, Manage, own, ErrForbidden},
+		{tracker, PostTracks, &Device{ID: "device0000000004", GroupID: "group"}, ErrForbidden},
+		{tracker, PostTracks, unpaired, ErrForbidden},
+		{stranger, PostTracks, own, ErrForbidden},
+		// неполные данные
+		{nil, Read, own, ErrForbidden},
+		{viewer, Read, nil, ErrForbidden},
+		{&Subject{Role: users.RoleOwner}, Read, unpaired, ErrForbidden},
+	} {
+		if err := Check(test.subject, test.action, test.device); err != test.err {
+			t.Errorf("%d: %+v %v %+v: %v, expected %v", i, test.subject, test.action,
+				test.device, err, test.err)
+		}
+	}
+}
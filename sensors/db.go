@@ -29,6 +29,7 @@ func InitDB(mdb *mongo.DB) (db *DB, err error) {
 	if err = coll.EnsureIndexKey("groupid", "deviceid", "-_id"); err != nil {
 		return
 	}
+	err = initReadings(db)
 	return
 }
 
@@ -36,6 +37,7 @@ func InitDB(mdb *mongo.DB) (db *DB, err error) {
 type SensorData struct {
 	GroupID  string                 // идентификатор группы
 	DeviceID string                 // уникальный идентификатор устройства
+	Model    string                 `bson:",omitempty" json:",omitempty"` // модель устройства
 	Time     time.Time              // временная метка
 	Data     map[string]interface{} // именованные значения датчиков
 }
@@ -0,0 +1,367 @@
+package sensors
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	// SchemasCollectionName описывает название коллекции с описаниями сенсоров.
+	SchemasCollectionName = "sensors.schemas"
+	// ReadingsCollectionName описывает название коллекции с нормализованными значениями сенсоров.
+	ReadingsCollectionName = "sensors.readings"
+)
+
+// Типы значений сенсоров.
+const (
+	TypeNumber = "number" // числовое значение
+	TypeBool   = "bool"   // логическое значение
+	TypeString = "string" // строка
+)
+
+// Schema описывает сенсор: его название, тип и единицы измерения значения, а так же
+// допустимый диапазон значений. Описание может относиться к конкретной модели устройства
+// или ко всем моделям, если модель не указана.
+type Schema struct {
+	Name   string   // название сенсора
+	Model  string   `json:",omitempty"` // модель устройства
+	Type   string   // тип значения
+	Unit   string   `bson:",omitempty" json:",omitempty"` // единицы измерения
+	Min    *float64 `bson:",omitempty" json:",omitempty"` // минимальное допустимое значение
+	Max    *float64 `bson:",omitempty" json:",omitempty"` // максимальное допустимое значение
+	Reject bool     `bson:",omitempty" json:",omitempty"` // отбрасывать значения вне диапазона
+}
+
+var (
+	// ErrBadType возвращается, если тип значения не соответствует описанию сенсора.
+	ErrBadType = errors.New("bad sensor value type")
+	// ErrOutOfRange возвращается, если значение выходит за пределы допустимого диапазона.
+	ErrOutOfRange = errors.New("sensor value out of range")
+	// ErrBadSchema возвращается при сохранении некорректного описания сенсора.
+	ErrBadSchema = errors.New("bad sensor schema")
+)
+
+// Verify проверяет корректность описания сенсора: название и тип значения обязательны,
+// а диапазон допустимых значений задается только для числовых сенсоров.
+func (s Schema) Verify() error {
+	if s.Name == "" {
+		return ErrBadSchema
+	}
+	switch s.Type {
+	case TypeNumber:
+		if s.Min != nil && s.Max != nil && *s.Min > *s.Max {
+			return ErrBadSchema
+		}
+	case TypeBool, TypeString:
+		if s.Min != nil || s.Max != nil {
+			return ErrBadSchema
+		}
+	default:
+		return ErrBadSchema
+	}
+	return nil
+}
+
+// Check проверяет значение сенсора на соответствие описанию и возвращает его
+// в нормализованном виде: числовые значения всегда приводятся к float64.
+func (s Schema) Check(value interface{}) (interface{}, error) {
+	switch s.Type {
+	case TypeNumber:
+		var number float64
+		switch v := value.(type) {
+		case float64:
+			number = v
+		case float32:
+			number = float64(v)
+		case int:
+			number = float64(v)
+		case int32:
+			number = float64(v)
+		case int64:
+			number = float64(v)
+		default:
+			return nil, ErrBadType
+		}
+		if (s.Min != nil && number < *s.Min) || (s.Max != nil && number > *s.Max) {
+			return number, ErrOutOfRange
+		}
+		return number, nil
+	case TypeBool:
+		if _, ok := value.(bool); !ok {
+			return nil, ErrBadType
+		}
+	case TypeString:
+		if _, ok := value.(string); !ok {
+			return nil, ErrBadType
+		}
+	}
+	return value, nil
+}
+
+// Range возвращает указатель на значение. Используется для задания диапазона
+// допустимых значений сенсора.
+func Range(value float64) *float64 {
+	return &value
+}
+
+// DefaultSchemas содержит описания стандартных сенсоров, поддерживаемых всеми устройствами.
+var DefaultSchemas = []Schema{
+	{Name: "Battery", Type: TypeNumber, Unit: "%", Min: Range(0), Max: Range(100), Reject: true},
+	{Name: "NumberOfSteps", Type: TypeNumber, Unit: "steps", Min: Range(0)},
+	{Name: "Temperature", Type: TypeNumber, Unit: "°C", Min: Range(-40), Max: Range(85)},
+	{Name: "HeartRate", Type: TypeNumber, Unit: "bpm", Min: Range(20), Max: Range(250)},
+	{Name: "IsBraceletOn", Type: TypeBool},
+	{Name: "SOS", Type: TypeBool},
+	{Name: "Fall", Type: TypeBool},
+}
+
+// Registry описывает справочник сенсоров. Безопасен для одновременного использования.
+type Registry struct {
+	schemas map[string]Schema
+	mu      sync.RWMutex
+}
+
+// NewRegistry возвращает новый справочник с указанными описаниями сенсоров.
+func NewRegistry(schemas ...Schema) *Registry {
+	r := &Registry{schemas: make(map[string]Schema, len(schemas))}
+	for _, schema := range schemas {
+		r.Add(schema)
+	}
+	return r
+}
+
+// Reset заменяет все описания сенсоров в справочнике на указанные.
+func (r *Registry) Reset(schemas ...Schema) {
+	list := make(map[string]Schema, len(schemas))
+	for _, schema := range schemas {
+		list[registryKey(schema.Model, schema.Name)] = schema
+	}
+	r.mu.Lock()
+	r.schemas = list
+	r.mu.Unlock()
+}
+
+// registryKey возвращает ключ справочника для модели устройства и названия сенсора.
+func registryKey(model, name string) string {
+	return model + "/" + name
+}
+
+// Add добавляет описание сенсора в справочник, заменяя описание с тем же названием
+// для той же модели.
+func (r *Registry) Add(schema Schema) {
+	r.mu.Lock()
+	r.schemas[registryKey(schema.Model, schema.Name)] = schema
+	r.mu.Unlock()
+}
+
+// Lookup возвращает описание сенсора для указанной модели устройства. Если для модели
+// нет отдельного описания, то возвращается общее описание сенсора.
+func (r *Registry) Lookup(model, name string) (schema Schema, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if model != "" {
+		if schema, ok = r.schemas[registryKey(model, name)]; ok {
+			return
+		}
+	}
+	schema, ok = r.schemas[registryKey("", name)]
+	return
+}
+
+// Schemas возвращает список всех описаний сенсоров, отсортированный по названию.
+func (r *Registry) Schemas() []Schema {
+	r.mu.RLock()
+	keys := make([]string, 0, len(r.schemas))
+	for key := range r.schemas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	schemas := make([]Schema, len(keys))
+	for i, key := range keys {
+		schemas[i] = r.schemas[key]
+	}
+	r.mu.RUnlock()
+	return schemas
+}
+
+// Reading описывает нормализованное значение одного сенсора.
+type Reading struct {
+	GroupID  string      // идентификатор группы
+	DeviceID string      // уникальный идентификатор устройства
+	Time     time.Time   // временная метка
+	Name     string      // название сенсора
+	Value    interface{} // значение
+	Unit     string      `bson:",omitempty" json:",omitempty"` // единицы измерения
+	Flagged  bool        `bson:",omitempty" json:",omitempty"` // значение вне допустимого диапазона
+}
+
+// Issue описывает проблему, обнаруженную при проверке значения сенсора.
+type Issue struct {
+	DeviceID string      // уникальный идентификатор устройства
+	Time     time.Time   // временная метка
+	Name     string      // название сенсора
+	Value    interface{} // полученное значение
+	Error    string      // описание проблемы
+	Rejected bool        // значение отброшено
+}
+
+// Validate проверяет значения сенсоров по справочнику и возвращает их в нормализованном
+// виде, по одной записи на каждый сенсор. Значения с неверным типом отбрасываются. Значения
+// вне допустимого диапазона помечаются или отбрасываются, в зависимости от описания сенсора.
+// Значения сенсоров, для которых нет описания, сохраняются без проверки.
+func (r *Registry) Validate(data SensorData) (readings []Reading, issues []Issue) {
+	readings = make([]Reading, 0, len(data.Data))
+	for name, value := range data.Data {
+		reading := Reading{
+			GroupID:  data.GroupID,
+			DeviceID: data.DeviceID,
+			Time:     data.Time,
+			Name:     name,
+			Value:    value,
+		}
+		if schema, ok := r.Lookup(data.Model, name); ok {
+			normalized, err := schema.Check(value)
+			if err != nil {
+				issue := Issue{
+					DeviceID: data.DeviceID,
+					Time:     data.Time,
+					Name:     name,
+					Value:    value,
+					Error:    err.Error(),
+					Rejected: err == ErrBadType || schema.Reject,
+				}
+				issues = append(issues, issue)
+				if issue.Rejected {
+					continue
+				}
+				reading.Flagged = true
+			}
+			reading.Value = normalized
+			reading.Unit = schema.Unit
+		}
+		readings = append(readings, reading)
+	}
+	return readings, issues
+}
+
+// Rejected возвращает true, если хотя бы одно значение было отброшено.
+func Rejected(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Rejected {
+			return true
+		}
+	}
+	return false
+}
+
+// String возвращает текстовое описание проблемы.
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s (%v)", i.Name, i.Error, i.Value)
+}
+
+// Schemas возвращает список описаний сенсоров, сохраненных в хранилище.
+func (db *DB) Schemas() (schemas []Schema, err error) {
+	coll := db.GetCollection(SchemasCollectionName)
+	schemas = make([]Schema, 0)
+	err = coll.Find(nil).Select(bson.M{"_id": 0}).Sort("name", "model").All(&schemas)
+	db.FreeCollection(coll)
+	return
+}
+
+// LoadRegistry возвращает справочник сенсоров, содержащий стандартные описания и описания,
+// сохраненные в хранилище. Сохраненные описания имеют приоритет перед стандартными.
+func (db *DB) LoadRegistry() (*Registry, error) {
+	schemas, err := db.Schemas()
+	if err != nil {
+		return nil, err
+	}
+	return NewRegistry(append(DefaultSchemas, schemas...)...), nil
+}
+
+// Reload заново загружает в справочник стандартные описания сенсоров и описания,
+// сохраненные в хранилище. При ошибке справочник не изменяется.
+func (db *DB) Reload(registry *Registry) error {
+	schemas, err := db.Schemas()
+	if err != nil {
+		return err
+	}
+	registry.Reset(append(DefaultSchemas, schemas...)...)
+	return nil
+}
+
+// ReloadInterval задает интервал, с которым сервисы перечитывают описания сенсоров.
+var ReloadInterval = time.Minute
+
+// Watch периодически перечитывает описания сенсоров из хранилища в справочник, передавая
+// ошибки загрузки в функцию onError. Функция не возвращает управление и должна запускаться
+// в отдельном потоке.
+func (db *DB) Watch(registry *Registry, onError func(error)) {
+	for range time.Tick(ReloadInterval) {
+		if err := db.Reload(registry); err != nil {
+			onError(err)
+		}
+	}
+}
+
+// SaveSchema проверяет и сохраняет описание сенсора в хранилище.
+func (db *DB) SaveSchema(schema Schema) (err error) {
+	if err = schema.Verify(); err != nil {
+		return
+	}
+	coll := db.GetCollection(SchemasCollectionName)
+	_, err = coll.Upsert(bson.M{"name": schema.Name, "model": schema.Model}, schema)
+	db.FreeCollection(coll)
+	return
+}
+
+// RemoveSchema удаляет сохраненное описание сенсора для указанной модели устройства.
+// Стандартные описания сенсоров удалить нельзя, но их можно переопределить.
+func (db *DB) RemoveSchema(model, name string) (err error) {
+	coll := db.GetCollection(SchemasCollectionName)
+	err = coll.Remove(bson.M{"name": name, "model": model})
+	db.FreeCollection(coll)
+	return
+}
+
+// AddReadings добавляет нормализованные значения сенсоров в хранилище.
+func (db *DB) AddReadings(readings ...Reading) (err error) {
+	if len(readings) == 0 {
+		return nil
+	}
+	data := make([]interface{}, len(readings))
+	for i, item := range readings {
+		data[i] = item
+	}
+	coll := db.GetCollection(ReadingsCollectionName)
+	err = coll.Insert(data...)
+	db.FreeCollection(coll)
+	return
+}
+
+// initReadings создает индексы для коллекций описаний и значений сенсоров.
+func initReadings(db *DB) (err error) {
+	coll := db.GetCollection(SchemasCollectionName)
+	err = coll.EnsureIndex(mgo.Index{
+		Key:    []string{"name", "model"},
+		Unique: true,
+	})
+	db.FreeCollection(coll)
+	if err != nil {
+		return
+	}
+	coll = db.GetCollection(ReadingsCollectionName)
+	defer db.FreeCollection(coll)
+	if err = coll.EnsureIndex(mgo.Index{
+		Key:         []string{"time"},
+		ExpireAfter: ExpireAfter,
+	}); err != nil {
+		return
+	}
+	return coll.EnsureIndexKey("groupid", "deviceid", "name", "time")
+}
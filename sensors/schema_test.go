@@ -0,0 +1,80 @@
+package sensors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry(DefaultSchemas...)
+	registry.Add(Schema{Name: "Temperature", Model: "T2", Type: TypeNumber, Unit: "°F"})
+	if schema, ok := registry.Lookup("T2", "Temperature"); !ok || schema.Unit != "°F" {
+		t.Errorf("bad model schema: %+v", schema)
+	}
+	if schema, ok := registry.Lookup("T1", "Temperature"); !ok || schema.Unit != "°C" {
+		t.Errorf("bad default schema: %+v", schema)
+	}
+
+	data := SensorData{
+		GroupID:  "group",
+		DeviceID: "test0123456789",
+		Time:     time.Now(),
+		Data: map[string]interface{}{
+			"Battery":      120.0,   // вне диапазона: отбрасывается
+			"Temperature":  90.0,    // вне диапазона: помечается
+			"IsBraceletOn": "yes",   // неверный тип: отбрасывается
+			"SOS":          true,    // корректное значение
+			"Custom":       "value", // нет описания: сохраняется как есть
+		},
+	}
+	readings, issues := registry.Validate(data)
+	if len(issues) != 3 || !Rejected(issues) {
+		t.Errorf("bad issues: %v", issues)
+	}
+	values := make(map[string]Reading, len(readings))
+	for _, reading := range readings {
+		values[reading.Name] = reading
+	}
+	if len(values) != 3 {
+		t.Errorf("bad readings: %v", readings)
+	}
+	if reading, ok := values["Temperature"]; !ok || !reading.Flagged || reading.Unit != "°C" {
+		t.Errorf("bad temperature reading: %+v", reading)
+	}
+	if reading, ok := values["SOS"]; !ok || reading.Flagged || reading.Value != true {
+		t.Errorf("bad SOS reading: %+v", reading)
+	}
+	if _, ok := values["Custom"]; !ok {
+		t.Error("missing custom reading")
+	}
+}
+
+func TestRegistryReset(t *testing.T) {
+	registry := NewRegistry(DefaultSchemas...)
+	registry.Reset(Schema{Name: "Pressure", Type: TypeNumber, Unit: "hPa"})
+	if _, ok := registry.Lookup("", "Battery"); ok {
+		t.Error("schema not removed after reset")
+	}
+	if schema, ok := registry.Lookup("T1", "Pressure"); !ok || schema.Unit != "hPa" {
+		t.Errorf("bad schema after reset: %+v", schema)
+	}
+}
+
+func TestSchemaVerify(t *testing.T) {
+	for _, schema := range DefaultSchemas {
+		if err := schema.Verify(); err != nil {
+			t.Errorf("%v: %v", schema.Name, err)
+		}
+	}
+	for _, schema := range []Schema{
+		{Type: TypeNumber},
+		{Name: "Pressure"},
+		{Name: "Pressure", Type: "float"},
+		{Name: "Pressure", Type: TypeNumber, Min: Range(10), Max: Range(0)},
+		{Name: "SOS", Type: TypeBool, Max: Range(1)},
+	} {
+		if err := schema.Verify(); err != ErrBadSchema {
+			t.Errorf("bad schema accepted: %+v", schema)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mdigger/geotrack/mongo"
+	"github.com/mdigger/geotrack/sensors"
+)
+
+func main() {
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.Ltime)
+	mongourl := flag.String("mongo", "mongodb://localhost/watch", "mongoDB connection URL")
+	remove := flag.String("remove", "", "remove stored schema of sensor with this `name`")
+	model := flag.String("model", "", "device model of removed schema")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, "List, save or remove sensor schemas\n")
+		fmt.Fprintf(os.Stderr, "%s [-params] [schemas.json]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// устанавливаем соединение с сервером MongoDB
+	log.Printf("Connecting to MongoDB %q...", *mongourl)
+	mdb, err := mongo.Connect(*mongourl)
+	if err != nil {
+		log.Printf("Error connecting to MongoDB: %v", err)
+		return
+	}
+	defer mdb.Close()
+
+	sensorsDB, err := sensors.InitDB(mdb)
+	if err != nil {
+		log.Printf("Error initializing sensors: %v", err)
+		return
+	}
+
+	switch {
+	case *remove != "":
+		if err := sensorsDB.RemoveSchema(*model, *remove); err != nil {
+			log.Printf("Error removing schema %q of model %q: %v", *remove, *model, err)
+			return
+		}
+		log.Printf("Schema %q of model %q removed", *remove, *model)
+	case flag.NArg() > 0:
+		// файл содержит массив описаний сенсоров в формате JSON
+		for _, filename := range flag.Args() {
+			file, err := os.Open(filename)
+			if err != nil {
+				log.Printf("Error opening schemas: %v", err)
+				return
+			}
+			var schemas []sensors.Schema
+			err = json.NewDecoder(file).Decode(&schemas)
+			file.Close()
+			if err != nil {
+				log.Printf("Error parsing schemas %q: %v", filename, err)
+				return
+			}
+			for _, schema := range schemas {
+				if err := sensorsDB.SaveSchema(schema); err != nil {
+					log.Printf("Error saving schema %q of model %q: %v", schema.Name, schema.Model, err)
+					return
+				}
+				log.Printf("Schema %q of model %q saved", schema.Name, schema.Model)
+			}
+		}
+	default:
+		schemas, err := sensorsDB.Schemas()
+		if err != nil {
+			log.Printf("Error reading schemas: %v", err)
+			return
+		}
+		data, err := json.MarshalIndent(schemas, "", "\t")
+		if err != nil {
+			log.Printf("Error encoding schemas: %v", err)
+			return
+		}
+		fmt.Printf("%s\n", data)
+		return
+	}
+	// сервисы перечитывают описания сенсоров периодически
+	log.Print("Changes will be applied by services after the next schemas reload")
+}
@@ -0,0 +1,77 @@
+package sensors
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// SeriesPoint описывает агрегированные значения сенсора за интервал времени.
+type SeriesPoint struct {
+	Time  time.Time // время начала интервала
+	Min   float64   // минимальное значение
+	Max   float64   // максимальное значение
+	Avg   float64   // среднее значение
+	Last  float64   // последнее значение
+	Count int       // количество значений
+}
+
+// Series возвращает значения числового сенсора устройства за указанный период времени,
+// агрегированные по интервалам заданной длительности. Интервалы отсчитываются от начала
+// периода; интервалы, за которые не было получено значений, в результат не попадают.
+// Агрегация выполняется средствами MongoDB по нормализованным значениям сенсоров.
+func (db *DB) Series(groupID, deviceID, name string, from, to time.Time, step time.Duration) (
+	series []SeriesPoint, err error) {
+	stepMs := int64(step / time.Millisecond)
+	if stepMs < 1 {
+		stepMs = 1
+	}
+	// смещение от начала периода в миллисекундах
+	offset := bson.M{"$subtract": []interface{}{"$time", from}}
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"groupid":  groupID,
+			"deviceid": deviceID,
+			"name":     name,
+			"time":     bson.M{"$gte": from, "$lt": to},
+			"value":    bson.M{"$type": 1}, // только числовые значения
+		}},
+		{"$sort": bson.M{"time": 1}},
+		{"$group": bson.M{
+			"_id": bson.M{"$subtract": []interface{}{
+				offset, bson.M{"$mod": []interface{}{offset, stepMs}}}},
+			"min":   bson.M{"$min": "$value"},
+			"max":   bson.M{"$max": "$value"},
+			"avg":   bson.M{"$avg": "$value"},
+			"last":  bson.M{"$last": "$value"},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.M{"_id": 1}},
+	}
+	var result []struct {
+		Bucket int64 `bson:"_id"`
+		Min    float64
+		Max    float64
+		Avg    float64
+		Last   float64
+		Count  int
+	}
+	coll := db.GetCollection(ReadingsCollectionName)
+	err = coll.Pipe(pipeline).All(&result)
+	db.FreeCollection(coll)
+	if err != nil {
+		return nil, err
+	}
+	series = make([]SeriesPoint, len(result))
+	for i, item := range result {
+		series[i] = SeriesPoint{
+			Time:  from.Add(time.Duration(item.Bucket) * time.Millisecond),
+			Min:   item.Min,
+			Max:   item.Max,
+			Avg:   item.Avg,
+			Last:  item.Last,
+			Count: item.Count,
+		}
+	}
+	return series, nil
+}
@@ -0,0 +1,242 @@
+package states
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mdigger/geotrack/geo"
+	"github.com/mdigger/geotrack/mongo"
+	"github.com/mdigger/geotrack/sensors"
+	"github.com/mdigger/geotrack/tracks"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	// CollectionName описывает название коллекции с текущим состоянием устройств.
+	CollectionName = "states"
+
+	// EventsCollectionName описывает название коллекции с событиями подключения
+	// и отключения устройств.
+	EventsCollectionName = "states.events"
+
+	// OnlineTimeout задает время с момента получения последних данных от устройства,
+	// в течение которого устройство считается находящимся на связи. Для каждого устройства
+	// может быть задано собственное значение.
+	OnlineTimeout = 15 * time.Minute
+
+	// ExpireAfter описывает время хранения событий подключения и отключения устройств.
+	ExpireAfter = 31 * 24 * time.Hour
+)
+
+// Position описывает последние известные координаты устройства.
+type Position struct {
+	Time     time.Time // временная метка
+	Location geo.Point // координаты точки
+	Accuracy float64   // погрешность координат в метрах
+	Method   uint8     // метод получения координат
+}
+
+// Value описывает последнее полученное значение сенсора.
+type Value struct {
+	Time  time.Time   // временная метка
+	Value interface{} // значение
+}
+
+// State описывает текущее состояние устройства: последние известные координаты, уровень
+// заряда батареи, последние значения всех сенсоров и время получения последних данных.
+type State struct {
+	GroupID  string           `json:",omitempty"` // идентификатор группы
+	DeviceID string           // уникальный идентификатор устройства
+	LastSeen time.Time        // время получения последних данных от устройства
+	Online   bool             // устройство на связи
+	Timeout  int              `bson:",omitempty" json:",omitempty"` // время до отключения в минутах
+	Position *Position        `bson:",omitempty" json:",omitempty"` // последние координаты
+	Battery  uint8            `bson:",omitempty" json:",omitempty"` // уровень заряда батареи
+	Sensors  map[string]Value `bson:",omitempty" json:",omitempty"` // значения сенсоров
+}
+
+// DB описывает хранилище текущего состояния устройств.
+type DB struct {
+	*mongo.DB // соединение с MongoDB
+}
+
+// InitDB инициализирует хранилище текущего состояния устройств.
+func InitDB(mdb *mongo.DB) (db *DB, err error) {
+	db = &DB{mdb}
+	coll := mdb.GetCollection(CollectionName)
+	err = coll.EnsureIndex(mgo.Index{
+		Key:    []string{"groupid", "deviceid"},
+		Unique: true,
+	})
+	mdb.FreeCollection(coll)
+	if err != nil {
+		return
+	}
+	err = initEvents(db)
+	return
+}
+
+// timeout возвращает время, после которого устройство считается отключенным.
+func (s State) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return time.Duration(s.Timeout) * time.Minute
+	}
+	return OnlineTimeout
+}
+
+// seen отмечает время получения данных от устройства, создавая описание его состояния,
+// если оно еще не существует. Если устройство было отключено, а данные получены недавно,
+// то устройство отмечается как находящееся на связи и возвращается событие подключения.
+func (db *DB) seen(coll *mgo.Collection, groupID, deviceID string, t time.Time) (*Event, error) {
+	selector := bson.M{"groupid": groupID, "deviceid": deviceID}
+	var old State
+	_, err := coll.Find(selector).Apply(mgo.Change{
+		Update: bson.M{"$max": bson.M{"lastseen": t}},
+		Upsert: true,
+	}, &old)
+	if err != nil {
+		return nil, err
+	}
+	if old.Online || time.Since(t) >= old.timeout() {
+		return nil, nil
+	}
+	selector["online"] = bson.M{"$ne": true}
+	err = coll.Update(selector, bson.M{"$set": bson.M{"online": true}})
+	if err == mgo.ErrNotFound {
+		return nil, nil // состояние уже изменено параллельно
+	}
+	if err != nil {
+		return nil, err
+	}
+	event := &Event{
+		GroupID:  groupID,
+		DeviceID: deviceID,
+		Time:     t,
+		Online:   true,
+		LastSeen: old.LastSeen,
+	}
+	return event, db.addEvent(event)
+}
+
+// older возвращает условие выбора состояния устройства, в котором значение поля
+// отсутствует или получено раньше указанного времени.
+func older(groupID, deviceID, field string, t time.Time) bson.M {
+	return bson.M{
+		"groupid":  groupID,
+		"deviceid": deviceID,
+		"$or": []bson.M{
+			{field: bson.M{"$exists": false}},
+			{field: bson.M{"$lt": t}},
+		},
+	}
+}
+
+// UpdateTracks обновляет состояние устройств по данным трекинга. Координаты и уровень
+// заряда изменяются только в том случае, если данные свежее уже сохраненных. Возвращает
+// список событий подключения устройств, которые до этого были отключены.
+func (db *DB) UpdateTracks(list ...tracks.TrackData) (events []Event, err error) {
+	// выбираем самые свежие данные для каждого устройства
+	latest := make(map[string]tracks.TrackData)
+	for _, track := range list {
+		key := track.GroupID + "/" + track.DeviceID
+		if last, ok := latest[key]; !ok || track.Time.After(last.Time) {
+			latest[key] = track
+		}
+	}
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	events = make([]Event, 0)
+	for _, track := range latest {
+		event, err := db.seen(coll, track.GroupID, track.DeviceID, track.Time)
+		if err != nil {
+			return events, err
+		}
+		if event != nil {
+			events = append(events, *event)
+		}
+		update := bson.M{"position": Position{
+			Time:     track.Time,
+			Location: track.Location,
+			Accuracy: track.Accuracy,
+			Method:   track.Method,
+		}}
+		if track.Power > 0 {
+			update["battery"] = track.Power
+		}
+		err = coll.Update(older(track.GroupID, track.DeviceID, "position.time", track.Time),
+			bson.M{"$set": update})
+		if err != nil && err != mgo.ErrNotFound {
+			return events, err
+		}
+	}
+	return events, nil
+}
+
+// UpdateSensors обновляет последние значения сенсоров устройств. Значение сенсора
+// изменяется только в том случае, если оно свежее уже сохраненного. Сенсоры, названия
+// которых не могут использоваться в качестве имен полей MongoDB, игнорируются. Возвращает
+// список событий подключения устройств, которые до этого были отключены.
+func (db *DB) UpdateSensors(list ...sensors.SensorData) (events []Event, err error) {
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	events = make([]Event, 0)
+	for _, data := range list {
+		event, err := db.seen(coll, data.GroupID, data.DeviceID, data.Time)
+		if err != nil {
+			return events, err
+		}
+		if event != nil {
+			events = append(events, *event)
+		}
+		for name, value := range data.Data {
+			if name == "" || strings.ContainsAny(name, ".$") {
+				continue
+			}
+			field := "sensors." + name
+			err = coll.Update(older(data.GroupID, data.DeviceID, field+".time", data.Time),
+				bson.M{"$set": bson.M{field: Value{Time: data.Time, Value: value}}})
+			if err != nil && err != mgo.ErrNotFound {
+				return events, err
+			}
+		}
+	}
+	return events, nil
+}
+
+// Get возвращает текущее состояние устройства группы.
+func (db *DB) Get(groupID, deviceID string) (state *State, err error) {
+	coll := db.GetCollection(CollectionName)
+	state = new(State)
+	err = coll.Find(bson.M{"groupid": groupID, "deviceid": deviceID}).
+		Select(bson.M{"_id": 0}).One(state)
+	db.FreeCollection(coll)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// GetAll возвращает текущее состояние всех устройств группы.
+func (db *DB) GetAll(groupID string) (states []State, err error) {
+	coll := db.GetCollection(CollectionName)
+	states = make([]State, 0)
+	err = coll.Find(bson.M{"groupid": groupID}).Select(bson.M{"_id": 0}).
+		Sort("deviceid").All(&states)
+	db.FreeCollection(coll)
+	return
+}
+
+// SetTimeout задает для устройства время с момента получения последних данных, после
+// которого устройство считается отключенным. Нулевое значение восстанавливает значение
+// по умолчанию.
+func (db *DB) SetTimeout(groupID, deviceID string, timeout time.Duration) (err error) {
+	update := bson.M{"$unset": bson.M{"timeout": ""}}
+	if minutes := int(timeout / time.Minute); minutes > 0 {
+		update = bson.M{"$set": bson.M{"timeout": minutes}}
+	}
+	coll := db.GetCollection(CollectionName)
+	_, err = coll.Upsert(bson.M{"groupid": groupID, "deviceid": deviceID}, update)
+	db.FreeCollection(coll)
+	return
+}
@@ -0,0 +1,67 @@
+package states
+
+import (
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdigger/geotrack/geo"
+	"github.com/mdigger/geotrack/mongo"
+	"github.com/mdigger/geotrack/sensors"
+	"github.com/mdigger/geotrack/tracks"
+)
+
+func TestDB(t *testing.T) {
+	mdb, err := mongo.Connect("mongodb://localhost/watch")
+	if err != nil {
+		log.Println("Error connecting to MongoDB:", err)
+		return
+	}
+	defer mdb.Close()
+
+	db, err := InitDB(mdb)
+	if err != nil {
+		t.Fatal("Connect error:", err)
+	}
+	const groupID, deviceID = "test", "test0123456789"
+	now := time.Now().Truncate(time.Millisecond)
+	_, err = db.UpdateTracks(
+		tracks.TrackData{GroupID: groupID, DeviceID: deviceID, Time: now,
+			Location: geo.NewPoint(37.589248, 55.765944), Power: 80},
+		tracks.TrackData{GroupID: groupID, DeviceID: deviceID, Time: now.Add(-time.Minute),
+			Location: geo.NewPoint(37.57351, 55.715084), Power: 81},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// устаревшие данные не должны изменять состояние
+	_, err = db.UpdateSensors(
+		sensors.SensorData{GroupID: groupID, DeviceID: deviceID, Time: now,
+			Data: map[string]interface{}{"Temperature": 36.6}},
+		sensors.SensorData{GroupID: groupID, DeviceID: deviceID, Time: now.Add(-time.Hour),
+			Data: map[string]interface{}{"Temperature": 35.0, "SOS": false}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := db.Get(groupID, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Online || !state.LastSeen.Equal(now) || state.Battery != 80 {
+		t.Errorf("bad state: %+v", state)
+	}
+	if state.Position == nil || state.Position.Location != geo.NewPoint(37.589248, 55.765944) {
+		t.Errorf("bad position: %+v", state.Position)
+	}
+	if state.Sensors["Temperature"].Value != 36.6 || state.Sensors["SOS"].Value != false {
+		t.Errorf("bad sensors: %+v", state.Sensors)
+	}
+	list, err := db.GetAll(groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) == 0 {
+		t.Error("empty states list")
+	}
+}
@@ -0,0 +1,153 @@
+package states
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Event описывает событие подключения или отключения устройства.
+type Event struct {
+	GroupID  string    // идентификатор группы
+	DeviceID string    // уникальный идентификатор устройства
+	Time     time.Time // время события
+	Online   bool      // устройство на связи
+	LastSeen time.Time `json:",omitempty"` // время получения последних данных до события
+}
+
+// initEvents создает индексы для коллекции событий подключения и отключения устройств.
+func initEvents(db *DB) (err error) {
+	coll := db.GetCollection(EventsCollectionName)
+	defer db.FreeCollection(coll)
+	if err = coll.EnsureIndex(mgo.Index{
+		Key:         []string{"time"},
+		ExpireAfter: ExpireAfter,
+	}); err != nil {
+		return
+	}
+	return coll.EnsureIndexKey("groupid", "deviceid", "time")
+}
+
+// addEvent сохраняет событие в хранилище.
+func (db *DB) addEvent(event *Event) (err error) {
+	coll := db.GetCollection(EventsCollectionName)
+	err = coll.Insert(event)
+	db.FreeCollection(coll)
+	return
+}
+
+// CheckOffline проверяет все устройства, находящиеся на связи, и отмечает как отключенные
+// те из них, от которых не поступали данные дольше заданного для устройства времени.
+// Возвращает список событий отключения устройств.
+func (db *DB) CheckOffline(now time.Time) (events []Event, err error) {
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	var list []State
+	err = coll.Find(bson.M{"online": true}).
+		Select(bson.M{"groupid": 1, "deviceid": 1, "lastseen": 1, "timeout": 1}).All(&list)
+	if err != nil {
+		return nil, err
+	}
+	events = make([]Event, 0)
+	for _, state := range list {
+		if now.Sub(state.LastSeen) < state.timeout() {
+			continue
+		}
+		// изменяем состояние, только если за это время не было получено новых данных
+		err = coll.Update(bson.M{
+			"groupid":  state.GroupID,
+			"deviceid": state.DeviceID,
+			"lastseen": state.LastSeen,
+			"online":   true,
+		}, bson.M{"$set": bson.M{"online": false}})
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return events, err
+		}
+		event := Event{
+			GroupID:  state.GroupID,
+			DeviceID: state.DeviceID,
+			Time:     now,
+			Online:   false,
+			LastSeen: state.LastSeen,
+		}
+		if err = db.addEvent(&event); err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Gap описывает интервал времени, в течение которого устройство не выходило на связь.
+type Gap struct {
+	From    time.Time // время получения последних данных перед отключением
+	To      time.Time // время получения первых данных после подключения
+	Ongoing bool      `json:",omitempty"` // устройство все еще не на связи
+}
+
+// Gaps возвращает список интервалов отсутствия связи с устройством, пересекающихся
+// с указанным периодом. Интервалы определяются по сохраненным событиям подключения
+// и отключения устройства.
+func (db *DB) Gaps(groupID, deviceID string, from, to time.Time) (list []Gap, err error) {
+	coll := db.GetCollection(EventsCollectionName)
+	defer db.FreeCollection(coll)
+	search := bson.M{"groupid": groupID, "deviceid": deviceID}
+	// последнее событие до начала периода определяет состояние на его начало
+	var events []Event
+	search["time"] = bson.M{"$lt": from}
+	err = coll.Find(search).Sort("-time").Limit(1).All(&events)
+	if err != nil {
+		return nil, err
+	}
+	var period []Event
+	search["time"] = bson.M{"$gte": from, "$lte": to}
+	if err = coll.Find(search).Sort("time").All(&period); err != nil {
+		return nil, err
+	}
+	return gaps(append(events, period...), from, to), nil
+}
+
+// gaps возвращает список интервалов отсутствия связи по отсортированному по времени списку
+// событий, ограниченных указанным периодом. Интервал начинается с момента получения
+// последних данных перед отключением, поэтому интервал, начавшийся до начала периода,
+// может быть обнаружен только по событию подключения.
+func gaps(events []Event, from, to time.Time) []Gap {
+	list := make([]Gap, 0)
+	var current *Gap
+	for _, event := range events {
+		switch {
+		case !event.Online && current == nil:
+			current = &Gap{From: event.LastSeen}
+		case event.Online:
+			gap := Gap{From: event.LastSeen, To: event.Time}
+			if current != nil {
+				gap.From = current.From
+				current = nil
+			}
+			if !gap.From.IsZero() && gap.To.After(from) && gap.From.Before(to) {
+				list = append(list, clip(gap, from, to))
+			}
+		}
+	}
+	if current != nil && current.From.Before(to) {
+		current.To = to
+		current.Ongoing = true
+		list = append(list, clip(*current, from, to))
+	}
+	return list
+}
+
+// clip ограничивает интервал указанным периодом.
+func clip(gap Gap, from, to time.Time) Gap {
+	if gap.From.Before(from) {
+		gap.From = from
+	}
+	if gap.To.After(to) {
+		gap.To = to
+	}
+	return gap
+}
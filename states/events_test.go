@@ -0,0 +1,39 @@
+package states
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGaps(t *testing.T) {
+	start := time.Date(2015, 12, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time {
+		return start.Add(time.Duration(hours) * time.Hour)
+	}
+	events := []Event{
+		{Time: at(1), Online: true},                     // первое подключение
+		{Time: at(3), Online: false, LastSeen: at(2)},   // отключение
+		{Time: at(5), Online: true, LastSeen: at(2)},    // подключение
+		{Time: at(8), Online: true, LastSeen: at(6)},    // подключение после устаревших данных
+		{Time: at(11), Online: false, LastSeen: at(10)}, // отключение до конца периода
+	}
+	list := gaps(events, at(0), at(12))
+	expected := []Gap{
+		{From: at(2), To: at(5)},
+		{From: at(6), To: at(8)},
+		{From: at(10), To: at(12), Ongoing: true},
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("bad gaps: %v", list)
+	}
+	for i, gap := range list {
+		if gap != expected[i] {
+			t.Errorf("bad gap %d: %v", i, gap)
+		}
+	}
+	// интервалы ограничиваются периодом
+	list = gaps(events, at(4), at(7))
+	if len(list) != 2 || !list[0].From.Equal(at(4)) || !list[1].To.Equal(at(7)) {
+		t.Errorf("bad clipped gaps: %v", list)
+	}
+}
@@ -0,0 +1,135 @@
+package token
+
+import (
+	"time"
+
+	"github.com/mdigger/geotrack/mongo"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	RevokedCollectionName  = "tokens.revoked"  // коллекция с отозванными токенами
+	RefreshCollectionName  = "tokens.refresh"  // коллекция с refresh-токенами
+	SubjectsCollectionName = "tokens.subjects" // коллекция с временем отзыва токенов пользователей
+)
+
+// DB описывает хранилище refresh-токенов и отозванных токенов в MongoDB.
+type DB struct {
+	*mongo.DB // соединение с MongoDB
+}
+
+// InitDB инициализирует хранилище токенов. Информация об отозванных токенах и устаревшие
+// refresh-токены удаляются MongoDB автоматически по окончании времени их действия.
+func InitDB(mdb *mongo.DB) (db *DB, err error) {
+	db = &DB{mdb}
+	for _, name := range []string{RevokedCollectionName, RefreshCollectionName, SubjectsCollectionName} {
+		coll := mdb.GetCollection(name)
+		err = coll.EnsureIndex(mgo.Index{
+			Key:         []string{"expires"},
+			ExpireAfter: time.Second, // удаляется сразу по наступлении времени
+		})
+		mdb.FreeCollection(coll)
+		if err != nil {
+			return
+		}
+	}
+	coll := mdb.GetCollection(RefreshCollectionName)
+	defer mdb.FreeCollection(coll)
+	if err = coll.EnsureIndexKey("family"); err != nil {
+		return
+	}
+	err = coll.EnsureIndexKey("subject")
+	return
+}
+
+// Revoke добавляет идентификатор токена в список отозванных.
+func (db *DB) Revoke(id string, expires time.Time) (err error) {
+	coll := db.GetCollection(RevokedCollectionName)
+	_, err = coll.UpsertId(id, bson.M{"$set": bson.M{"expires": expires}})
+	db.FreeCollection(coll)
+	return
+}
+
+// Revoked возвращает true, если токен с таким идентификатором отозван.
+func (db *DB) Revoked(id string) (bool, error) {
+	coll := db.GetCollection(RevokedCollectionName)
+	count, err := coll.FindId(id).Count()
+	db.FreeCollection(coll)
+	return count > 0, err
+}
+
+// AddRefresh сохраняет новый refresh-токен.
+func (db *DB) AddRefresh(refresh *Refresh) (err error) {
+	coll := db.GetCollection(RefreshCollectionName)
+	err = coll.Insert(refresh)
+	db.FreeCollection(coll)
+	return
+}
+
+// UseRefresh отмечает refresh-токен как использованный и возвращает информацию о нем.
+func (db *DB) UseRefresh(hash string) (refresh *Refresh, err error) {
+	coll := db.GetCollection(RefreshCollectionName)
+	defer db.FreeCollection(coll)
+	refresh = new(Refresh)
+	_, err = coll.Find(bson.M{"_id": hash, "used": false}).Apply(mgo.Change{
+		Update: bson.M{"$set": bson.M{"used": true}},
+	}, refresh)
+	if err != mgo.ErrNotFound {
+		return
+	}
+	// проверяем, не был ли этот токен уже использован
+	err = coll.FindId(hash).One(refresh)
+	if err == mgo.ErrNotFound {
+		return nil, ErrRefreshNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return refresh, ErrRefreshReused
+}
+
+// RemoveFamily удаляет все refresh-токены сеанса.
+func (db *DB) RemoveFamily(family string) (err error) {
+	coll := db.GetCollection(RefreshCollectionName)
+	_, err = coll.RemoveAll(bson.M{"family": family})
+	db.FreeCollection(coll)
+	return
+}
+
+// RemoveSubject удаляет все refresh-токены пользователя.
+func (db *DB) RemoveSubject(subject string) (err error) {
+	coll := db.GetCollection(RefreshCollectionName)
+	_, err = coll.RemoveAll(bson.M{"subject": subject})
+	db.FreeCollection(coll)
+	return
+}
+
+// RevokeSubject отзывает все токены доступа пользователя, выданные до указанного времени.
+func (db *DB) RevokeSubject(subject string, before, expires time.Time) (err error) {
+	coll := db.GetCollection(SubjectsCollectionName)
+	_, err = coll.UpsertId(subject, bson.M{"$set": bson.M{"before": before, "expires": expires}})
+	db.FreeCollection(coll)
+	return
+}
+
+// RevokedBefore возвращает время, до которого все выданные пользователю токены доступа
+// отозваны.
+func (db *DB) RevokedBefore(subject string) (before time.Time, err error) {
+	coll := db.GetCollection(SubjectsCollectionName)
+	defer db.FreeCollection(coll)
+	var info struct {
+		Before  time.Time
+		Expires time.Time
+	}
+	err = coll.FindId(subject).One(&info)
+	switch {
+	case err == mgo.ErrNotFound:
+		return time.Time{}, nil
+	case err != nil:
+		return
+	case time.Now().After(info.Expires): // MongoDB удаляет устаревшие записи не сразу
+		return time.Time{}, nil
+	}
+	return info.Before, nil
+}
@@ -0,0 +1,54 @@
+package token
+
+import (
+	"strings"
+	"time"
+)
+
+// TypeDevice задает тип токена устройства: такие токены выдаются трекерам и позволяют
+// только передавать данные от имени этого устройства.
+const TypeDevice = "device"
+
+// Области доступа токенов устройств.
+const (
+	ScopeTracks  = "tracks"  // передача данных о треках
+	ScopeSensors = "sensors" // передача данных сенсоров
+)
+
+var (
+	// DeviceScopes задает области доступа, выдаваемые устройству по умолчанию.
+	DeviceScopes = []string{ScopeTracks, ScopeSensors}
+	// DeviceExpire задает время жизни токена устройства.
+	DeviceExpire = time.Hour * 24 * 365
+)
+
+// DeviceToken формирует токен устройства группы с указанными областями доступа. Если
+// области доступа не указаны, то используются DeviceScopes. Вместе с токеном возвращается
+// его уникальный идентификатор, по которому можно проверить, что токен не был заменен.
+func (e *Engine) DeviceToken(groupID, deviceID string, scopes ...string) (tokenString, id string, err error) {
+	if len(scopes) == 0 {
+		scopes = DeviceScopes
+	}
+	return e.sign(map[string]interface{}{
+		"typ":    TypeDevice,
+		"device": deviceID,
+		"group":  groupID,
+		"scope":  strings.Join(scopes, " "),
+	}, DeviceExpire)
+}
+
+// IsDevice возвращает true, если данные получены из токена устройства.
+func IsDevice(data map[string]interface{}) bool {
+	return data["typ"] == TypeDevice
+}
+
+// HasScope возвращает true, если в данных токена есть указанная область доступа.
+func HasScope(data map[string]interface{}, scope string) bool {
+	scopes, _ := data["scope"].(string)
+	for _, name := range strings.Fields(scopes) {
+		if name == scope {
+			return true
+		}
+	}
+	return false
+}
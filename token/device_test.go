@@ -0,0 +1,41 @@
+package token
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeviceToken(t *testing.T) {
+	engine, err := Init("test", time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenString, id, err := engine.DeviceToken("group", "device0123456789", ScopeTracks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := engine.Parse(tokenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsDevice(data) || data["device"] != "device0123456789" || data["jti"] != id {
+		t.Errorf("bad device token: %v", data)
+	}
+	if !HasScope(data, ScopeTracks) || HasScope(data, ScopeSensors) {
+		t.Errorf("bad scopes: %v", data["scope"])
+	}
+	// токен устройства живет дольше токена пользователя
+	if exp := int64(data["exp"].(float64)); exp < time.Now().Add(DeviceExpire-time.Minute).Unix() {
+		t.Errorf("bad device token expire: %v", exp)
+	}
+	userToken, err := engine.Token(map[string]interface{}{"id": "user", "group": "group"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = engine.Parse(userToken); err != nil {
+		t.Fatal(err)
+	}
+	if IsDevice(data) || HasScope(data, ScopeTracks) {
+		t.Errorf("user token is device token: %v", data)
+	}
+}
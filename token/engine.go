@@ -17,15 +17,31 @@ import (
 // поддерживать возможность передачи токена в виде параметра.
 var AccessTokenParamName = "token"
 
+// RefreshExpire задает время жизни refresh-токена.
+var RefreshExpire = time.Hour * 24 * 30
+
+// SubjectClaim задает название поля токена доступа с идентификатором пользователя: по нему
+// проверяется, не были ли отозваны все токены пользователя. Этот же идентификатор
+// указывается при создании refresh-токенов.
+var SubjectClaim = "id"
+
+var (
+	// ErrRevoked возвращается при разборе отозванного токена.
+	ErrRevoked = errors.New("token revoked")
+	// ErrNoStore возвращается, если хранилище токенов не задано.
+	ErrNoStore = errors.New("token store is not set")
+)
+
 // Engine описывает класс для работы с токенами в формате JSON Web Token.
 type Engine struct {
-	issuer    string        // название сервиса
-	expire    time.Duration // время жизни ключа
-	cryptoKey []byte        // ключ для подписи JWT
+	issuer string        // название сервиса
+	expire time.Duration // время жизни ключа
+	keys   *KeySet       // ключи для подписи и проверки JWT
+	store  Store         // хранилище refresh-токенов и отозванных токенов
 }
 
-// Init инициализирует и возвращает класс для работы с токенами.
-// Если ключ для подписи указан пустой, то формируется новый случайный ключ.
+// Init инициализирует и возвращает класс для работы с токенами, подписываемыми алгоритмом
+// HS256. Если ключ для подписи указан пустой, то формируется новый случайный ключ.
 func Init(issuer string, expire time.Duration, cryptoKey []byte) (*Engine, error) {
 	if cryptoKey == nil {
 		cryptoKey = make([]byte, 256)
@@ -33,33 +49,85 @@ func Init(issuer string, expire time.Duration, cryptoKey []byte) (*Engine, error
 			return nil, err
 		}
 	}
+	keys, err := NewKeySet(NewHMACKey("default", cryptoKey))
+	if err != nil {
+		return nil, err
+	}
+	return InitKeys(issuer, expire, keys), nil
+}
+
+// InitKeys инициализирует и возвращает класс для работы с токенами, использующий для
+// подписи и проверки указанный набор ключей.
+func InitKeys(issuer string, expire time.Duration, keys *KeySet) *Engine {
 	return &Engine{
-		issuer:    issuer,
-		expire:    expire,
-		cryptoKey: cryptoKey,
-	}, nil
+		issuer: issuer,
+		expire: expire,
+		keys:   keys,
+	}
+}
+
+// Keys возвращает набор ключей, используемых для подписи и проверки токенов.
+func (e *Engine) Keys() *KeySet {
+	return e.keys
+}
+
+// SetStore задает хранилище refresh-токенов и отозванных токенов. Без хранилища
+// refresh-токены и отзыв токенов не поддерживаются.
+func (e *Engine) SetStore(store Store) {
+	e.store = store
 }
 
-// Token формирует и возвращает токен в формате JWT.
+// Token формирует и возвращает токен в формате JWT. Каждому токену присваивается
+// уникальный идентификатор (jti), по которому токен может быть отозван.
 func (e *Engine) Token(items map[string]interface{}) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256) // генерируем новый токен
-	for key, value := range items {          // добавляем в него наши данные
-		token.Claims[key] = value
+	tokenString, _, err := e.sign(items, e.expire)
+	return tokenString, err
+}
+
+// sign формирует токен с указанным временем жизни и возвращает его вместе с уникальным
+// идентификатором.
+func (e *Engine) sign(items map[string]interface{}, expire time.Duration) (tokenString, id string, err error) {
+	if id, err = newID(); err != nil {
+		return "", "", err
+	}
+	key := e.keys.Current()
+	if key == nil || key.sign == nil {
+		return "", "", ErrNoKeys
 	}
+	token := jwt.New(key.Method)     // генерируем новый токен
+	token.Header["kid"] = key.ID     // идентификатор ключа для проверки подписи
+	for name, value := range items { // добавляем в него наши данные
+		token.Claims[name] = value
+	}
+	token.Claims["jti"] = id
+	token.Claims["iat"] = time.Now().Unix()
 	if e.issuer != "" { // добавляем информацию о сервисе
 		token.Claims["iss"] = e.issuer
 	}
-	if e.expire != 0 { // время жизни токена
-		token.Claims["exp"] = time.Now().Add(e.expire).Unix()
+	if expire != 0 { // время жизни токена
+		token.Claims["exp"] = time.Now().Add(expire).Unix()
+	}
+	if tokenString, err = token.SignedString(key.sign); err != nil {
+		return "", "", err
 	}
-	return token.SignedString(e.cryptoKey)
+	return tokenString, id, nil
 }
 
 // verify является функцией для проверки целостности токена.
 func (e *Engine) verify(token *jwt.Token) (key interface{}, err error) {
-	key = e.cryptoKey // ключ, используемый для подписи
+	// выбираем ключ по его идентификатору: токены без идентификатора проверяются текущим
+	var signKey *Key
+	if kid, ok := token.Header["kid"].(string); ok {
+		signKey = e.keys.Get(kid)
+	} else {
+		signKey = e.keys.Current()
+	}
+	if signKey == nil {
+		return nil, ErrUnknownKey
+	}
+	key = signKey.verify
 	// проверяем метод вычисления сигнатуры и обязательные поля
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+	if token.Method.Alg() != signKey.Method.Alg() {
 		err = fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 	} else if e.issuer != "" && token.Claims["iss"] != e.issuer {
 		err = fmt.Errorf("unexpected Issuer: %v", token.Claims["iss"])
@@ -69,15 +137,59 @@ func (e *Engine) verify(token *jwt.Token) (key interface{}, err error) {
 	return
 }
 
-// Parse разбирает токен, проверяет его валидность и возвращает данные из него.
+// Parse разбирает токен, проверяет его валидность и возвращает данные из него. Если задано
+// хранилище токенов, то так же проверяется, что не был отозван ни сам токен, ни все
+// токены пользователя, выданные до его завершения всех сеансов.
 func (e *Engine) Parse(tokenString string) (data map[string]interface{}, err error) {
 	token, err := jwt.Parse(tokenString, e.verify)
 	if err != nil {
 		return nil, err
 	}
+	if e.store != nil {
+		id, _ := token.Claims["jti"].(string)
+		if id == "" {
+			return nil, errors.New("missing ID")
+		}
+		revoked, err := e.store.Revoked(id)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrRevoked
+		}
+		if subject, _ := token.Claims[SubjectClaim].(string); subject != "" {
+			before, err := e.store.RevokedBefore(subject)
+			if err != nil {
+				return nil, err
+			}
+			// время выдачи указывается в секундах: токены, выданные в ту же секунду,
+			// тоже считаются отозванными
+			iat, _ := token.Claims["iat"].(float64)
+			if !before.IsZero() && int64(iat) <= before.Unix() {
+				return nil, ErrRevoked
+			}
+		}
+	}
 	return token.Claims, nil
 }
 
+// Revoke отзывает токен с указанными данными: до окончания времени его жизни он будет
+// считаться не действительным.
+func (e *Engine) Revoke(data map[string]interface{}) error {
+	if e.store == nil {
+		return ErrNoStore
+	}
+	id, _ := data["jti"].(string)
+	if id == "" {
+		return errors.New("missing ID")
+	}
+	expires := time.Now().Add(e.expire)
+	if exp, ok := data["exp"].(float64); ok {
+		expires = time.Unix(int64(exp), 0)
+	}
+	return e.store.Revoke(id, expires)
+}
+
 // ParseRequest разбирает токен из HTTP-запроса. Токен может быть передан как в заголовке
 // запроса авторизации, с типом авторизации "Bearer", так и в параметре или поле формы
 // с имененен, определеннов в глобальной переменной AccessTokenParamName.
@@ -95,7 +207,11 @@ func (e *Engine) ParseRequest(req *http.Request) (data map[string]interface{}, e
 	return nil, jwt.ErrNoTokenInRequest
 }
 
-// CryptoKey возвращает ключ, используемый для подписи, в виде строки (base64-encoded).
-func (e *Engine) CryptoKey() string {
-	return base64.StdEncoding.EncodeToString(e.cryptoKey)
+// newID возвращает новый случайный идентификатор.
+func newID() (string, error) {
+	data := make([]byte, 24)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
 }
@@ -0,0 +1,351 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// KeyFileExt задает расширения файлов, которые загружаются из каталога с ключами.
+var KeyFileExt = []string{".pem", ".key", SecretFileExt}
+
+// SecretFileExt задает расширение файлов с секретными ключами для HS256.
+const SecretFileExt = ".secret"
+
+// SecretPrefix задает префикс, с которого должен начинаться секретный ключ для HS256,
+// если он передается не в файле с расширением SecretFileExt.
+const SecretPrefix = "secret:"
+
+var (
+	// ErrNoKeys возвращается, если набор ключей пуст.
+	ErrNoKeys = errors.New("no signing keys")
+	// ErrUnknownKey возвращается, если ключ с идентификатором из токена не найден.
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrVerifyOnly возвращается при попытке подписать токен открытым ключом.
+	ErrVerifyOnly = errors.New("key can only be used for verification")
+	// ErrBadKey возвращается, если ключ не в формате PEM и не помечен как секретный.
+	ErrBadKey = errors.New("key is not in PEM format and has no " + SecretPrefix + " prefix")
+)
+
+// Key описывает ключ для подписи и проверки токенов.
+type Key struct {
+	ID     string            // идентификатор ключа (kid)
+	Method jwt.SigningMethod // алгоритм подписи
+	sign   interface{}       // ключ для подписи: nil, если ключ только для проверки
+	verify interface{}       // ключ для проверки подписи
+}
+
+// NewHMACKey возвращает ключ для подписи алгоритмом HS256.
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{
+		ID:     id,
+		Method: jwt.SigningMethodHS256,
+		sign:   secret,
+		verify: secret,
+	}
+}
+
+// NewRSAKey возвращает ключ для подписи алгоритмом RS256.
+func NewRSAKey(id string, key *rsa.PrivateKey) *Key {
+	return &Key{
+		ID:     id,
+		Method: jwt.SigningMethodRS256,
+		sign:   key,
+		verify: &key.PublicKey,
+	}
+}
+
+// NewECKey возвращает ключ для подписи алгоритмом ECDSA. Алгоритм (ES256, ES384 или ES512)
+// выбирается по используемой ключом кривой.
+func NewECKey(id string, key *ecdsa.PrivateKey) (*Key, error) {
+	method, err := ecMethod(key.Curve)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{
+		ID:     id,
+		Method: method,
+		sign:   key,
+		verify: &key.PublicKey,
+	}, nil
+}
+
+// ecMethod возвращает алгоритм подписи для кривой.
+func ecMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, fmt.Errorf("unsupported curve: %v", curve.Params().Name)
+	}
+}
+
+// ParseKey разбирает ключ. Поддерживаются закрытые ключи RSA и ECDSA, а так же открытые
+// ключи в формате PEM: открытые ключи можно использовать только для проверки подписи.
+// Секретный ключ для HS256 должен начинаться с префикса SecretPrefix, а другие данные
+// не в формате PEM считаются ошибкой.
+func ParseKey(id string, data []byte) (*Key, error) {
+	if strings.HasPrefix(string(data), SecretPrefix) {
+		return parseSecret(id, data[len(SecretPrefix):])
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrBadKey
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewRSAKey(id, key), nil
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewECKey(id, key)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return NewRSAKey(id, key), nil
+		case *ecdsa.PrivateKey:
+			return NewECKey(id, key)
+		}
+		return nil, fmt.Errorf("unsupported private key type: %T", key)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			return &Key{ID: id, Method: jwt.SigningMethodRS256, verify: key}, nil
+		case *ecdsa.PublicKey:
+			method, err := ecMethod(key.Curve)
+			if err != nil {
+				return nil, err
+			}
+			return &Key{ID: id, Method: method, verify: key}, nil
+		}
+		return nil, fmt.Errorf("unsupported public key type: %T", key)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block: %v", block.Type)
+	}
+}
+
+// parseSecret возвращает секретный ключ для HS256.
+func parseSecret(id string, secret []byte) (*Key, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("empty key")
+	}
+	return NewHMACKey(id, secret), nil
+}
+
+// LoadKey загружает ключ из файла. В качестве идентификатора ключа используется имя файла
+// без расширения. Содержимое файла с расширением SecretFileExt целиком используется как
+// секретный ключ для HS256, а остальные файлы разбираются ParseKey.
+func LoadKey(filename string) (*Key, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(filename)
+	ext := filepath.Ext(name)
+	id := strings.TrimSuffix(name, ext)
+	if ext == SecretFileExt {
+		return parseSecret(id, data)
+	}
+	return ParseKey(id, data)
+}
+
+// LoadKeys загружает набор ключей из файла или каталога. Из каталога загружаются все файлы
+// с расширениями из KeyFileExt в порядке сортировки их имен: для подписи используется
+// последний из них, а остальные — только для проверки ранее выданных токенов. Поэтому для
+// смены ключа достаточно добавить в каталог новый файл с именем, например, в виде даты.
+func LoadKeys(path string) (*KeySet, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		key, err := LoadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return NewKeySet(key)
+	}
+	var names []string
+	for _, ext := range KeyFileExt {
+		list, err := filepath.Glob(filepath.Join(path, "*"+ext))
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, list...)
+	}
+	sort.Strings(names)
+	keys := make([]*Key, 0, len(names))
+	for _, name := range names {
+		key, err := LoadKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys...)
+}
+
+// KeySet описывает набор ключей. Последний добавленный ключ, пригодный для подписи,
+// используется для подписи новых токенов, а остальные — только для проверки.
+type KeySet struct {
+	keys    []*Key          // список ключей в порядке добавления
+	byID    map[string]*Key // ключи по их идентификаторам
+	current *Key            // ключ для подписи
+	mu      sync.RWMutex
+}
+
+// NewKeySet возвращает новый набор ключей.
+func NewKeySet(keys ...*Key) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	set := &KeySet{byID: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if err := set.Add(key); err != nil {
+			return nil, err
+		}
+	}
+	if set.current == nil {
+		return nil, ErrVerifyOnly
+	}
+	return set, nil
+}
+
+// Add добавляет ключ в набор. Если ключ пригоден для подписи, то он становится текущим:
+// новые токены будут подписываться им, а ранее выданные по-прежнему проверяются старыми
+// ключами.
+func (s *KeySet) Add(key *Key) error {
+	if key.ID == "" {
+		return errors.New("missing key ID")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[key.ID]; ok {
+		return fmt.Errorf("duplicate key ID: %v", key.ID)
+	}
+	s.keys = append(s.keys, key)
+	s.byID[key.ID] = key
+	if key.sign != nil {
+		s.current = key
+	}
+	return nil
+}
+
+// Remove удаляет ключ из набора: токены, подписанные им, перестают приниматься. Текущий
+// ключ для подписи удалить нельзя.
+func (s *KeySet) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil && s.current.ID == id {
+		return errors.New("cannot remove current key")
+	}
+	delete(s.byID, id)
+	for i, key := range s.keys {
+		if key.ID == id {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Current возвращает ключ, используемый для подписи.
+func (s *KeySet) Current() *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Get возвращает ключ по его идентификатору.
+func (s *KeySet) Get(id string) *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.byID[id]
+}
+
+// JWK описывает открытый ключ в формате JSON Web Key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS описывает набор открытых ключей в формате JSON Web Key Set.
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// JWKS возвращает открытые ключи набора для проверки токенов другими сервисами. Секретные
+// ключи HS256 в него не включаются.
+func (s *KeySet) JWKS() *JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := &JWKS{Keys: make([]*JWK, 0, len(s.keys))}
+	for _, key := range s.keys {
+		jwk := &JWK{Use: "sig", Alg: key.Method.Alg(), Kid: key.ID}
+		switch pub := key.verify.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encodeBigInt(pub.N, 0)
+			jwk.E = encodeBigInt(big.NewInt(int64(pub.E)), 0)
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = encodeBigInt(pub.X, size)
+			jwk.Y = encodeBigInt(pub.Y, size)
+		default:
+			continue
+		}
+		result.Keys = append(result.Keys, jwk)
+	}
+	return result
+}
+
+// encodeBigInt возвращает число в кодировке base64url, дополненное нулями до указанного
+// размера в байтах.
+func encodeBigInt(n *big.Int, size int) string {
+	data := n.Bytes()
+	if len(data) < size {
+		data = append(make([]byte, size-len(data)), data...)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
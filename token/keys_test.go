@@ -0,0 +1,123 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecData, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]*pem.Block{
+		"2015-12-01.pem": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		"2015-12-15.pem": {Type: "EC PRIVATE KEY", Bytes: ecData},
+	}
+	for name, block := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// содержимое файла с расширением .secret используется как секретный ключ HS256
+	secretFile := filepath.Join(dir, "2015-11-01"+SecretFileExt)
+	if err := ioutil.WriteFile(secretFile, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := LoadKey(secretFile); err != nil || key.ID != "2015-11-01" || key.Method.Alg() != "HS256" {
+		t.Errorf("bad secret key file: %v", err)
+	}
+	keys, err := LoadKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// для подписи используется последний по имени ключ
+	if key := keys.Current(); key.ID != "2015-12-15" || key.Method.Alg() != "ES256" {
+		t.Fatalf("bad current key: %v %v", key.ID, key.Method.Alg())
+	}
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kty != "RSA" || jwks.Keys[1].Crv != "P-256" {
+		t.Errorf("bad JWKS: %v", jwks.Keys)
+	}
+	// токен, подписанный старым ключом, проверяется и после смены ключа
+	old, err := NewKeySet(NewRSAKey("old", rsaKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := InitKeys("test", time.Minute, old)
+	oldToken, err := engine.Token(map[string]interface{}{"id": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := NewECKey("new", ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Add(newKey); err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := engine.Token(map[string]interface{}{"id": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if data, err := engine.Parse(token); err != nil || data["id"] != "user" {
+			t.Errorf("token not verified: %v", err)
+		}
+	}
+	// после удаления старого ключа подписанные им токены не принимаются
+	if err := old.Remove("old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Parse(oldToken); err == nil {
+		t.Error("token with removed key accepted")
+	}
+	// открытый ключ пригоден только для проверки подписи
+	pubData, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParseKey("pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubData}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewKeySet(pub); err != ErrVerifyOnly {
+		t.Errorf("verify only key set created: %v", err)
+	}
+	// секретный ключ HS256 задается только явно, остальные данные не в формате PEM — ошибка
+	if _, err := ParseKey("hmac", []byte("secret")); err != ErrBadKey {
+		t.Errorf("non-PEM key accepted: %v", err)
+	}
+	if _, err := ParseKey("hmac", []byte(SecretPrefix)); err == nil {
+		t.Error("empty secret accepted")
+	}
+	hmacKey, err := ParseKey("hmac", []byte(SecretPrefix+"secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hmacKey.Method.Alg() != "HS256" {
+		t.Errorf("bad HMAC key method: %v", hmacKey.Method.Alg())
+	}
+}
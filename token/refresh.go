@@ -0,0 +1,156 @@
+package token
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrRefreshNotFound возвращается, если refresh-токен не найден или устарел.
+	ErrRefreshNotFound = errors.New("refresh token not found")
+	// ErrRefreshReused возвращается при повторном использовании refresh-токена. В этом
+	// случае сеанс завершается, а все выданные пользователю токены доступа отзываются.
+	ErrRefreshReused = errors.New("refresh token reused")
+)
+
+// Refresh описывает сохраненный refresh-токен. Сам токен не сохраняется: хранится только
+// его хеш.
+type Refresh struct {
+	Hash    string                 `bson:"_id"` // хеш токена
+	Family  string                 // идентификатор сеанса: общий для всех токенов после ротации
+	Subject string                 // идентификатор пользователя
+	Data    map[string]interface{} // данные для нового токена доступа
+	Used    bool                   // токен уже был использован
+	Expires time.Time              // время окончания действия
+}
+
+// Store описывает хранилище refresh-токенов и списка отозванных токенов доступа.
+type Store interface {
+	// Revoke добавляет идентификатор токена в список отозванных. Информация об отзыве
+	// может быть удалена после окончания времени жизни токена.
+	Revoke(id string, expires time.Time) error
+	// Revoked возвращает true, если токен с таким идентификатором отозван.
+	Revoked(id string) (bool, error)
+	// AddRefresh сохраняет новый refresh-токен.
+	AddRefresh(refresh *Refresh) error
+	// UseRefresh отмечает refresh-токен с указанным хешем как использованный и возвращает
+	// информацию о нем. Если токен уже был использован, то возвращается ErrRefreshReused
+	// вместе с информацией о нем, а если не найден — ErrRefreshNotFound.
+	UseRefresh(hash string) (*Refresh, error)
+	// RemoveFamily удаляет все refresh-токены сеанса.
+	RemoveFamily(family string) error
+	// RemoveSubject удаляет все refresh-токены пользователя.
+	RemoveSubject(subject string) error
+	// RevokeSubject отзывает все токены доступа пользователя, выданные до указанного
+	// времени. Информация об отзыве может быть удалена после expires.
+	RevokeSubject(subject string, before, expires time.Time) error
+	// RevokedBefore возвращает время, до которого все выданные пользователю токены
+	// доступа отозваны. Если токены не отзывались, то возвращается нулевое время.
+	RevokedBefore(subject string) (time.Time, error)
+}
+
+// hashRefresh возвращает хеш refresh-токена.
+func hashRefresh(refresh string) string {
+	sum := sha256.Sum256([]byte(refresh))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefresh создает и сохраняет новый refresh-токен сеанса.
+func (e *Engine) newRefresh(family, subject string, items map[string]interface{}) (string, error) {
+	refresh, err := newID()
+	if err != nil {
+		return "", err
+	}
+	err = e.store.AddRefresh(&Refresh{
+		Hash:    hashRefresh(refresh),
+		Family:  family,
+		Subject: subject,
+		Data:    items,
+		Expires: time.Now().Add(RefreshExpire),
+	})
+	if err != nil {
+		return "", err
+	}
+	return refresh, nil
+}
+
+// Refresh начинает новый сеанс пользователя и возвращает для него refresh-токен. Данные
+// используются для формирования новых токенов доступа при обновлении.
+func (e *Engine) Refresh(subject string, items map[string]interface{}) (string, error) {
+	if e.store == nil {
+		return "", ErrNoStore
+	}
+	family, err := newID()
+	if err != nil {
+		return "", err
+	}
+	return e.newRefresh(family, subject, items)
+}
+
+// Rotate обменивает refresh-токен на новый токен доступа и новый refresh-токен того же
+// сеанса. Каждый refresh-токен может быть использован только один раз: при повторном
+// использовании сеанс завершается, его refresh-токены удаляются, а все выданные
+// пользователю токены доступа отзываются, поскольку неизвестно, какие из них получены
+// с украденным токеном. Так же возвращаются данные, использованные для формирования
+// токена доступа.
+func (e *Engine) Rotate(refresh string) (access, next string, data map[string]interface{}, err error) {
+	if e.store == nil {
+		return "", "", nil, ErrNoStore
+	}
+	info, err := e.store.UseRefresh(hashRefresh(refresh))
+	if err == ErrRefreshReused {
+		if err := e.store.RemoveFamily(info.Family); err != nil {
+			return "", "", nil, err
+		}
+		if err := e.revokeSubject(info.Subject); err != nil {
+			return "", "", nil, err
+		}
+		return "", "", nil, ErrRefreshReused
+	}
+	if err != nil {
+		return "", "", nil, err
+	}
+	if time.Now().After(info.Expires) {
+		return "", "", nil, ErrRefreshNotFound
+	}
+	if access, err = e.Token(info.Data); err != nil {
+		return "", "", nil, err
+	}
+	if next, err = e.newRefresh(info.Family, info.Subject, info.Data); err != nil {
+		return "", "", nil, err
+	}
+	return access, next, info.Data, nil
+}
+
+// Logout завершает сеанс, к которому относится refresh-токен.
+func (e *Engine) Logout(refresh string) error {
+	if e.store == nil {
+		return ErrNoStore
+	}
+	info, err := e.store.UseRefresh(hashRefresh(refresh))
+	if err != nil && err != ErrRefreshReused {
+		return err
+	}
+	return e.store.RemoveFamily(info.Family)
+}
+
+// LogoutAll завершает все сеансы пользователя: удаляет его refresh-токены и отзывает все
+// выданные ему токены доступа.
+func (e *Engine) LogoutAll(subject string) error {
+	if e.store == nil {
+		return ErrNoStore
+	}
+	if err := e.store.RemoveSubject(subject); err != nil {
+		return err
+	}
+	return e.revokeSubject(subject)
+}
+
+// revokeSubject отзывает все токены доступа пользователя, выданные до текущего момента.
+// Информация об отзыве хранится, пока эти токены не устареют.
+func (e *Engine) revokeSubject(subject string) error {
+	now := time.Now()
+	return e.store.RevokeSubject(subject, now, now.Add(e.expire))
+}
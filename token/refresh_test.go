@@ -0,0 +1,159 @@
+package token
+
+import (
+	"testing"
+	"time"
+)
+
+// memoryStore описывает хранилище токенов в памяти для тестов.
+type memoryStore struct {
+	revoked  map[string]time.Time
+	refresh  map[string]*Refresh
+	subjects map[string]time.Time
+}
+
+func (s *memoryStore) Revoke(id string, expires time.Time) error {
+	s.revoked[id] = expires
+	return nil
+}
+
+func (s *memoryStore) Revoked(id string) (bool, error) {
+	_, ok := s.revoked[id]
+	return ok, nil
+}
+
+func (s *memoryStore) AddRefresh(refresh *Refresh) error {
+	s.refresh[refresh.Hash] = refresh
+	return nil
+}
+
+func (s *memoryStore) UseRefresh(hash string) (*Refresh, error) {
+	refresh, ok := s.refresh[hash]
+	if !ok {
+		return nil, ErrRefreshNotFound
+	}
+	if refresh.Used {
+		return refresh, ErrRefreshReused
+	}
+	refresh.Used = true
+	return refresh, nil
+}
+
+func (s *memoryStore) RemoveFamily(family string) error {
+	for hash, refresh := range s.refresh {
+		if refresh.Family == family {
+			delete(s.refresh, hash)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) RemoveSubject(subject string) error {
+	for hash, refresh := range s.refresh {
+		if refresh.Subject == subject {
+			delete(s.refresh, hash)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) RevokeSubject(subject string, before, expires time.Time) error {
+	if s.subjects == nil {
+		s.subjects = make(map[string]time.Time)
+	}
+	s.subjects[subject] = before
+	return nil
+}
+
+func (s *memoryStore) RevokedBefore(subject string) (time.Time, error) {
+	return s.subjects[subject], nil
+}
+
+func TestRefresh(t *testing.T) {
+	engine, err := Init("test", time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SetStore(&memoryStore{
+		revoked: make(map[string]time.Time),
+		refresh: make(map[string]*Refresh),
+	})
+	items := map[string]interface{}{"id": "user", "group": "group"}
+	refresh, err := engine.Refresh("user", items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, next, data, err := engine.Rotate(refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["id"] != "user" || next == refresh {
+		t.Errorf("bad rotation: %v, %q", data, next)
+	}
+	claims, err := engine.Parse(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["group"] != "group" || claims["jti"] == "" {
+		t.Errorf("bad claims: %v", claims)
+	}
+	// отозванный токен доступа больше не принимается
+	if err := engine.Revoke(claims); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Parse(access); err != ErrRevoked {
+		t.Errorf("revoked token accepted: %v", err)
+	}
+	// повторное использование refresh-токена завершает сеанс
+	if _, _, _, err := engine.Rotate(refresh); err != ErrRefreshReused {
+		t.Errorf("reused refresh token accepted: %v", err)
+	}
+	if _, _, _, err := engine.Rotate(next); err != ErrRefreshNotFound {
+		t.Errorf("refresh token of closed session accepted: %v", err)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	engine, err := Init("test", time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SetStore(&memoryStore{
+		revoked: make(map[string]time.Time),
+		refresh: make(map[string]*Refresh),
+	})
+	items := map[string]interface{}{"id": "user", "group": "group"}
+	access, err := engine.Token(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := engine.Token(map[string]interface{}{"id": "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := engine.Refresh("user", items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// после завершения всех сеансов выданные пользователю токены доступа не принимаются
+	if err := engine.LogoutAll("user"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Parse(access); err != ErrRevoked {
+		t.Errorf("access token accepted after logout: %v", err)
+	}
+	if _, err := engine.Parse(other); err != nil {
+		t.Errorf("token of other user rejected: %v", err)
+	}
+	if _, _, _, err := engine.Rotate(refresh); err != ErrRefreshNotFound {
+		t.Errorf("refresh token accepted after logout: %v", err)
+	}
+	// токены, выданные после завершения сеансов, действуют
+	time.Sleep(time.Second)
+	if access, err = engine.Token(items); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Parse(access); err != nil {
+		t.Errorf("new access token rejected: %v", err)
+	}
+}
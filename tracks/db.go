@@ -131,6 +131,22 @@ func (db *DB) GetDay(groupID, deviceID string) (tracks []Track, err error) {
 	return
 }
 
+// GetRange возвращает список треков для указанного устройства за заданный интервал времени.
+// В отличие от других методов, треки в ответе отсортированы в хронологическом порядке.
+func (db *DB) GetRange(groupID, deviceID string, from, to time.Time) (tracks []Track, err error) {
+	coll := db.GetCollection(CollectionName)
+	var search = bson.M{
+		"groupid":  groupID,
+		"deviceid": deviceID,
+		"time":     bson.M{"$gte": from, "$lt": to},
+	}
+	query := coll.Find(search).Select(selector).Sort("time")
+	tracks = make([]Track, 0)
+	err = query.All(&tracks)
+	db.FreeCollection(coll)
+	return
+}
+
 // GetLast возвращает самый последний трек для данного устройства, сохраненный
 // в хранилище.
 func (db *DB) GetLast(groupID, deviceID string) (track Track, err error) {
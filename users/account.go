@@ -0,0 +1,298 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	InvitesCollectionName = "users.invites" // коллекция с приглашениями в группы
+	ResetCollectionName   = "users.reset"   // коллекция с токенами восстановления пароля
+
+	InviteExpired     = time.Hour * 24 * 7 // время жизни приглашения
+	ResetExpired      = time.Hour          // время жизни токена восстановления пароля
+	MinPasswordLength = 6                  // минимальная длина пароля
+	PasswordCost      = bcrypt.DefaultCost // сложность хеширования паролей
+)
+
+var (
+	// ErrLoginExists возвращается при регистрации пользователя с уже занятым логином.
+	ErrLoginExists = errors.New("login already exists")
+	// ErrWeakPassword возвращается, если пароль короче минимально допустимой длины.
+	ErrWeakPassword = errors.New("password is too short")
+	// ErrBadToken возвращается, если приглашение или токен восстановления пароля
+	// не найдены или их время жизни истекло.
+	ErrBadToken = errors.New("invalid or expired token")
+)
+
+// initAccounts инициализирует коллекции приглашений и токенов восстановления пароля.
+// Устаревшие записи удаляются MongoDB автоматически.
+func (db *DB) initAccounts() (err error) {
+	for name, expire := range map[string]time.Duration{
+		InvitesCollectionName: InviteExpired,
+		ResetCollectionName:   ResetExpired,
+	} {
+		coll := db.GetCollection(name)
+		err = coll.EnsureIndex(mgo.Index{
+			Key:         []string{"created"},
+			ExpireAfter: expire,
+		})
+		db.FreeCollection(coll)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// HashPassword возвращает хеш пароля для сохранения в хранилище. Если пароль слишком
+// короткий, то возвращается ошибка ErrWeakPassword.
+func HashPassword(password string) ([]byte, error) {
+	if len(password) < MinPasswordLength {
+		return nil, ErrWeakPassword
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+}
+
+// NeedRehash возвращает true, если хеш пароля был создан с меньшей сложностью, чем
+// задано в PasswordCost, и его следует пересчитать.
+func NeedRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost < PasswordCost
+}
+
+// NewGroupID возвращает новый случайный идентификатор группы в формате UUID.
+func NewGroupID() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		panic(err)
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40 // версия 4
+	uuid[8] = (uuid[8] & 0x3f) | 0x80 // вариант RFC 4122
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// newToken возвращает новый случайный токен и его хеш для хранения.
+func newToken() (token, hash string) {
+	data := make([]byte, 24)
+	if _, err := rand.Read(data); err != nil {
+		panic(err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(data)
+	return token, hashToken(token)
+}
+
+// hashToken возвращает хеш токена. В хранилище сохраняются только хеши токенов.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetByID возвращает информацию о пользователе по его уникальному идентификатору.
+func (db *DB) GetByID(userID bson.ObjectId) (user *User, err error) {
+	coll := db.GetCollection(CollectionName)
+	user = new(User)
+	err = coll.FindId(userID).One(user)
+	db.FreeCollection(coll)
+	return
+}
+
+// FindByEmail возвращает информацию о пользователе по логину или адресу электронной почты.
+// Сначала пользователь ищется по логину, а если такого логина нет — по подтвержденному адресу
+// почты. Адрес почты не уникален, поэтому по нему пользователь возвращается, только если
+// адрес подтвержден ровно у одного пользователя.
+func (db *DB) FindByEmail(login string) (user *User, err error) {
+	coll := db.GetCollection(CollectionName)
+	user = new(User)
+	err = coll.Find(bson.M{"login": login}).One(user)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		return db.FindByVerifiedEmail(login)
+	}
+	return
+}
+
+// Create добавляет нового пользователя в хранилище. Если пользователь с таким логином уже
+// зарегистрирован, то возвращается ошибка ErrLoginExists.
+func (db *DB) Create(user *User) (err error) {
+	coll := db.GetCollection(CollectionName)
+	user.ID = bson.NewObjectId()
+	err = coll.Insert(user)
+	db.FreeCollection(coll)
+	if mgo.IsDup(err) {
+		err = ErrLoginExists
+	}
+	return
+}
+
+// SetPassword сохраняет новый пароль пользователя.
+func (db *DB) SetPassword(userID bson.ObjectId, password string) (err error) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return
+	}
+	coll := db.GetCollection(CollectionName)
+	err = coll.UpdateId(userID, bson.M{"$set": bson.M{"password": hash}})
+	db.FreeCollection(coll)
+	return
+}
+
+// Invite описывает приглашение в группу.
+type Invite struct {
+	Code      string        `bson:"_id"` // код приглашения
+	GroupID   string        `json:"-"`   // идентификатор группы
+	Role      string        // роль приглашенного пользователя
+	CreatedBy bson.ObjectId `json:"-"`                   // пользователь, создавший приглашение
+	Created   time.Time     `json:"-"`                   // время создания
+	Expires   time.Time     `bson:"-" json:",omitempty"` // время окончания действия
+}
+
+// CreateInvite создает новое приглашение в группу. Зарегистрированный по приглашению
+// пользователь получает указанную в нем роль.
+func (db *DB) CreateInvite(groupID string, userID bson.ObjectId, role string) (invite *Invite, err error) {
+	if !ValidRole(role) || role == RoleOwner {
+		return nil, ErrBadRole
+	}
+	code, _ := newToken()
+	invite = &Invite{
+		Code:      code,
+		GroupID:   groupID,
+		Role:      role,
+		CreatedBy: userID,
+		Created:   time.Now(),
+	}
+	invite.Expires = invite.Created.Add(InviteExpired)
+	coll := db.GetCollection(InvitesCollectionName)
+	err = coll.Insert(invite)
+	db.FreeCollection(coll)
+	return
+}
+
+// GetInvite возвращает действующее приглашение в группу.
+func (db *DB) GetInvite(code string) (invite *Invite, err error) {
+	coll := db.GetCollection(InvitesCollectionName)
+	invite = new(Invite)
+	err = coll.Find(bson.M{
+		"_id":     code,
+		"created": bson.M{"$gt": time.Now().Add(-InviteExpired)},
+	}).One(invite)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrBadToken
+	}
+	return
+}
+
+// TakeInvite возвращает действующее приглашение в группу и удаляет его. Приглашение может
+// быть получено только один раз.
+func (db *DB) TakeInvite(code string) (invite *Invite, err error) {
+	coll := db.GetCollection(InvitesCollectionName)
+	invite = new(Invite)
+	_, err = coll.Find(bson.M{
+		"_id":     code,
+		"created": bson.M{"$gt": time.Now().Add(-InviteExpired)},
+	}).Apply(mgo.Change{Remove: true}, invite)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrBadToken
+	}
+	return
+}
+
+// Register регистрирует нового пользователя. Если указан код приглашения, то пользователь
+// добавляется с указанной в приглашении ролью в группу, в которую был приглашен, а
+// приглашение удаляется до создания пользователя, поэтому одно приглашение нельзя
+// использовать дважды. Если пользователя создать не удалось, то приглашение
+// восстанавливается. В противном случае для пользователя создается новая группа,
+// владельцем которой он становится. Логины тестовых пользователей зарегистрировать нельзя.
+func (db *DB) Register(user *User, password, invite string) (err error) {
+	// логины тестовых пользователей зарезервированы
+	if isSampleLogin(user.Login) {
+		return ErrLoginExists
+	}
+	if user.Password, err = HashPassword(password); err != nil {
+		return
+	}
+	var info *Invite
+	if invite != "" {
+		if info, err = db.TakeInvite(invite); err != nil {
+			return
+		}
+		user.GroupID = info.GroupID
+		user.Role = info.Role
+		if user.Role == "" {
+			user.Role = RoleMember
+		}
+	} else {
+		user.GroupID = NewGroupID()
+		user.Role = RoleOwner
+	}
+	if err = db.Create(user); err != nil && info != nil {
+		coll := db.GetCollection(InvitesCollectionName)
+		coll.Insert(info) // приглашение может быть использовано повторно
+		db.FreeCollection(coll)
+	}
+	return
+}
+
+// resetToken описывает сохраненный токен восстановления пароля.
+type resetToken struct {
+	Hash    string        `bson:"_id"` // хеш токена
+	UserID  bson.ObjectId // идентификатор пользователя
+	Created time.Time     // время создания
+}
+
+// CreateResetToken создает новый токен для восстановления пароля пользователя. В хранилище
+// сохраняется только хеш токена, а сам токен возвращается для отправки пользователю.
+func (db *DB) CreateResetToken(userID bson.ObjectId) (token string, err error) {
+	token, hash := newToken()
+	coll := db.GetCollection(ResetCollectionName)
+	defer db.FreeCollection(coll)
+	// ранее выданные токены этого пользователя становятся не действительными
+	if _, err = coll.RemoveAll(bson.M{"userid": userID}); err != nil {
+		return "", err
+	}
+	err = coll.Insert(&resetToken{
+		Hash:    hash,
+		UserID:  userID,
+		Created: time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ResetPassword устанавливает новый пароль пользователя по токену восстановления и
+// возвращает идентификатор пользователя. Токен может быть использован только один раз.
+func (db *DB) ResetPassword(token, password string) (userID bson.ObjectId, err error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrWeakPassword
+	}
+	coll := db.GetCollection(ResetCollectionName)
+	var reset resetToken
+	_, err = coll.Find(bson.M{
+		"_id":     hashToken(token),
+		"created": bson.M{"$gt": time.Now().Add(-ResetExpired)},
+	}).Apply(mgo.Change{Remove: true}, &reset)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		return "", ErrBadToken
+	}
+	if err != nil {
+		return
+	}
+	if err = db.SetPassword(reset.UserID, password); err != nil {
+		return "", err
+	}
+	return reset.UserID, nil
+}
@@ -0,0 +1,98 @@
+package users
+
+import (
+	"log"
+	"regexp"
+	"testing"
+
+	"github.com/mdigger/geotrack/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPassword(t *testing.T) {
+	if _, err := HashPassword("short"); err != ErrWeakPassword {
+		t.Error("short password accepted")
+	}
+	hash, err := HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte("password")); err != nil {
+		t.Error(err)
+	}
+	if NeedRehash(hash) {
+		t.Error("rehash of actual hash")
+	}
+	old, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !NeedRehash(old) {
+		t.Error("no rehash of weak hash")
+	}
+}
+
+func TestTokens(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if groupID := NewGroupID(); !uuid.MatchString(groupID) {
+		t.Errorf("bad group id: %q", groupID)
+	}
+	token, hash := newToken()
+	token2, _ := newToken()
+	if token == token2 || hash != hashToken(token) || hash == token {
+		t.Error("bad token")
+	}
+}
+
+func TestSampleLogin(t *testing.T) {
+	if !isSampleLogin("login1") || !isSampleLogin("Login5") {
+		t.Error("sample login not reserved")
+	}
+	if isSampleLogin("login6") || isSampleLogin("user") {
+		t.Error("regular login reserved")
+	}
+	if err := (&DB{}).Register(&User{Login: "login1"}, "password1", ""); err != ErrLoginExists {
+		t.Errorf("sample login registered: %v", err)
+	}
+}
+
+func TestInvite(t *testing.T) {
+	mdb, err := mongo.Connect("mongodb://localhost/watch")
+	if err != nil {
+		log.Println("Error connecting to MongoDB:", err)
+		return
+	}
+	defer mdb.Close()
+
+	db, err := InitDB(mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := &User{Login: "test-" + NewGroupID()}
+	if err := db.Register(owner, "password1", ""); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Remove(owner.GroupID, owner.ID)
+	invite, err := db.CreateInvite(owner.GroupID, owner.ID, RoleViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// при неудачной регистрации приглашение сохраняется
+	if err := db.Register(&User{Login: owner.Login}, "password1", invite.Code); err != ErrLoginExists {
+		t.Fatalf("unexpected register result: %v", err)
+	}
+	user := &User{Login: "test-" + NewGroupID()}
+	if err := db.Register(user, "password1", invite.Code); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Remove(user.GroupID, user.ID)
+	if user.GroupID != owner.GroupID || user.Role != RoleViewer {
+		t.Errorf("bad invited user: %+v", user)
+	}
+	// приглашение используется только один раз
+	other := &User{Login: "test-" + NewGroupID()}
+	if err := db.Register(other, "password1", invite.Code); err != ErrBadToken {
+		db.Remove(other.GroupID, other.ID)
+		t.Errorf("invite reused: %v", err)
+	}
+}
@@ -32,18 +32,43 @@ func InitDB(mdb *mongo.DB) (db *DB, err error) {
 	if err != nil {
 		return
 	}
+	err = coll.EnsureIndex(mgo.Index{
+		Key:    []string{"email"},
+		Sparse: true,
+	})
+	if err != nil {
+		return
+	}
 	mdb.FreeCollection(coll)
+	if err = db.initAccounts(); err != nil {
+		return
+	}
+	if err = db.initLogins(); err != nil {
+		return
+	}
+	if err = db.initIdentities(); err != nil {
+		return
+	}
+	err = db.initVerify()
 	return
 }
 
 // User описывает информацию о пользователе системы.
 type User struct {
-	ID       bson.ObjectId `bson:"_id"` // уникальный идентификатор пользователя
-	Login    string        // логин пользователя
-	GroupID  string        `json:",omitempty"`                   // уникальный идентификатор группы (UUID)
-	Name     string        `bson:",omitempty" json:",omitempty"` // отображаемое имя
-	Icon     byte          // идентификатор иконки пользователя
-	Password []byte        `json:"-"` // хеш пароля пользователя
+	ID            bson.ObjectId `bson:"_id"` // уникальный идентификатор пользователя
+	Login         string        // логин пользователя
+	GroupID       string        `json:",omitempty"`                   // уникальный идентификатор группы (UUID)
+	Name          string        `bson:",omitempty" json:",omitempty"` // отображаемое имя
+	Email         string        `bson:",omitempty" json:",omitempty"` // адрес электронной почты
+	EmailVerified bool          `bson:",omitempty" json:",omitempty"` // адрес почты подтвержден
+	Role          string        `bson:",omitempty" json:",omitempty"` // роль пользователя в группе
+	Icon          byte          // идентификатор иконки пользователя
+	Avatar        bson.ObjectId `bson:",omitempty" json:",omitempty"` // идентификатор изображения аватара
+	Locale        string        `bson:",omitempty" json:",omitempty"` // язык интерфейса
+	Timezone      string        `bson:",omitempty" json:",omitempty"` // часовой пояс
+	Units         string        `bson:",omitempty" json:",omitempty"` // система единиц измерения
+	Identities    []Identity    `bson:",omitempty" json:",omitempty"` // внешние учетные записи пользователя
+	Password      []byte        `json:"-"`                            // хеш пароля пользователя
 }
 
 // Get возвращает информацию о пользователе с указанным идентификатором.
@@ -83,30 +108,47 @@ func (db *DB) Save(user *User) (err error) {
 	return
 }
 
+// GroupInfo описывает пользователей группы.
 type GroupInfo struct {
-	GroupID string   // идентификатор группы
-	Users   []string // список идентификаторов пользователей с номером иконки
+	GroupID string    // идентификатор группы
+	Users   []string  // список идентификаторов пользователей с номером иконки
+	Members []*Member // профили пользователей группы
+}
+
+// Member описывает профиль пользователя группы, который отдается устройствам.
+type Member struct {
+	ID       bson.ObjectId `bson:"_id"`                          // уникальный идентификатор пользователя
+	Name     string        `bson:",omitempty" json:",omitempty"` // отображаемое имя
+	Icon     byte          // идентификатор иконки пользователя
+	Avatar   bson.ObjectId `bson:",omitempty" json:",omitempty"` // идентификатор изображения аватара
+	Locale   string        `bson:",omitempty" json:",omitempty"` // язык интерфейса
+	Timezone string        `bson:",omitempty" json:",omitempty"` // часовой пояс
+	Units    string        `bson:",omitempty" json:",omitempty"` // система единиц измерения
 }
 
 // GetGroup возвращает список идентификаторов всех пользователей, входящих в указанную группу.
-// Плюс, к идентификатору пользователя автоматически добавляется номер иконки.
+// Плюс, к идентификатору пользователя автоматически добавляется номер иконки. Профили
+// пользователей каждый раз читаются из хранилища, поэтому отражают последние изменения.
 func (db *DB) GetGroup(groupID string) (info *GroupInfo, err error) {
 	coll := db.GetCollection(CollectionName)
-	users := make([]*User, 0)
-	err = coll.Find(bson.M{"groupid": groupID}).Select(bson.M{"icon": 1}).All(&users)
+	members := make([]*Member, 0)
+	err = coll.Find(bson.M{"groupid": groupID}).Select(bson.M{
+		"name": 1, "icon": 1, "avatar": 1, "locale": 1, "timezone": 1, "units": 1,
+	}).All(&members)
 	db.FreeCollection(coll)
 	if err != nil {
 		return
 	}
-	if len(users) == 0 {
+	if len(members) == 0 {
 		return
 	}
 	info = &GroupInfo{
 		GroupID: groupID,
-		Users:   make([]string, len(users)),
+		Users:   make([]string, len(members)),
+		Members: members,
 	}
-	for i, user := range users {
-		info.Users[i] = fmt.Sprintf("%s-%d", user.ID.Hex(), user.Icon)
+	for i, member := range members {
+		info.Users[i] = fmt.Sprintf("%s-%d", member.ID.Hex(), member.Icon)
 	}
 	return
 }
@@ -115,7 +157,7 @@ func (db *DB) GetGroup(groupID string) (info *GroupInfo, err error) {
 func (db *DB) GetUsers(groupID string) (users []*User, err error) {
 	coll := db.GetCollection(CollectionName)
 	users = make([]*User, 0)
-	selector := bson.M{"groupid": 0, "password": 0}
+	selector := bson.M{"groupid": 0, "password": 0, "identities": 0}
 	err = coll.Find(bson.M{"groupid": groupID}).Select(selector).All(&users)
 	db.FreeCollection(coll)
 	return
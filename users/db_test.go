@@ -21,7 +21,14 @@ func TestUsers(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	groupID := db.GetSampleGroupID()
+	groupID, err := db.Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := db.HasSampleCredentials()
+	if err != nil || !ok {
+		t.Errorf("sample credentials not found: %v", err)
+	}
 	groupInfo, err := db.GetGroup(groupID)
 	if err != nil {
 		t.Fatal(err)
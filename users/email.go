@@ -0,0 +1,99 @@
+package users
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	VerifyCollectionName = "users.verify"     // коллекция с токенами подтверждения адреса почты
+	VerifyExpired        = time.Hour * 24 * 2 // время жизни токена подтверждения адреса почты
+)
+
+// verifyToken описывает сохраненный токен подтверждения адреса электронной почты.
+type verifyToken struct {
+	Hash    string        `bson:"_id"` // хеш токена
+	UserID  bson.ObjectId // идентификатор пользователя
+	Email   string        // подтверждаемый адрес
+	Created time.Time     // время создания
+}
+
+// initVerify инициализирует коллекцию токенов подтверждения адреса почты. Устаревшие
+// токены удаляются MongoDB автоматически.
+func (db *DB) initVerify() (err error) {
+	coll := db.GetCollection(VerifyCollectionName)
+	err = coll.EnsureIndex(mgo.Index{
+		Key:         []string{"created"},
+		ExpireAfter: VerifyExpired,
+	})
+	db.FreeCollection(coll)
+	return
+}
+
+// CreateVerifyToken создает токен для подтверждения текущего адреса электронной почты
+// пользователя. В хранилище сохраняется только хеш токена, а сам токен возвращается для
+// отправки на этот адрес.
+func (db *DB) CreateVerifyToken(userID bson.ObjectId, email string) (token string, err error) {
+	token, hash := newToken()
+	coll := db.GetCollection(VerifyCollectionName)
+	defer db.FreeCollection(coll)
+	if _, err = coll.RemoveAll(bson.M{"userid": userID}); err != nil {
+		return "", err
+	}
+	err = coll.Insert(&verifyToken{
+		Hash:    hash,
+		UserID:  userID,
+		Email:   email,
+		Created: time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// VerifyEmail отмечает адрес электронной почты пользователя как подтвержденный по токену.
+// Токен может быть использован только один раз и только если адрес пользователя с момента
+// его создания не изменился.
+func (db *DB) VerifyEmail(token string) (err error) {
+	coll := db.GetCollection(VerifyCollectionName)
+	var verify verifyToken
+	_, err = coll.Find(bson.M{
+		"_id":     hashToken(token),
+		"created": bson.M{"$gt": time.Now().Add(-VerifyExpired)},
+	}).Apply(mgo.Change{Remove: true}, &verify)
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		return ErrBadToken
+	}
+	if err != nil {
+		return
+	}
+	coll = db.GetCollection(CollectionName)
+	err = coll.Update(bson.M{"_id": verify.UserID, "email": verify.Email},
+		bson.M{"$set": bson.M{"emailverified": true}})
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrBadToken
+	}
+	return
+}
+
+// FindByVerifiedEmail возвращает пользователя с подтвержденным адресом электронной почты.
+// Если подтвержденный адрес не найден или он указан у нескольких пользователей, то
+// возвращается ошибка mgo.ErrNotFound.
+func (db *DB) FindByVerifiedEmail(email string) (user *User, err error) {
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	var list []*User
+	err = coll.Find(bson.M{"email": email, "emailverified": true}).Limit(2).All(&list)
+	if err != nil {
+		return
+	}
+	if len(list) != 1 {
+		return nil, mgo.ErrNotFound
+	}
+	return list[0], nil
+}
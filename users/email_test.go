@@ -0,0 +1,71 @@
+package users
+
+import (
+	"log"
+	"testing"
+
+	"github.com/mdigger/geotrack/mongo"
+)
+
+func TestEmail(t *testing.T) {
+	mdb, err := mongo.Connect("mongodb://localhost/watch")
+	if err != nil {
+		log.Println("Error connecting to MongoDB:", err)
+		return
+	}
+	defer mdb.Close()
+
+	db, err := InitDB(mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := NewGroupID() + "@example.com"
+	user := &User{Login: "test-" + NewGroupID(), GroupID: NewGroupID(), Email: email}
+	if err := db.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Remove(user.GroupID, user.ID)
+	// адрес, указанный другим пользователем, не подтвержден и не используется
+	other := &User{Login: "test-" + NewGroupID(), GroupID: NewGroupID(), Email: email}
+	if err := db.Create(other); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Remove(other.GroupID, other.ID)
+
+	if _, err := db.FindByVerifiedEmail(email); err == nil {
+		t.Error("unverified email found")
+	}
+	if _, err := db.FindByEmail(email); err == nil {
+		t.Error("user found by unverified email")
+	}
+	if found, err := db.FindByEmail(user.Login); err != nil || found.ID != user.ID {
+		t.Errorf("user not found by login: %v", err)
+	}
+	token, err := db.CreateVerifyToken(user.ID, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.VerifyEmail(token); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.VerifyEmail(token); err != ErrBadToken {
+		t.Error("verify token reused")
+	}
+	found, err := db.FindByVerifiedEmail(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != user.ID {
+		t.Errorf("bad user: %+v", found)
+	}
+	if found, err := db.FindByEmail(email); err != nil || found.ID != user.ID {
+		t.Errorf("user not found by verified email: %v", err)
+	}
+	// после изменения адреса подтверждение сбрасывается
+	if err := db.UpdateProfile(user.GroupID, user.ID, &Profile{Email: &email}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FindByVerifiedEmail(email); err == nil {
+		t.Error("changed email still verified")
+	}
+}
@@ -0,0 +1,105 @@
+package users
+
+import (
+	"errors"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	// ErrIdentityLinked возвращается, если внешняя учетная запись уже привязана к другому
+	// пользователю или у пользователя уже есть учетная запись этого провайдера.
+	ErrIdentityLinked = errors.New("identity already linked")
+	// ErrLastIdentity возвращается при попытке отвязать единственный способ авторизации
+	// пользователя без пароля.
+	ErrLastIdentity = errors.New("cannot unlink last identity")
+)
+
+// Identity описывает внешнюю учетную запись пользователя у провайдера OpenID Connect.
+type Identity struct {
+	Key      string `json:"-"` // уникальный ключ для поиска: провайдер и идентификатор пользователя
+	Provider string // название провайдера
+	Subject  string // идентификатор пользователя у провайдера
+	Email    string `bson:",omitempty" json:",omitempty"` // адрес электронной почты у провайдера
+}
+
+// identityKey возвращает уникальный ключ внешней учетной записи.
+func identityKey(provider, subject string) string {
+	return provider + "|" + subject
+}
+
+// NewIdentity возвращает описание внешней учетной записи пользователя.
+func NewIdentity(provider, subject, email string) Identity {
+	return Identity{
+		Key:      identityKey(provider, subject),
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+	}
+}
+
+// initIdentities создает индекс для поиска пользователей по внешним учетным записям. Одна
+// учетная запись может быть привязана только к одному пользователю.
+func (db *DB) initIdentities() (err error) {
+	coll := db.GetCollection(CollectionName)
+	err = coll.EnsureIndex(mgo.Index{
+		Key:    []string{"identities.key"},
+		Unique: true,
+		Sparse: true,
+	})
+	db.FreeCollection(coll)
+	return
+}
+
+// FindByIdentity возвращает пользователя, к которому привязана внешняя учетная запись.
+func (db *DB) FindByIdentity(provider, subject string) (user *User, err error) {
+	coll := db.GetCollection(CollectionName)
+	user = new(User)
+	err = coll.Find(bson.M{"identities.key": identityKey(provider, subject)}).One(user)
+	db.FreeCollection(coll)
+	return
+}
+
+// LinkIdentity привязывает внешнюю учетную запись к пользователю. К пользователю может быть
+// привязано не больше одной учетной записи каждого провайдера. Если пользователь не найден,
+// то возвращается ошибка mgo.ErrNotFound.
+func (db *DB) LinkIdentity(userID bson.ObjectId, identity *Identity) (err error) {
+	identity.Key = identityKey(identity.Provider, identity.Subject)
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	err = coll.Update(bson.M{
+		"_id":                 userID,
+		"identities.provider": bson.M{"$ne": identity.Provider},
+	}, bson.M{"$push": bson.M{"identities": identity}})
+	switch {
+	case mgo.IsDup(err):
+		return ErrIdentityLinked
+	case err == mgo.ErrNotFound:
+		// проверяем, существует ли пользователь
+		var count int
+		if count, err = coll.FindId(userID).Count(); err == nil && count > 0 {
+			err = ErrIdentityLinked
+		} else if err == nil {
+			err = mgo.ErrNotFound
+		}
+	}
+	return
+}
+
+// UnlinkIdentity отвязывает от пользователя внешнюю учетную запись провайдера. Если у
+// пользователя не задан пароль, то отвязать последнюю учетную запись нельзя.
+func (db *DB) UnlinkIdentity(userID bson.ObjectId, provider string) (err error) {
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	var user User
+	err = coll.Find(bson.M{"_id": userID, "identities.provider": provider}).
+		Select(bson.M{"password": 1, "identities": 1}).One(&user)
+	if err != nil {
+		return
+	}
+	if len(user.Password) == 0 && len(user.Identities) < 2 {
+		return ErrLastIdentity
+	}
+	return coll.UpdateId(userID, bson.M{"$pull": bson.M{"identities": bson.M{"provider": provider}}})
+}
@@ -0,0 +1,61 @@
+package users
+
+import (
+	"log"
+	"testing"
+
+	"github.com/mdigger/geotrack/mongo"
+)
+
+func TestIdentities(t *testing.T) {
+	mdb, err := mongo.Connect("mongodb://localhost/watch")
+	if err != nil {
+		log.Println("Error connecting to MongoDB:", err)
+		return
+	}
+	defer mdb.Close()
+
+	db, err := InitDB(mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := NewGroupID()
+	user := &User{
+		Login:      "test:" + subject,
+		GroupID:    NewGroupID(),
+		Identities: []Identity{NewIdentity("test", subject, "")},
+	}
+	if err := db.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Remove(user.GroupID, user.ID)
+	other := &User{Login: "test-" + NewGroupID(), GroupID: user.GroupID}
+	if err := db.Create(other); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Remove(other.GroupID, other.ID)
+
+	found, err := db.FindByIdentity("test", subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != user.ID {
+		t.Errorf("bad user: %+v", found)
+	}
+	// учетная запись привязывается только к одному пользователю
+	identity := NewIdentity("test", subject, "")
+	if err := db.LinkIdentity(other.ID, &identity); err != ErrIdentityLinked {
+		t.Errorf("identity linked twice: %v", err)
+	}
+	identity = NewIdentity("other", subject, "user@example.com")
+	if err := db.LinkIdentity(user.ID, &identity); err != nil {
+		t.Fatal(err)
+	}
+	// у пользователя без пароля нельзя отвязать последнюю учетную запись
+	if err := db.UnlinkIdentity(user.ID, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UnlinkIdentity(user.ID, "other"); err != ErrLastIdentity {
+		t.Errorf("last identity unlinked: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package users
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	LoginsCollectionName = "users.logins"      // коллекция с журналом попыток авторизации
+	LoginsExpireAfter    = time.Hour * 24 * 90 // время хранения журнала попыток авторизации
+
+	MaxLoginFailures = 5                // количество неудачных попыток с одним логином до блокировки
+	MaxIPFailures    = 20               // количество неудачных попыток с одного адреса до блокировки
+	LoginWindow      = time.Minute * 15 // период учета неудачных попыток
+	LoginLockout     = time.Minute * 15 // время блокировки после превышения количества попыток
+	LoginBackoff     = time.Second      // начальная задержка после неудачной попытки
+)
+
+// Причины неудачных попыток авторизации.
+const (
+	ReasonUnknownLogin = "unknown login" // пользователь не найден
+	ReasonBadPassword  = "bad password"  // неверный пароль
+	ReasonLocked       = "locked"        // авторизация временно заблокирована
+)
+
+// LoginAttempt описывает запись в журнале попыток авторизации.
+type LoginAttempt struct {
+	Login   string    // указанный логин
+	IP      string    `bson:",omitempty"` // адрес, с которого выполнялся запрос
+	Success bool      // авторизация выполнена успешно
+	Reason  string    `bson:",omitempty"` // причина неудачи
+	Time    time.Time // время попытки
+}
+
+// initLogins инициализирует коллекцию журнала попыток авторизации. Устаревшие записи
+// удаляются MongoDB автоматически.
+func (db *DB) initLogins() (err error) {
+	coll := db.GetCollection(LoginsCollectionName)
+	defer db.FreeCollection(coll)
+	err = coll.EnsureIndex(mgo.Index{
+		Key:         []string{"time"},
+		ExpireAfter: LoginsExpireAfter,
+	})
+	if err != nil {
+		return
+	}
+	if err = coll.EnsureIndexKey("login", "time"); err != nil {
+		return
+	}
+	return coll.EnsureIndexKey("ip", "time")
+}
+
+// LogLogin сохраняет попытку авторизации в журнале.
+func (db *DB) LogLogin(attempt *LoginAttempt) (err error) {
+	if attempt.Time.IsZero() {
+		attempt.Time = time.Now()
+	}
+	coll := db.GetCollection(LoginsCollectionName)
+	err = coll.Insert(attempt)
+	db.FreeCollection(coll)
+	return
+}
+
+// countFailures возвращает количество неудачных попыток авторизации, подходящих под условие,
+// и время последней из них. Заблокированные попытки не учитываются.
+func countFailures(coll *mgo.Collection, query bson.M) (count int, last time.Time, err error) {
+	query["success"] = false
+	query["reason"] = bson.M{"$ne": ReasonLocked}
+	q := coll.Find(query)
+	if count, err = q.Count(); err != nil || count == 0 {
+		return
+	}
+	var attempt LoginAttempt
+	if err = q.Sort("-time").One(&attempt); err != nil {
+		return
+	}
+	return count, attempt.Time, nil
+}
+
+// LoginRetryAfter возвращает время, которое необходимо подождать до следующей попытки
+// авторизации с указанным логином и с указанного адреса. Если ждать не нужно, то
+// возвращается 0.
+//
+// Неудачные попытки учитываются за последние LoginWindow. Для логина учитываются только
+// попытки после последней успешной авторизации. После каждой неудачной попытки с логином
+// задержка удваивается, начиная с LoginBackoff, а после MaxLoginFailures неудачных попыток
+// с логином или MaxIPFailures с адреса авторизация блокируется на LoginLockout.
+func (db *DB) LoginRetryAfter(login, ip string) (time.Duration, error) {
+	now := time.Now()
+	since := now.Add(-LoginWindow)
+	coll := db.GetCollection(LoginsCollectionName)
+	defer db.FreeCollection(coll)
+	// неудачные попытки до успешной авторизации не учитываются
+	var success LoginAttempt
+	err := coll.Find(bson.M{
+		"login":   login,
+		"success": true,
+		"time":    bson.M{"$gt": since},
+	}).Sort("-time").One(&success)
+	switch err {
+	case nil:
+		since = success.Time
+	case mgo.ErrNotFound:
+	default:
+		return 0, err
+	}
+	count, last, err := countFailures(coll, bson.M{"login": login, "time": bson.M{"$gt": since}})
+	if err != nil {
+		return 0, err
+	}
+	wait := last.Add(LoginDelay(count, MaxLoginFailures)).Sub(now)
+	if ip != "" {
+		count, last, err = countFailures(coll, bson.M{"ip": ip, "time": bson.M{"$gt": now.Add(-LoginWindow)}})
+		if err != nil {
+			return 0, err
+		}
+		if count >= MaxIPFailures {
+			if ipWait := last.Add(LoginLockout).Sub(now); ipWait > wait {
+				wait = ipWait
+			}
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, nil
+}
+
+// LoginDelay возвращает задержку после указанного количества неудачных попыток
+// авторизации: она удваивается после каждой неудачной попытки, начиная с LoginBackoff,
+// но не превышает LoginLockout. После max неудачных попыток возвращается LoginLockout.
+func LoginDelay(failures, max int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	if failures >= max || failures > 32 {
+		return LoginLockout
+	}
+	delay := LoginBackoff << uint(failures-1)
+	if delay > LoginLockout || delay <= 0 {
+		delay = LoginLockout
+	}
+	return delay
+}
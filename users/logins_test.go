@@ -0,0 +1,67 @@
+package users
+
+import (
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mdigger/geotrack/mongo"
+)
+
+func TestLoginDelay(t *testing.T) {
+	for _, test := range []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{0, 0},
+		{1, LoginBackoff},
+		{2, LoginBackoff * 2},
+		{3, LoginBackoff * 4},
+		{4, LoginBackoff * 8},
+		{5, LoginLockout},
+		{100, LoginLockout},
+	} {
+		if delay := LoginDelay(test.failures, 5); delay != test.delay {
+			t.Errorf("LoginDelay(%d) = %v, expected %v", test.failures, delay, test.delay)
+		}
+	}
+	if delay := LoginDelay(40, 100); delay != LoginLockout {
+		t.Errorf("delay overflow: %v", delay)
+	}
+}
+
+func TestLogins(t *testing.T) {
+	mdb, err := mongo.Connect("mongodb://localhost/watch")
+	if err != nil {
+		log.Println("Error connecting to MongoDB:", err)
+		return
+	}
+	defer mdb.Close()
+
+	db, err := InitDB(mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := "test-" + NewGroupID()
+	ip := "192.0.2.1"
+	for i := 0; i < MaxLoginFailures; i++ {
+		err := db.LogLogin(&LoginAttempt{Login: login, IP: ip, Reason: ReasonBadPassword})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait, err := db.LoginRetryAfter(login, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= LoginLockout-time.Minute {
+		t.Errorf("login not locked: %v", wait)
+	}
+	// после успешной авторизации неудачные попытки с логином сбрасываются
+	if err := db.LogLogin(&LoginAttempt{Login: login, IP: ip, Success: true}); err != nil {
+		t.Fatal(err)
+	}
+	if wait, err = db.LoginRetryAfter(login, ""); err != nil || wait != 0 {
+		t.Errorf("login locked after success: %v (%v)", wait, err)
+	}
+}
@@ -0,0 +1,237 @@
+package users
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	AvatarsPrefix = "users.avatars" // префикс коллекций GridFS с аватарами пользователей
+	MaxAvatarSize = 1 << 20         // максимальный размер изображения аватара
+
+	// AvatarTypes задает допустимые типы изображений аватаров.
+	AvatarTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+)
+
+// Системы единиц измерения.
+const (
+	UnitsMetric   = "metric"   // метрическая
+	UnitsImperial = "imperial" // британская
+)
+
+var (
+	// ErrBadLocale возвращается, если язык указан не в формате BCP 47.
+	ErrBadLocale = errors.New("bad locale")
+	// ErrBadTimezone возвращается, если часовой пояс не найден в базе IANA.
+	ErrBadTimezone = errors.New("bad timezone")
+	// ErrBadUnits возвращается при указании неизвестной системы единиц измерения.
+	ErrBadUnits = errors.New("bad units")
+	// ErrBadAvatar возвращается, если изображение аватара слишком большое, имеет
+	// неподдерживаемый тип или его содержимое не соответствует указанному типу.
+	ErrBadAvatar = errors.New("bad avatar image")
+)
+
+// reLocale описывает формат языкового тега BCP 47: "ru", "en-US", "zh-Hant-TW".
+var reLocale = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// Profile описывает изменения в профиле пользователя. Изменяются только указанные поля,
+// а пустое значение удаляет соответствующее поле из профиля.
+type Profile struct {
+	Name     *string // отображаемое имя
+	Email    *string // адрес электронной почты
+	Icon     *byte   // идентификатор иконки
+	Locale   *string // язык интерфейса в формате BCP 47
+	Timezone *string // часовой пояс в формате IANA
+	Units    *string // система единиц измерения
+}
+
+// Check проверяет корректность значений профиля.
+func (p *Profile) Check() error {
+	if p.Locale != nil && *p.Locale != "" && !reLocale.MatchString(*p.Locale) {
+		return ErrBadLocale
+	}
+	if p.Timezone != nil && *p.Timezone != "" {
+		if *p.Timezone == "Local" {
+			return ErrBadTimezone
+		}
+		if _, err := time.LoadLocation(*p.Timezone); err != nil {
+			return ErrBadTimezone
+		}
+	}
+	if p.Units != nil {
+		switch *p.Units {
+		case "", UnitsMetric, UnitsImperial:
+		default:
+			return ErrBadUnits
+		}
+	}
+	return nil
+}
+
+// update возвращает запрос на изменение профиля в MongoDB.
+func (p *Profile) update() bson.M {
+	set, unset := bson.M{}, bson.M{}
+	for name, value := range map[string]*string{
+		"name":     p.Name,
+		"email":    p.Email,
+		"locale":   p.Locale,
+		"timezone": p.Timezone,
+		"units":    p.Units,
+	} {
+		switch {
+		case value == nil:
+		case *value == "":
+			unset[name] = ""
+		default:
+			set[name] = *value
+		}
+	}
+	if p.Icon != nil {
+		set["icon"] = *p.Icon
+	}
+	if p.Email != nil { // измененный адрес почты требует повторного подтверждения
+		unset["emailverified"] = ""
+	}
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
+// UpdateProfile изменяет профиль пользователя группы. Если пользователь не найден в группе,
+// то возвращается ошибка mgo.ErrNotFound.
+func (db *DB) UpdateProfile(groupID string, userID bson.ObjectId, profile *Profile) (err error) {
+	if err = profile.Check(); err != nil {
+		return
+	}
+	selector := bson.M{"_id": userID, "groupid": groupID}
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	update := profile.update()
+	if len(update) == 0 {
+		// изменений нет, но проверяем, что пользователь существует
+		var count int
+		if count, err = coll.Find(selector).Count(); err == nil && count == 0 {
+			err = mgo.ErrNotFound
+		}
+		return
+	}
+	return coll.Update(selector, update)
+}
+
+// Avatar описывает изображение аватара пользователя.
+type Avatar struct {
+	ID          bson.ObjectId // идентификатор файла
+	ContentType string        // тип изображения
+	Updated     time.Time     // время загрузки
+	Data        []byte        // содержимое изображения
+}
+
+// validAvatarType возвращает true, если тип изображения допустим для аватара.
+func validAvatarType(contentType string) bool {
+	for _, name := range AvatarTypes {
+		if strings.EqualFold(contentType, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetAvatar сохраняет изображение аватара пользователя группы в GridFS и возвращает
+// идентификатор нового файла. Предыдущее изображение удаляется. Тип изображения
+// определяется по его содержимому и должен совпадать с указанным. Если пользователь не
+// найден в группе, то возвращается ошибка mgo.ErrNotFound.
+func (db *DB) SetAvatar(groupID string, userID bson.ObjectId, contentType string, data []byte) (
+	avatarID bson.ObjectId, err error) {
+	if len(data) == 0 || len(data) > MaxAvatarSize || !validAvatarType(contentType) ||
+		!strings.EqualFold(http.DetectContentType(data), contentType) {
+		return "", ErrBadAvatar
+	}
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	var user User
+	err = coll.Find(bson.M{"_id": userID, "groupid": groupID}).Select(bson.M{"avatar": 1}).One(&user)
+	if err != nil {
+		return
+	}
+	gfs := coll.Database.GridFS(AvatarsPrefix)
+	file, err := gfs.Create(userID.Hex())
+	if err != nil {
+		return
+	}
+	avatarID = bson.NewObjectId()
+	file.SetId(avatarID)
+	file.SetContentType(strings.ToLower(contentType))
+	file.SetMeta(bson.M{"userid": userID})
+	if _, err = file.Write(data); err != nil {
+		file.Abort()
+		file.Close()
+		return "", err
+	}
+	if err = file.Close(); err != nil {
+		return "", err
+	}
+	err = coll.UpdateId(userID, bson.M{"$set": bson.M{"avatar": avatarID}})
+	if err != nil {
+		gfs.RemoveId(avatarID)
+		return "", err
+	}
+	if user.Avatar.Valid() {
+		err = gfs.RemoveId(user.Avatar)
+	}
+	return avatarID, err
+}
+
+// GetAvatar возвращает изображение аватара пользователя группы. Если пользователь не найден
+// или у него нет аватара, то возвращается ошибка mgo.ErrNotFound.
+func (db *DB) GetAvatar(groupID string, userID bson.ObjectId) (avatar *Avatar, err error) {
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	var user User
+	err = coll.Find(bson.M{"_id": userID, "groupid": groupID}).Select(bson.M{"avatar": 1}).One(&user)
+	if err != nil {
+		return
+	}
+	if !user.Avatar.Valid() {
+		return nil, mgo.ErrNotFound
+	}
+	file, err := coll.Database.GridFS(AvatarsPrefix).OpenId(user.Avatar)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	avatar = &Avatar{
+		ID:          user.Avatar,
+		ContentType: file.ContentType(),
+		Updated:     file.UploadDate(),
+	}
+	if avatar.Data, err = ioutil.ReadAll(file); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// DeleteAvatar удаляет изображение аватара пользователя группы. Если пользователь не найден
+// или у него нет аватара, то возвращается ошибка mgo.ErrNotFound.
+func (db *DB) DeleteAvatar(groupID string, userID bson.ObjectId) (err error) {
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	var user User
+	_, err = coll.Find(bson.M{"_id": userID, "groupid": groupID, "avatar": bson.M{"$exists": true}}).
+		Apply(mgo.Change{Update: bson.M{"$unset": bson.M{"avatar": ""}}}, &user)
+	if err != nil {
+		return
+	}
+	return coll.Database.GridFS(AvatarsPrefix).RemoveId(user.Avatar)
+}
@@ -0,0 +1,96 @@
+package users
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/mdigger/geotrack/mongo"
+)
+
+func TestProfileCheck(t *testing.T) {
+	str := func(s string) *string { return &s }
+	for _, test := range []struct {
+		profile Profile
+		err     error
+	}{
+		{Profile{}, nil},
+		{Profile{Locale: str("ru"), Timezone: str("Europe/Moscow"), Units: str(UnitsMetric)}, nil},
+		{Profile{Locale: str("en-US"), Units: str(UnitsImperial)}, nil},
+		{Profile{Locale: str(""), Timezone: str(""), Units: str("")}, nil},
+		{Profile{Locale: str("russian language")}, ErrBadLocale},
+		{Profile{Timezone: str("Mars/Olympus")}, ErrBadTimezone},
+		{Profile{Timezone: str("Local")}, ErrBadTimezone},
+		{Profile{Units: str("parsecs")}, ErrBadUnits},
+	} {
+		if err := test.profile.Check(); err != test.err {
+			t.Errorf("%+v: %v, expected %v", test.profile, err, test.err)
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	mdb, err := mongo.Connect("mongodb://localhost/watch")
+	if err != nil {
+		log.Println("Error connecting to MongoDB:", err)
+		return
+	}
+	defer mdb.Close()
+
+	db, err := InitDB(mdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &User{Login: "test-" + NewGroupID(), GroupID: NewGroupID()}
+	if err := db.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Remove(user.GroupID, user.ID)
+
+	name, timezone, icon := "Test User", "Europe/Moscow", byte(3)
+	err = db.UpdateProfile(user.GroupID, user.ID, &Profile{Name: &name, Timezone: &timezone, Icon: &icon})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateProfile(NewGroupID(), user.ID, &Profile{Name: &name}); err == nil {
+		t.Error("profile of another group updated")
+	}
+	image := []byte("\x89PNG\r\n\x1a\n")
+	avatarID, err := db.SetAvatar(user.GroupID, user.ID, "image/png", image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SetAvatar(user.GroupID, user.ID, "text/plain", image); err != ErrBadAvatar {
+		t.Error("bad avatar type accepted")
+	}
+	if _, err := db.SetAvatar(user.GroupID, user.ID, "image/jpeg", image); err != ErrBadAvatar {
+		t.Error("avatar with mismatched type accepted")
+	}
+	if _, err := db.SetAvatar(user.GroupID, user.ID, "image/png", []byte("<html><script>")); err != ErrBadAvatar {
+		t.Error("HTML avatar accepted")
+	}
+	avatar, err := db.GetAvatar(user.GroupID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avatar.ID != avatarID || avatar.ContentType != "image/png" || !bytes.Equal(avatar.Data, image) {
+		t.Errorf("bad avatar: %+v", avatar)
+	}
+	group, err := db.GetGroup(user.GroupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(group.Members) != 1 {
+		t.Fatalf("bad group: %+v", group)
+	}
+	member := group.Members[0]
+	if member.Name != name || member.Timezone != timezone || member.Icon != icon || member.Avatar != avatarID {
+		t.Errorf("bad group member: %+v", member)
+	}
+	if err := db.DeleteAvatar(user.GroupID, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetAvatar(user.GroupID, user.ID); err == nil {
+		t.Error("avatar not deleted")
+	}
+}
@@ -0,0 +1,114 @@
+package users
+
+import (
+	"errors"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Роли пользователей в группе.
+const (
+	RoleOwner  = "owner"  // владелец группы
+	RoleAdmin  = "admin"  // администратор: управляет пользователями и настройками группы
+	RoleMember = "member" // участник: может изменять данные группы
+	RoleViewer = "viewer" // наблюдатель: может только просматривать данные группы
+)
+
+// ErrBadRole возвращается при указании неизвестной роли пользователя.
+var ErrBadRole = errors.New("bad user role")
+
+// roleLevels задает уровень полномочий каждой роли.
+var roleLevels = map[string]int{
+	RoleViewer: 1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+// ValidRole возвращает true, если роль известна.
+func ValidRole(role string) bool {
+	return roleLevels[role] > 0
+}
+
+// HasRole возвращает true, если полномочия роли не ниже требуемой.
+func HasRole(role, required string) bool {
+	return roleLevels[role] >= roleLevels[required]
+}
+
+// CanManage возвращает true, если пользователь с указанной ролью может управлять
+// пользователем с другой ролью или назначать ее: для этого его полномочия должны быть
+// выше, а сам он должен быть не ниже администратора.
+func CanManage(role, target string) bool {
+	return HasRole(role, RoleAdmin) && roleLevels[role] > roleLevels[target]
+}
+
+// GetRole возвращает роль пользователя в группе. Пользователи, для которых роль не была
+// задана, считаются участниками группы. Если пользователь не найден в группе, то
+// возвращается ошибка mgo.ErrNotFound.
+func (db *DB) GetRole(groupID string, userID bson.ObjectId) (role string, err error) {
+	coll := db.GetCollection(CollectionName)
+	var user User
+	err = coll.Find(bson.M{"_id": userID, "groupid": groupID}).Select(bson.M{"role": 1}).One(&user)
+	db.FreeCollection(coll)
+	if err != nil {
+		return
+	}
+	if user.Role == "" {
+		return RoleMember, nil
+	}
+	return user.Role, nil
+}
+
+// SetRole изменяет роль пользователя группы.
+func (db *DB) SetRole(groupID string, userID bson.ObjectId, role string) (err error) {
+	if !ValidRole(role) {
+		return ErrBadRole
+	}
+	coll := db.GetCollection(CollectionName)
+	err = coll.Update(bson.M{"_id": userID, "groupid": groupID},
+		bson.M{"$set": bson.M{"role": role}})
+	db.FreeCollection(coll)
+	return
+}
+
+// Remove удаляет пользователя из группы вместе с изображением его аватара. Если пользователь
+// не найден в группе, то возвращается ошибка mgo.ErrNotFound.
+func (db *DB) Remove(groupID string, userID bson.ObjectId) (err error) {
+	coll := db.GetCollection(CollectionName)
+	defer db.FreeCollection(coll)
+	var user User
+	_, err = coll.Find(bson.M{"_id": userID, "groupid": groupID}).
+		Apply(mgo.Change{Remove: true}, &user)
+	if err != nil || !user.Avatar.Valid() {
+		return
+	}
+	return coll.Database.GridFS(AvatarsPrefix).RemoveId(user.Avatar)
+}
+
+// GetInvites возвращает список действующих приглашений в группу.
+func (db *DB) GetInvites(groupID string) (invites []*Invite, err error) {
+	coll := db.GetCollection(InvitesCollectionName)
+	invites = make([]*Invite, 0)
+	err = coll.Find(bson.M{"groupid": groupID}).Sort("created").All(&invites)
+	db.FreeCollection(coll)
+	if err != nil {
+		return
+	}
+	for _, invite := range invites {
+		invite.Expires = invite.Created.Add(InviteExpired)
+	}
+	return
+}
+
+// RevokeInvite удаляет приглашение в группу. Если приглашение не найдено, то возвращается
+// ошибка ErrBadToken.
+func (db *DB) RevokeInvite(groupID, code string) (err error) {
+	coll := db.GetCollection(InvitesCollectionName)
+	err = coll.Remove(bson.M{"_id": code, "groupid": groupID})
+	db.FreeCollection(coll)
+	if err == mgo.ErrNotFound {
+		err = ErrBadToken
+	}
+	return
+}
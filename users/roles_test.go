@@ -0,0 +1,30 @@
+package users
+
+import "testing"
+
+func TestRoles(t *testing.T) {
+	for _, test := range []struct {
+		role, target string
+		has, manage  bool
+	}{
+		{RoleOwner, RoleOwner, true, false},
+		{RoleOwner, RoleAdmin, true, true},
+		{RoleAdmin, RoleAdmin, true, false},
+		{RoleAdmin, RoleMember, true, true},
+		{RoleAdmin, RoleViewer, true, true},
+		{RoleMember, RoleViewer, true, false},
+		{RoleMember, RoleAdmin, false, false},
+		{RoleViewer, RoleMember, false, false},
+		{"", RoleViewer, false, false},
+	} {
+		if HasRole(test.role, test.target) != test.has {
+			t.Errorf("HasRole(%q, %q) != %v", test.role, test.target, test.has)
+		}
+		if CanManage(test.role, test.target) != test.manage {
+			t.Errorf("CanManage(%q, %q) != %v", test.role, test.target, test.manage)
+		}
+	}
+	if ValidRole("root") || !ValidRole(RoleViewer) {
+		t.Error("bad role validation")
+	}
+}
@@ -1,38 +1,117 @@
 package users
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 var SampleGroupID = "540da544-981c-11e5-a22e-28cfe91a86a7"
 
-// GetSampleGroupID возвращает тестовый предопределенный идентификатор группы.
-func (db *DB) GetSampleGroupID() string {
+const sampleCount = 5 // количество тестовых пользователей
+
+// ErrSampleCredentials возвращается, если в хранилище найдены тестовые пользователи
+// с известными паролями.
+var ErrSampleCredentials = errors.New("sample user credentials found")
+
+// sampleUser возвращает логин и пароль тестового пользователя с указанным номером.
+func sampleUser(i int) (login, password string) {
+	return fmt.Sprintf("login%d", i+1), fmt.Sprintf("password%d", i+1)
+}
+
+// Seed наполняет хранилище тестовыми пользователями с предопределенным идентификатором
+// группы, если их еще нет, и возвращает этот идентификатор. Первый пользователь становится
+// владельцем группы, а остальные — ее участниками.
+//
+// Тестовые пользователи имеют известные пароли, поэтому должны использоваться только
+// для разработки и отладки.
+func (db *DB) Seed() (groupID string, err error) {
 	group, err := db.GetGroup(SampleGroupID)
+	if err != nil || group != nil {
+		return SampleGroupID, err
+	}
+	for i := 0; i < sampleCount; i++ {
+		login, password := sampleUser(i)
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+		if err != nil {
+			return "", err
+		}
+		role := RoleMember
+		if i == 0 {
+			role = RoleOwner
+		}
+		err = db.Save(&User{
+			Login:    login,
+			GroupID:  SampleGroupID,
+			Name:     fmt.Sprintf("User #%d", i+1),
+			Role:     role,
+			Icon:     byte(i),
+			Password: hash,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return SampleGroupID, nil
+}
+
+// getSample возвращает тестового пользователя с указанным логином. Учитываются только
+// пользователи тестовой группы.
+func (db *DB) getSample(login string) (user *User, err error) {
+	coll := db.GetCollection(CollectionName)
+	user = new(User)
+	err = coll.Find(bson.M{"login": login, "groupid": SampleGroupID}).One(user)
+	db.FreeCollection(coll)
+	return
+}
+
+// isSampleLogin возвращает true, если логин зарезервирован для тестовых пользователей.
+func isSampleLogin(login string) bool {
+	for i := 0; i < sampleCount; i++ {
+		if sample, _ := sampleUser(i); strings.EqualFold(login, sample) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSampleOwner возвращает идентификатор владельца тестовой группы.
+func (db *DB) GetSampleOwner() (userID bson.ObjectId, err error) {
+	login, _ := sampleUser(0)
+	user, err := db.getSample(login)
 	if err != nil {
-		panic(err)
+		return
 	}
-	// наполняем тестовыми данными
-	if group == nil {
-		for i := 0; i < 5; i++ {
-			password, err := bcrypt.GenerateFromPassword(
-				[]byte(fmt.Sprintf("password%d", i+1)), bcrypt.DefaultCost)
-			if err != nil {
-				panic(err)
-			}
-			err = db.Save(&User{
-				Login:    fmt.Sprintf("login%d", i+1),
-				GroupID:  SampleGroupID,
-				Name:     fmt.Sprintf("User #%d", i+1),
-				Icon:     byte(i),
-				Password: password,
-			})
-			if err != nil {
-				panic(err)
-			}
+	return user.ID, nil
+}
+
+// HasSampleCredentials возвращает true, если в тестовой группе есть хотя бы один тестовый
+// пользователь с известным паролем.
+func (db *DB) HasSampleCredentials() (bool, error) {
+	for i := 0; i < sampleCount; i++ {
+		login, password := sampleUser(i)
+		user, err := db.getSample(login)
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if bcrypt.CompareHashAndPassword(user.Password, []byte(password)) == nil {
+			return true, nil
 		}
 	}
-	return SampleGroupID
+	return false, nil
+}
+
+// RemoveSample удаляет тестовых пользователей из хранилища.
+func (db *DB) RemoveSample() (err error) {
+	coll := db.GetCollection(CollectionName)
+	_, err = coll.RemoveAll(bson.M{"groupid": SampleGroupID})
+	db.FreeCollection(coll)
+	return
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mdigger/geotrack/groups"
+	"github.com/mdigger/geotrack/mongo"
+	"github.com/mdigger/geotrack/users"
+)
+
+func main() {
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.Ltime)
+	mongourl := flag.String("mongo", "mongodb://localhost/watch", "mongoDB connection URL")
+	remove := flag.Bool("remove", false, "remove sample users instead of creating")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, "Create or remove sample group with test users for development\n")
+		fmt.Fprintf(os.Stderr, "%s [-params]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// устанавливаем соединение с сервером MongoDB
+	log.Printf("Connecting to MongoDB %q...", *mongourl)
+	mdb, err := mongo.Connect(*mongourl)
+	if err != nil {
+		log.Printf("Error connecting to MongoDB: %v", err)
+		return
+	}
+	defer mdb.Close()
+
+	usersDB, err := users.InitDB(mdb)
+	if err != nil {
+		log.Printf("Error initializing users: %v", err)
+		return
+	}
+	groupsDB, err := groups.InitDB(mdb)
+	if err != nil {
+		log.Printf("Error initializing groups: %v", err)
+		return
+	}
+
+	if *remove {
+		if err := usersDB.RemoveSample(); err != nil {
+			log.Printf("Error removing sample users: %v", err)
+			return
+		}
+		log.Printf("Sample users of group %q removed", users.SampleGroupID)
+		return
+	}
+
+	groupID, err := usersDB.Seed()
+	if err != nil {
+		log.Printf("Error creating sample users: %v", err)
+		return
+	}
+	// создаем описание тестовой группы, если его еще нет
+	if _, err := groupsDB.Get(groupID); err == groups.ErrNotFound {
+		ownerID, err := usersDB.GetSampleOwner()
+		if err != nil {
+			log.Printf("Error reading sample group owner: %v", err)
+			return
+		}
+		err = groupsDB.Create(&groups.Group{
+			ID:    groupID,
+			Name:  "Sample",
+			Owner: ownerID,
+		})
+		if err != nil {
+			log.Printf("Error creating sample group: %v", err)
+			return
+		}
+	} else if err != nil {
+		log.Printf("Error reading sample group: %v", err)
+		return
+	}
+	log.Printf("Sample group %q with users login1..login5 (password1..password5) is ready", groupID)
+	log.Print("Services refuse to start with these users unless run with -dev flag")
+}